@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"github.com/scarecrow6977/twitter-crawler/crawler/crawler"
+	crawler_tasks "github.com/scarecrow6977/twitter-crawler/crawler/crawler-tasks"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage/backend"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+)
+
+// Backfill users: queues hydrate_users tasks for saved users without additional data, e.g. users saved before
+// the full profile was kept. The tasks are executed by the running crawler, which saves the full profiles.
+func main() {
+	var configPath string
+	var afterId int64
+	var priority int
+	flag.StringVar(&configPath, "config", "config.yaml", "path to the config file")
+	flag.Int64Var(&afterId, "after", 0, "queue users with greater ids only, e.g. to continue an interrupted run")
+	flag.IntVar(&priority, "priority", 0, "priority of the queued tasks")
+	flag.Parse()
+
+	conf.Init(configPath)
+	config, err := conf.LoadConfig()
+	if err != nil {
+		fmt.Printf("can't load config, err='%v'", err)
+		return
+	}
+	log.SetVerbosityLevel(2)
+
+	stor, err := backend.NewStorage(config)
+	if err != nil {
+		log.LogError("can't open storage, err='%v'", err)
+		return
+	}
+	defer stor.Close()
+	ctx := context.Background()
+	// tasks are only pushed, so the lease duration and retry policies of the queue aren't used
+	queue, err := crawler.NewTaskQueue(config.TaskQueue, stor, 0, nil)
+	if err != nil {
+		log.LogError("can't create task queue, err='%v'", err)
+		return
+	}
+	if _, ok := queue.(*crawler.StorageTaskQueue); !ok {
+		// the memory queue would be gone with this process, so the crawler would never run the tasks
+		log.LogError("backfill needs task_queue: %s, got '%s'", crawler.TaskQueueStorage, config.TaskQueue)
+		return
+	}
+
+	var found, queued int64
+	for {
+		userIds, err := stor.GetNotHydratedUserIds(ctx, afterId, 100*twitter_api.UsersLookupSize)
+		if err != nil {
+			log.LogError("can't get users after %d, err='%v'", afterId, err)
+			return
+		}
+		if len(userIds) == 0 {
+			break
+		}
+		tasks := make([]crawler.CrawlerTask, 0, len(userIds)/twitter_api.UsersLookupSize+1)
+		for i := 0; i < len(userIds); i += twitter_api.UsersLookupSize {
+			end := i + twitter_api.UsersLookupSize
+			if end > len(userIds) {
+				end = len(userIds)
+			}
+			tasks = append(tasks, &crawler_tasks.HydrateUsersTask{UserIds: userIds[i:end]})
+		}
+		n, err := queue.Push(ctx, priority, tasks)
+		if err != nil {
+			log.LogError("can't queue tasks, err='%v'", err)
+			return
+		}
+		found += int64(len(userIds))
+		queued += n
+		afterId = userIds[len(userIds)-1]
+		log.LogInfo("%d users found, %d tasks queued, last user id = %d", found, queued, afterId)
+	}
+	log.LogInfo("Users to backfill successfully queued.")
+}
@@ -17,21 +17,101 @@ type PostgresAccessConfig struct {
 	Password *string `yaml:"password,omitempty"`
 }
 
+// SQLiteConfig is the file a crawl is saved to by sqlite storage, it's created if it doesn't exist.
+type SQLiteConfig struct {
+	Path string `yaml:"path"`
+}
+
 type Neo4jAccessConfig struct {
 	Uri      string `yaml:"uri"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 }
 
+type TaskSourceConfig struct {
+	Type string `yaml:"type"`
+	// Weight is the share of the queue refill given to the source, 1 if it's not set.
+	// A source with weight 0 is disabled.
+	Weight   *int `yaml:"weight"`
+	Priority int  `yaml:"priority"`
+	// Mode of followers and friends sources: profiles downloads users with their profiles, edges downloads
+	// only their ids leaving profiles to the hydrate source.
+	Mode        string   `yaml:"mode,omitempty"`
+	ScreenNames []string `yaml:"screen_names,omitempty"`
+	// MaxTweets and MinDate (2006-01-02) limit the first download of a timeline by the tweets source
+	MaxTweets int    `yaml:"max_tweets,omitempty"`
+	MinDate   string `yaml:"min_date,omitempty"`
+	// Queries of the search source are searched from Since till Until (2006-01-02, the day of the first start by default)
+	// by slices of SliceDays days.
+	Queries   []string `yaml:"queries,omitempty"`
+	Since     string   `yaml:"since,omitempty"`
+	Until     string   `yaml:"until,omitempty"`
+	SliceDays int      `yaml:"slice_days,omitempty"`
+	// ListIds of the lists source, subscribers of the lists are downloaded too if Subscribers is set
+	ListIds     []int64 `yaml:"list_ids,omitempty"`
+	Subscribers bool    `yaml:"subscribers,omitempty"`
+}
+
+// AccountConfig is a logged in twitter session used by http client.
+type AccountConfig struct {
+	Name    string            `yaml:"name"`
+	Cookies map[string]string `yaml:"cookies"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// TorInstanceConfig is a tor instance used as a separate egress identity, its circuits are renewed
+// through the control port when twitter responds with 429.
+type TorInstanceConfig struct {
+	Socks      string `yaml:"socks"`
+	Control    string `yaml:"control"`
+	Password   string `yaml:"password,omitempty"`
+	CookieFile string `yaml:"cookie_file,omitempty"`
+}
+
+// ProxyPoolConfig lists proxies requests to twitter are made through, e.g. socks5://127.0.0.1:9050 for tor.
+type ProxyPoolConfig struct {
+	Proxies []string `yaml:"proxies"`
+	// MaxFailures is the number of failures in a row after which a proxy is evicted.
+	MaxFailures         int                 `yaml:"max_failures"`
+	PinAccounts         bool                `yaml:"pin_accounts"`
+	HealthCheckUrl      string              `yaml:"health_check_url"`
+	HealthCheckInterval int                 `yaml:"health_check_interval"`
+	Tor                 []TorInstanceConfig `yaml:"tor"`
+	// NewCircuitWait is the time in seconds given to tor to switch to new circuits.
+	NewCircuitWait int `yaml:"new_circuit_wait"`
+}
+
+// RetryPolicyConfig sets how tasks failed with errors of some class are retried, delays are in seconds.
+type RetryPolicyConfig struct {
+	MaxAttempts int     `yaml:"max_attempts"`
+	BaseDelay   int     `yaml:"base_delay"`
+	MaxDelay    int     `yaml:"max_delay"`
+	Jitter      float64 `yaml:"jitter"`
+}
+
 type MasterConfig struct {
-	NumOfWorkers       int                  `yaml:"num_of_workers"`
-	QueueSize          int                  `yaml:"queue_size"`
-	QueueNoRefillLimit int                  `yaml:"queue_no_refill_limit"`
-	ApiLimitTimeout    int                  `yaml:"api_limit_timeout"`
-	PostgresAccess     PostgresAccessConfig `yaml:"pg_access"`
-	Neo4jAccess        Neo4jAccessConfig    `yaml:"neo4j_access"`
-	Cookies            map[string]string    `yaml:"cookies"`
-	Headers            map[string]string    `yaml:"headers"`
+	NumOfWorkers       int                          `yaml:"num_of_workers"`
+	QueueSize          int                          `yaml:"queue_size"`
+	QueueNoRefillLimit int                          `yaml:"queue_no_refill_limit"`
+	ApiLimitTimeout    int                          `yaml:"api_limit_timeout"`
+	ShutdownTimeout    int                          `yaml:"shutdown_timeout"`
+	TaskQueue          string                       `yaml:"task_queue"`
+	TaskLeaseTimeout   int                          `yaml:"task_lease_timeout"`
+	MasterListen       string                       `yaml:"master_listen"`
+	MasterUrl          string                       `yaml:"master_url"`
+	MasterToken        string                       `yaml:"master_token"`
+	Storage            string                       `yaml:"storage"`
+	PostgresAccess     PostgresAccessConfig         `yaml:"pg_access"`
+	SQLite             SQLiteConfig                 `yaml:"sqlite"`
+	Neo4jAccess        Neo4jAccessConfig            `yaml:"neo4j_access"`
+	TwitterApiUrl      string                       `yaml:"twitter_api_url"`
+	Cookies            map[string]string            `yaml:"cookies"`
+	Headers            map[string]string            `yaml:"headers"`
+	Accounts           []AccountConfig              `yaml:"accounts"`
+	AccountQuarantine  int                          `yaml:"account_quarantine"`
+	ProxyPool          ProxyPoolConfig              `yaml:"proxy_pool"`
+	TaskSources        []TaskSourceConfig           `yaml:"task_sources"`
+	RetryPolicies      map[string]RetryPolicyConfig `yaml:"retry_policies"`
 }
 
 func Init(configFilePath string) {
@@ -0,0 +1,99 @@
+package crawler_tasks
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+)
+
+// DownloadFollowerIdsTask downloads followers of the user by 5000 ids a page and saves only the edges,
+// profiles of unknown followers are downloaded later by HydrateUsersTask. It shares the cursor and
+// crawl status of the user with DownloadFollowersTask, so a campaign should use only one of them.
+type DownloadFollowerIdsTask struct {
+	ScreenName string
+
+	*log.Logger `json:"-"`
+	// api is created from config if it's not set
+	api twitter_api.TwitterAPI
+}
+
+func (task *DownloadFollowerIdsTask) TaskType() string {
+	return models.TaskTypeDownloadFollowerIds
+}
+
+func (task *DownloadFollowerIdsTask) TaskKey() string {
+	return task.ScreenName
+}
+
+func (task *DownloadFollowerIdsTask) Exec(ctx context.Context, stor storage.Storage) error {
+	task.Logger = log.NewLogger(fmt.Sprintf("DownloadFollowerIdsTask '%s'", task.ScreenName))
+	if task.api == nil {
+		api, err := twitterApi()
+		if err != nil {
+			return errors.Wrap(err, "can't create twitter api client")
+		}
+		task.api = api
+	}
+
+	task.Logger.LogInfo("start downloading follower ids")
+
+	user, err := loadUser(ctx, stor, task.api, task.ScreenName, task.Logger)
+	if err != nil || user == nil {
+		return err
+	}
+	if user.CrawlStatus.IsTerminal() {
+		task.LogInfo("Exit cause crawl status of user is %s", user.CrawlStatus)
+		return nil
+	}
+	cursor := user.NextCursorStr
+
+	for cursor != "0" {
+		if ShuttingDown(ctx) {
+			err = stor.UpdateUserState(ctx, user)
+			if err != nil {
+				return err
+			}
+			task.LogInfo("Stopped by shutdown, next cursor = %s", cursor)
+			return ErrInterrupted
+		}
+		idsPage, err := task.api.FollowerIds(ctx, user.Id, cursor)
+		if status, ok := userCrawlStatus(err); ok {
+			user.CrawlStatus = status
+			err = stor.UpdateUserState(ctx, user)
+			task.LogInfo("Exit cause user is %s", status)
+			return err
+		}
+		if err != nil {
+			// the task is retried later according to the retry policy of the error class
+			return err
+		}
+
+		followers := make([]*models.Follower, 0, len(idsPage.Ids))
+		for _, followerId := range idsPage.Ids {
+			followers = append(followers, &models.Follower{
+				UserId:     user.Id,
+				FollowerId: followerId,
+			})
+		}
+		user.NextCursor = idsPage.NextCursor
+		user.NextCursorStr = idsPage.NextCursorStr
+		if idsPage.NextCursor == 0 {
+			user.CrawlStatus = models.CrawlStatusDone
+		}
+		err = stor.CommitFollowersPage(ctx, &models.FollowersPage{User: user, Followers: followers})
+		if err != nil {
+			return err
+		}
+
+		cursor = user.NextCursorStr
+
+		task.LogInfo("downloaded %d follower ids", len(followers))
+	}
+	task.LogInfo("Follower ids successfully downloaded.")
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package crawler_tasks
+
+import (
+	"context"
+	fake_twitter "github.com/scarecrow6977/twitter-crawler/crawler/fake-twitter"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	memory_storage "github.com/scarecrow6977/twitter-crawler/crawler/storage/memory-storage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDownloadFollowerIdsTask_Exec(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	followerIds := make([]int64, 0, 5200)
+	for i := 0; i < 5200; i++ {
+		followerIds = append(followerIds, graph.Users()[i%500].Id+int64(i/500)*1000000)
+	}
+	target := graph.AddUser("target", false, followerIds)
+
+	stor := newFollowersStorage()
+	task := &DownloadFollowerIdsTask{ScreenName: "target", api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, followerIds, stor.followerIds(target.Id))
+	assert.Equal(t, models.CrawlStatusDone, stor.users[target.Id].CrawlStatus)
+	assert.Len(t, stor.users, 1, "profiles of followers shouldn't be downloaded")
+	assert.Equal(t, 2, server.Requests("/1.1/followers/ids.json"))
+}
+
+func TestHydrateUsersTask_Exec(t *testing.T) {
+	graph, _, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	users := graph.Users()
+	graph.SuspendUser(users[1].Id)
+
+	stor := newFollowersStorage()
+	task := &HydrateUsersTask{UserIds: []int64{users[0].Id, users[1].Id, users[2].Id, 999999}, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+	assert.Len(t, stor.users, 4)
+	assert.Equal(t, users[2].ScreenName, stor.users[users[2].Id].ScreenName)
+	assert.Equal(t, models.CrawlStatusPending, stor.users[users[2].Id].CrawlStatus)
+	assert.Equal(t, models.CrawlStatusNotFound, stor.users[users[1].Id].CrawlStatus)
+	assert.Equal(t, models.CrawlStatusNotFound, stor.users[999999].FriendsCrawlStatus)
+
+	task = &HydrateUsersTask{UserIds: []int64{users[1].Id}, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor), "users which don't exist anymore are skipped")
+}
+
+func TestHydrateUsersTask_NotFoundUsersAreNotUnknown(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	users := graph.Users()
+	stor := memory_storage.NewMemoryStorage()
+	err := stor.AddNewFollowers(context.Background(), []*models.Follower{
+		{UserId: users[0].Id, FollowerId: users[1].Id},
+		{UserId: users[0].Id, FollowerId: 999998},
+		{UserId: users[0].Id, FollowerId: 999999},
+	})
+	assert.NoError(t, err)
+
+	userIds, err := stor.GetUnknownUserIds(context.Background(), 0, 100)
+	assert.NoError(t, err)
+	assert.Len(t, userIds, 4)
+	task := &HydrateUsersTask{UserIds: userIds, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	userIds, err = stor.GetUnknownUserIds(context.Background(), 0, 100)
+	assert.NoError(t, err)
+	assert.Empty(t, userIds, "users not returned by twitter should not be looked up again")
+	pending, err := stor.GetUsersWithNotDownloadedFollowers(context.Background(), 100)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 2, "users not found should not be crawled")
+	assert.Equal(t, 1, server.Requests("/1.1/users/lookup.json"))
+
+	graph.SuspendUser(users[1].Id)
+	task = &HydrateUsersTask{UserIds: []int64{users[1].Id}, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+	saved, err := stor.GetUserById(context.Background(), users[1].Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, users[1].ScreenName, saved.ScreenName, "saved users should keep their profiles")
+	}
+}
@@ -0,0 +1,344 @@
+package crawler_tasks
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	fake_twitter "github.com/scarecrow6977/twitter-crawler/crawler/fake-twitter"
+	http_client "github.com/scarecrow6977/twitter-crawler/crawler/http-client"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	memory_storage "github.com/scarecrow6977/twitter-crawler/crawler/storage/memory-storage"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// followersStorage keeps users, followers and tweets saved by tasks in memory.
+type followersStorage struct {
+	storage.Storage
+	users        map[int64]*models.User
+	followers    []*models.Follower
+	tweets       map[int64]*models.Tweet
+	interactions []*models.Interaction
+	searches     map[string]*models.SearchState
+	lists        map[int64]*models.List
+	memberships  []*models.ListMembership
+	// commitErrAt makes the commit of the page with this number (from 1) fail, nothing of the page is saved
+	commitErrAt int
+	commits     int
+}
+
+func newFollowersStorage() *followersStorage {
+	return &followersStorage{
+		users:    make(map[int64]*models.User),
+		tweets:   make(map[int64]*models.Tweet),
+		searches: make(map[string]*models.SearchState),
+		lists:    make(map[int64]*models.List),
+	}
+}
+
+func (s *followersStorage) GetUserByScreenName(ctx context.Context, screenName string) (*models.User, error) {
+	for _, user := range s.users {
+		if strings.EqualFold(user.ScreenName, screenName) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *followersStorage) GetUserById(ctx context.Context, id int64) (*models.User, error) {
+	if user, ok := s.users[id]; ok {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *followersStorage) AddNewUsers(ctx context.Context, users []*models.User) error {
+	for _, user := range users {
+		if _, ok := s.users[user.Id]; !ok {
+			copied := *user
+			s.users[user.Id] = &copied
+		}
+	}
+	return nil
+}
+
+func (s *followersStorage) AddNewFollowers(ctx context.Context, followers []*models.Follower) error {
+	s.followers = append(s.followers, followers...)
+	return nil
+}
+
+func (s *followersStorage) UpdateUserState(ctx context.Context, user *models.User) error {
+	stored := s.users[user.Id]
+	stored.NextCursor = user.NextCursor
+	stored.NextCursorStr = user.NextCursorStr
+	stored.CrawlStatus = user.CrawlStatus
+	return nil
+}
+
+func (s *followersStorage) CommitFollowersPage(ctx context.Context, page *models.FollowersPage) error {
+	s.commits++
+	if s.commits == s.commitErrAt {
+		return errors.New("commit failed")
+	}
+	s.AddNewUsers(ctx, page.Users)
+	s.AddNewFollowers(ctx, page.Followers)
+	if page.Friends {
+		return s.UpdateUserFriendsState(ctx, page.User)
+	}
+	return s.UpdateUserState(ctx, page.User)
+}
+
+func (s *followersStorage) UpdateUserFriendsState(ctx context.Context, user *models.User) error {
+	stored := s.users[user.Id]
+	stored.FriendsNextCursor = user.FriendsNextCursor
+	stored.FriendsNextCursorStr = user.FriendsNextCursorStr
+	stored.FriendsCrawlStatus = user.FriendsCrawlStatus
+	return nil
+}
+
+func (s *followersStorage) UpdateUserTweetsState(ctx context.Context, user *models.User) error {
+	stored := s.users[user.Id]
+	stored.TweetsCursor = user.TweetsCursor
+	stored.TweetsSinceId = user.TweetsSinceId
+	return nil
+}
+
+func (s *followersStorage) AddNewTweets(ctx context.Context, tweets []*models.Tweet) error {
+	for _, tweet := range tweets {
+		if _, ok := s.tweets[tweet.Id]; !ok {
+			s.tweets[tweet.Id] = tweet
+		}
+	}
+	return nil
+}
+
+func (s *followersStorage) AddNewInteractions(ctx context.Context, interactions []*models.Interaction) error {
+	s.interactions = append(s.interactions, interactions...)
+	return nil
+}
+
+func (s *followersStorage) GetSearchState(ctx context.Context, key string) (*models.SearchState, error) {
+	state, ok := s.searches[key]
+	if !ok {
+		return nil, nil
+	}
+	copied := *state
+	return &copied, nil
+}
+
+func (s *followersStorage) UpdateSearchState(ctx context.Context, state *models.SearchState) error {
+	copied := *state
+	s.searches[state.Key] = &copied
+	return nil
+}
+
+func (s *followersStorage) AddNewLists(ctx context.Context, lists []*models.List) error {
+	for _, list := range lists {
+		copied := *list
+		if stored, ok := s.lists[list.Id]; ok {
+			copied.MembersNextCursorStr, copied.MembersCrawlStatus = stored.CrawlState(models.ListRelationMember)
+			copied.SubscribersNextCursorStr, copied.SubscribersCrawlStatus = stored.CrawlState(models.ListRelationSubscriber)
+		}
+		s.lists[list.Id] = &copied
+	}
+	return nil
+}
+
+func (s *followersStorage) GetListById(ctx context.Context, id int64) (*models.List, error) {
+	list, ok := s.lists[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *list
+	return &copied, nil
+}
+
+func (s *followersStorage) UpdateListState(ctx context.Context, list *models.List, relation models.ListRelation) error {
+	cursor, status := list.CrawlState(relation)
+	s.lists[list.Id].SetCrawlState(relation, cursor, status)
+	return nil
+}
+
+func (s *followersStorage) AddListMemberships(ctx context.Context, memberships []*models.ListMembership) error {
+	s.memberships = append(s.memberships, memberships...)
+	return nil
+}
+
+func (s *followersStorage) GetLastTweetId(ctx context.Context, userId int64) (int64, error) {
+	var lastTweetId int64
+	for _, tweet := range s.tweets {
+		if tweet.UserId == userId && tweet.Id > lastTweetId {
+			lastTweetId = tweet.Id
+		}
+	}
+	return lastTweetId, nil
+}
+
+func (s *followersStorage) followerIds(userId int64) []int64 {
+	var ids []int64
+	for _, follower := range s.followers {
+		if follower.UserId == userId {
+			ids = append(ids, follower.FollowerId)
+		}
+	}
+	return ids
+}
+
+func newFakeTwitter(t *testing.T, options fake_twitter.ServerOptions) (*fake_twitter.Graph, *fake_twitter.Server, *httptest.Server, twitter_api.TwitterAPI) {
+	graph := fake_twitter.NewGraph(fake_twitter.GraphOptions{Users: 500, AvgFollowers: 10, Seed: 1})
+	server := fake_twitter.NewServer(graph, options)
+	httpServer := httptest.NewServer(server)
+	account, err := http_client.NewTwitterAccount("test", map[string]string{"ct0": "test"}, map[string]string{"authorization": "Bearer test"})
+	assert.NoError(t, err)
+	api := twitter_api.NewClient(httpServer.URL, http_client.NewHttpClient([]*http_client.TwitterAccount{account}, nil, time.Hour))
+	return graph, server, httpServer, api
+}
+
+func TestDownloadFollowersTask_Exec(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{RateLimit: 2, RateLimitWindow: time.Second})
+	defer httpServer.Close()
+	followerIds := make([]int64, 0, 450)
+	for _, user := range graph.Users()[:450] {
+		followerIds = append(followerIds, user.Id)
+	}
+	target := graph.AddUser("Target", false, followerIds)
+
+	stor := newFollowersStorage()
+	task := &DownloadFollowersTask{ScreenName: "target", api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, followerIds, stor.followerIds(target.Id))
+	stored := stor.users[target.Id]
+	assert.Equal(t, models.CrawlStatusDone, stored.CrawlStatus)
+	assert.Equal(t, "0", stored.NextCursorStr)
+	assert.Len(t, stor.users, 451)
+	// 3 pages of 200 followers, rate limiter of the client waits for the next window instead of getting 429
+	assert.Equal(t, 3, server.Requests("/1.1/followers/list.json"))
+}
+
+func TestDownloadFollowersTask_Resume(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	followerIds := make([]int64, 0, 300)
+	for _, user := range graph.Users()[:300] {
+		followerIds = append(followerIds, user.Id)
+	}
+	target := graph.AddUser("target", false, followerIds)
+
+	stor := newFollowersStorage()
+	resumed := *target
+	resumed.NextCursor = 1600000000000000200
+	resumed.NextCursorStr = "1600000000000000200"
+	resumed.CrawlStatus = models.CrawlStatusPending
+	assert.NoError(t, stor.AddNewUsers(context.Background(), []*models.User{&resumed}))
+	task := &DownloadFollowersTask{ScreenName: "target", api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, followerIds[200:], stor.followerIds(target.Id))
+	assert.Equal(t, models.CrawlStatusDone, stor.users[target.Id].CrawlStatus)
+	assert.Equal(t, 0, server.Requests("/1.1/users/show.json"))
+}
+
+func TestDownloadFollowersTask_FailedCommit(t *testing.T) {
+	graph, _, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	followerIds := make([]int64, 0, 450)
+	for _, user := range graph.Users()[:450] {
+		followerIds = append(followerIds, user.Id)
+	}
+	target := graph.AddUser("target", false, followerIds)
+
+	stor := newFollowersStorage()
+	stor.commitErrAt = 2
+	task := &DownloadFollowersTask{ScreenName: "target", api: api}
+	assert.Error(t, task.Exec(context.Background(), stor))
+	assert.Equal(t, followerIds[:200], stor.followerIds(target.Id))
+	assert.Equal(t, "1600000000000000200", stor.users[target.Id].NextCursorStr)
+
+	// edges of the saved page aren't saved twice, the crawl continues right after it
+	task = &DownloadFollowersTask{ScreenName: "target", api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+	assert.Equal(t, followerIds, stor.followerIds(target.Id))
+	assert.Equal(t, models.CrawlStatusDone, stor.users[target.Id].CrawlStatus)
+}
+
+func TestDownloadFollowersTask_MemoryStorage(t *testing.T) {
+	graph, _, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	followerIds := make([]int64, 0, 250)
+	for _, user := range graph.Users()[:250] {
+		followerIds = append(followerIds, user.Id)
+	}
+	target := graph.AddUser("target", false, followerIds)
+
+	stor := memory_storage.NewMemoryStorage()
+	task := &DownloadFollowersTask{ScreenName: "target", api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	savedIds, err := stor.GetFollowerIds(context.Background(), target.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, followerIds, savedIds)
+	saved, err := stor.GetUserById(context.Background(), target.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, models.CrawlStatusDone, saved.CrawlStatus)
+	}
+	followers, err := stor.GetFollowers(context.Background(), target.Id)
+	assert.NoError(t, err)
+	assert.Len(t, followers, 250)
+}
+
+func TestDownloadFollowersTask_PrivateProfile(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	target := graph.AddUser("private", true, []int64{graph.Users()[0].Id})
+
+	stor := newFollowersStorage()
+	task := &DownloadFollowersTask{ScreenName: "private", api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Empty(t, stor.followerIds(target.Id))
+	assert.Equal(t, models.CrawlStatusProtected, stor.users[target.Id].CrawlStatus)
+
+	// users in terminal states aren't requested again
+	assert.NoError(t, task.Exec(context.Background(), stor))
+	assert.Equal(t, 1, server.Requests("/1.1/followers/list.json"))
+}
+
+func TestDownloadFollowersTask_SuspendedAndNotFound(t *testing.T) {
+	graph, _, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	target := graph.AddUser("suspended", false, []int64{graph.Users()[0].Id})
+
+	stor := newFollowersStorage()
+	stored := *target
+	stored.NextCursorStr = "-1"
+	stored.CrawlStatus = models.CrawlStatusPending
+	assert.NoError(t, stor.AddNewUsers(context.Background(), []*models.User{&stored}))
+	graph.SuspendUser(target.Id)
+	task := &DownloadFollowersTask{ScreenName: "suspended", api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+	assert.Equal(t, models.CrawlStatusSuspended, stor.users[target.Id].CrawlStatus)
+
+	task = &DownloadFollowersTask{ScreenName: "not_exists", api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+	assert.Len(t, stor.users, 1)
+}
+
+func TestDownloadFollowersTask_ExpiredSession(t *testing.T) {
+	graph, _, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{InvalidTokens: []string{"test"}})
+	defer httpServer.Close()
+	graph.AddUser("target", true, nil)
+
+	stor := newFollowersStorage()
+	task := &DownloadFollowersTask{ScreenName: "target", api: api}
+	err := task.Exec(context.Background(), stor)
+	assert.True(t, errors.Is(err, twitter_api.ErrBadAuth), "expired session shouldn't look like private profile, err='%v'", err)
+	assert.Equal(t, ErrorClassAuth, ClassifyError(err))
+}
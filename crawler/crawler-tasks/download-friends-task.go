@@ -0,0 +1,120 @@
+package crawler_tasks
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+)
+
+// DownloadFriendsTask downloads users the user follows. Edges are saved to followers reversed, i.e. the user
+// is the follower. With IdsOnly set only ids of friends are downloaded, 5000 a page, and their profiles are
+// left to HydrateUsersTask.
+type DownloadFriendsTask struct {
+	ScreenName string
+	IdsOnly    bool
+
+	*log.Logger `json:"-"`
+	// api is created from config if it's not set
+	api twitter_api.TwitterAPI
+}
+
+func (task *DownloadFriendsTask) TaskType() string {
+	return models.TaskTypeDownloadFriends
+}
+
+func (task *DownloadFriendsTask) TaskKey() string {
+	return task.ScreenName
+}
+
+func (task *DownloadFriendsTask) Exec(ctx context.Context, stor storage.Storage) error {
+	task.Logger = log.NewLogger(fmt.Sprintf("DownloadFriendsTask '%s'", task.ScreenName))
+	if task.api == nil {
+		api, err := twitterApi()
+		if err != nil {
+			return errors.Wrap(err, "can't create twitter api client")
+		}
+		task.api = api
+	}
+
+	task.Logger.LogInfo("start downloading friends")
+
+	user, err := loadUser(ctx, stor, task.api, task.ScreenName, task.Logger)
+	if err != nil || user == nil {
+		return err
+	}
+	if user.FriendsCrawlStatus.IsTerminal() {
+		task.LogInfo("Exit cause friends crawl status of user is %s", user.FriendsCrawlStatus)
+		return nil
+	}
+	cursor := user.FriendsNextCursorStr
+
+	for cursor != "0" {
+		if ShuttingDown(ctx) {
+			err = stor.UpdateUserFriendsState(ctx, user)
+			if err != nil {
+				return err
+			}
+			task.LogInfo("Stopped by shutdown, next cursor = %s", cursor)
+			return ErrInterrupted
+		}
+		friends, friendIds, nextCursor, nextCursorStr, err := task.downloadPage(ctx, user.Id, cursor)
+		if status, ok := userCrawlStatus(err); ok {
+			user.FriendsCrawlStatus = status
+			err = stor.UpdateUserFriendsState(ctx, user)
+			task.LogInfo("Exit cause user is %s", status)
+			return err
+		}
+		if err != nil {
+			// the task is retried later according to the retry policy of the error class
+			return err
+		}
+
+		followers := make([]*models.Follower, 0, len(friendIds))
+		for _, friendId := range friendIds {
+			followers = append(followers, &models.Follower{
+				UserId:     friendId,
+				FollowerId: user.Id,
+			})
+		}
+		user.FriendsNextCursor = nextCursor
+		user.FriendsNextCursorStr = nextCursorStr
+		if nextCursor == 0 {
+			user.FriendsCrawlStatus = models.CrawlStatusDone
+		}
+		err = stor.CommitFollowersPage(ctx, &models.FollowersPage{User: user, Friends: true, Users: friends, Followers: followers})
+		if err != nil {
+			return err
+		}
+
+		cursor = user.FriendsNextCursorStr
+
+		task.LogInfo("downloaded %d friends", len(followers))
+	}
+	task.LogInfo("Friends successfully downloaded.")
+
+	return nil
+}
+
+// downloadPage returns profiles and ids of friends on the page, profiles are downloaded unless IdsOnly is set.
+func (task *DownloadFriendsTask) downloadPage(ctx context.Context, userId int64, cursor string) ([]*models.User, []int64, int64, string, error) {
+	if task.IdsOnly {
+		idsPage, err := task.api.FriendIds(ctx, userId, cursor)
+		if err != nil {
+			return nil, nil, 0, "", err
+		}
+		return nil, idsPage.Ids, idsPage.NextCursor, idsPage.NextCursorStr, nil
+	}
+	usersPage, err := task.api.FriendsList(ctx, userId, cursor)
+	if err != nil {
+		return nil, nil, 0, "", err
+	}
+	friendIds := make([]int64, 0, len(usersPage.Users))
+	for _, friend := range usersPage.Users {
+		friendIds = append(friendIds, friend.Id)
+	}
+	return usersPage.Users, friendIds, usersPage.NextCursor, usersPage.NextCursorStr, nil
+}
@@ -0,0 +1,57 @@
+package crawler_tasks
+
+import (
+	"context"
+	fake_twitter "github.com/scarecrow6977/twitter-crawler/crawler/fake-twitter"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// friendIds returns ids of users followed by the user from reversed edges.
+func (s *followersStorage) friendIds(userId int64) []int64 {
+	var ids []int64
+	for _, follower := range s.followers {
+		if follower.FollowerId == userId {
+			ids = append(ids, follower.UserId)
+		}
+	}
+	return ids
+}
+
+func TestDownloadFriendsTask_Exec(t *testing.T) {
+	graph, _, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	user := graph.Users()[7]
+	friendIds := graph.Friends(user.Id)
+	assert.NotEmpty(t, friendIds)
+
+	stor := newFollowersStorage()
+	task := &DownloadFriendsTask{ScreenName: user.ScreenName, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, friendIds, stor.friendIds(user.Id))
+	stored := stor.users[user.Id]
+	assert.Equal(t, models.CrawlStatusDone, stored.FriendsCrawlStatus)
+	assert.Equal(t, "0", stored.FriendsNextCursorStr)
+	assert.Equal(t, models.CrawlStatusPending, stored.CrawlStatus, "followers status should stay untouched")
+	assert.Equal(t, "-1", stored.NextCursorStr)
+	assert.Len(t, stor.users, len(friendIds)+1)
+}
+
+func TestDownloadFriendsTask_IdsOnly(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	user := graph.Users()[0]
+	target := graph.AddUser("target", false, []int64{user.Id})
+
+	stor := newFollowersStorage()
+	task := &DownloadFriendsTask{ScreenName: user.ScreenName, IdsOnly: true, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, graph.Friends(user.Id), stor.friendIds(user.Id))
+	assert.Contains(t, stor.friendIds(user.Id), target.Id)
+	assert.Equal(t, models.CrawlStatusDone, stor.users[user.Id].FriendsCrawlStatus)
+	assert.Len(t, stor.users, 1, "profiles of friends shouldn't be downloaded")
+	assert.Equal(t, 1, server.Requests("/1.1/friends/ids.json"))
+}
@@ -0,0 +1,161 @@
+package crawler_tasks
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+)
+
+// DownloadListTask downloads metadata of the list and its members, or subscribers if Subscribers is set.
+// Users of the list are saved as seeds for downloading followers.
+type DownloadListTask struct {
+	ListId      int64
+	Subscribers bool
+
+	*log.Logger `json:"-"`
+	// api is created from config if it's not set
+	api twitter_api.TwitterAPI
+}
+
+func (task *DownloadListTask) TaskType() string {
+	return models.TaskTypeDownloadList
+}
+
+func (task *DownloadListTask) TaskKey() string {
+	return fmt.Sprintf("%d:%s", task.ListId, task.relation())
+}
+
+func (task *DownloadListTask) relation() models.ListRelation {
+	if task.Subscribers {
+		return models.ListRelationSubscriber
+	}
+	return models.ListRelationMember
+}
+
+func (task *DownloadListTask) Exec(ctx context.Context, stor storage.Storage) error {
+	task.Logger = log.NewLogger(fmt.Sprintf("DownloadListTask '%s'", task.TaskKey()))
+	if task.api == nil {
+		api, err := twitterApi()
+		if err != nil {
+			return errors.Wrap(err, "can't create twitter api client")
+		}
+		task.api = api
+	}
+
+	list, err := task.loadList(ctx, stor)
+	if err != nil || list == nil {
+		return err
+	}
+	relation := task.relation()
+	cursor, status := list.CrawlState(relation)
+	if status.IsTerminal() {
+		task.LogInfo("Exit cause crawl status of list %ss is %s", relation, status)
+		return nil
+	}
+
+	for cursor != "0" {
+		if ShuttingDown(ctx) {
+			err = stor.UpdateListState(ctx, list, relation)
+			if err != nil {
+				return err
+			}
+			task.LogInfo("Stopped by shutdown, next cursor = %s", cursor)
+			return ErrInterrupted
+		}
+		var usersPage *twitter_api.UsersPage
+		if task.Subscribers {
+			usersPage, err = task.api.ListSubscribers(ctx, list.Id, cursor)
+		} else {
+			usersPage, err = task.api.ListMembers(ctx, list.Id, cursor)
+		}
+		if errors.Is(err, twitter_api.ErrPageNotFound) {
+			list.SetCrawlState(relation, cursor, models.CrawlStatusNotFound)
+			task.LogInfo("Exit cause list is not found")
+			return stor.UpdateListState(ctx, list, relation)
+		}
+		if err != nil {
+			return err
+		}
+
+		memberships := make([]*models.ListMembership, 0, len(usersPage.Users))
+		for _, user := range usersPage.Users {
+			initCrawlState(user)
+			memberships = append(memberships, &models.ListMembership{
+				ListId:   list.Id,
+				UserId:   user.Id,
+				Relation: relation,
+			})
+		}
+		err = stor.AddNewUsers(ctx, usersPage.Users)
+		if err != nil {
+			return err
+		}
+		err = stor.AddListMemberships(ctx, memberships)
+		if err != nil {
+			return err
+		}
+
+		cursor = usersPage.NextCursorStr
+		status = models.CrawlStatusPending
+		if usersPage.NextCursor == 0 {
+			cursor = "0"
+			status = models.CrawlStatusDone
+		}
+		list.SetCrawlState(relation, cursor, status)
+		err = stor.UpdateListState(ctx, list, relation)
+		if err != nil {
+			return err
+		}
+		task.LogInfo("downloaded %d %ss", len(memberships), relation)
+	}
+	task.LogInfo("List %ss successfully downloaded.", relation)
+	return nil
+}
+
+// loadList requests metadata of the list and saves it, keeping the crawl state of the list if it's saved already.
+// Nil is returned if the list doesn't exist or is private.
+func (task *DownloadListTask) loadList(ctx context.Context, stor storage.Storage) (*models.List, error) {
+	stored, err := stor.GetListById(ctx, task.ListId)
+	if err != nil {
+		return nil, err
+	}
+	list, err := task.api.ShowList(ctx, task.ListId)
+	if errors.Is(err, twitter_api.ErrPageNotFound) {
+		task.LogInfo("List %d is not found", task.ListId)
+		if stored != nil {
+			stored.SetCrawlState(task.relation(), "-1", models.CrawlStatusNotFound)
+			return nil, stor.UpdateListState(ctx, stored, task.relation())
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil {
+		list.MembersNextCursorStr = stored.MembersNextCursorStr
+		list.MembersCrawlStatus = stored.MembersCrawlStatus
+		list.SubscribersNextCursorStr = stored.SubscribersNextCursorStr
+		list.SubscribersCrawlStatus = stored.SubscribersCrawlStatus
+	} else {
+		list.SetCrawlState(models.ListRelationMember, "-1", models.CrawlStatusPending)
+		list.SetCrawlState(models.ListRelationSubscriber, "-1", models.CrawlStatusPending)
+	}
+	if list.Owner != nil {
+		initCrawlState(list.Owner)
+		err = stor.AddNewUsers(ctx, []*models.User{list.Owner})
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = stor.AddNewLists(ctx, []*models.List{list})
+	if err != nil {
+		return nil, err
+	}
+	task.LogInfo("List '%s' of user %d has got %d members and %d subscribers", list.Name, list.OwnerId,
+		list.MemberCount, list.SubscriberCount)
+	return list, nil
+}
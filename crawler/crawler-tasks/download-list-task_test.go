@@ -0,0 +1,95 @@
+package crawler_tasks
+
+import (
+	"context"
+	fake_twitter "github.com/scarecrow6977/twitter-crawler/crawler/fake-twitter"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// listUserIds returns ids of users related to the list, in order they were saved.
+func (s *followersStorage) listUserIds(listId int64, relation models.ListRelation) []int64 {
+	var ids []int64
+	for _, membership := range s.memberships {
+		if membership.ListId == listId && membership.Relation == relation {
+			ids = append(ids, membership.UserId)
+		}
+	}
+	return ids
+}
+
+func TestDownloadListTask_Exec(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	users := graph.Users()
+	memberIds := make([]int64, 0, 450)
+	for _, user := range users[:450] {
+		memberIds = append(memberIds, user.Id)
+	}
+	subscriberIds := []int64{users[450].Id, users[451].Id}
+	list := graph.AddList(users[499].Id, "Go developers", memberIds, subscriberIds)
+
+	stor := newFollowersStorage()
+	task := &DownloadListTask{ListId: list.Id, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, memberIds, stor.listUserIds(list.Id, models.ListRelationMember))
+	stored := stor.lists[list.Id]
+	assert.Equal(t, "Go developers", stored.Name)
+	assert.Equal(t, users[499].Id, stored.OwnerId)
+	assert.Equal(t, int64(2), stored.SubscriberCount)
+	assert.Equal(t, models.CrawlStatusDone, stored.MembersCrawlStatus)
+	assert.Equal(t, models.CrawlStatusPending, stored.SubscribersCrawlStatus)
+	for _, memberId := range memberIds {
+		assert.Equal(t, models.CrawlStatusPending, stor.users[memberId].CrawlStatus, "members are seeds")
+	}
+	assert.Contains(t, stor.users, users[499].Id, "the owner is a seed too")
+	// a page has got up to 5000 members
+	assert.Equal(t, 1, server.Requests("/1.1/lists/members.json"))
+
+	task = &DownloadListTask{ListId: list.Id, Subscribers: true, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+	assert.Equal(t, subscriberIds, stor.listUserIds(list.Id, models.ListRelationSubscriber))
+	assert.Equal(t, models.CrawlStatusDone, stor.lists[list.Id].SubscribersCrawlStatus)
+	assert.Equal(t, models.CrawlStatusDone, stor.lists[list.Id].MembersCrawlStatus)
+}
+
+func TestDownloadListTask_Resume(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	users := graph.Users()
+	memberIds := make([]int64, 0, 300)
+	for _, user := range users[:300] {
+		memberIds = append(memberIds, user.Id)
+	}
+	list := graph.AddList(users[499].Id, "Go developers", memberIds, nil)
+
+	stor := newFollowersStorage()
+	resumed := *list
+	resumed.SetCrawlState(models.ListRelationMember, "1600000000000000200", models.CrawlStatusPending)
+	resumed.SetCrawlState(models.ListRelationSubscriber, "-1", models.CrawlStatusPending)
+	assert.NoError(t, stor.AddNewLists(context.Background(), []*models.List{&resumed}))
+	task := &DownloadListTask{ListId: list.Id, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, memberIds[200:], stor.listUserIds(list.Id, models.ListRelationMember))
+	assert.Equal(t, models.CrawlStatusDone, stor.lists[list.Id].MembersCrawlStatus)
+	assert.Equal(t, 1, server.Requests("/1.1/lists/members.json"))
+
+	// the done list isn't downloaded again
+	assert.NoError(t, task.Exec(context.Background(), stor))
+	assert.Equal(t, 1, server.Requests("/1.1/lists/members.json"))
+}
+
+func TestDownloadListTask_NotFound(t *testing.T) {
+	_, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+
+	stor := newFollowersStorage()
+	task := &DownloadListTask{ListId: 42, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Empty(t, stor.lists)
+	assert.Equal(t, 0, server.Requests("/1.1/lists/members.json"))
+}
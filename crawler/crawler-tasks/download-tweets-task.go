@@ -1,224 +1,176 @@
 package crawler_tasks
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"github.com/pkg/errors"
 	"github.com/scarecrow6977/twitter-crawler/crawler/log"
 	"github.com/scarecrow6977/twitter-crawler/crawler/models"
 	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
-	"io/ioutil"
-	"net/http"
-	"os"
-	"strconv"
-	"strings"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+	"sort"
+	"time"
 )
 
+// DownloadTweetsTask downloads the profile timeline of the user page by page, newest tweets first. The first
+// crawl goes down to the end of the timeline, MaxTweets or MinDate, next ones stop at tweets downloaded before.
+// The cursor is saved after every page, so an interrupted crawl continues where it stopped.
 type DownloadTweetsTask struct {
 	ScreenName string
+	// MaxTweets is the max number of tweets downloaded by a run of the task, 0 for no limit
+	MaxTweets int
+	// MinDate stops the crawl at tweets created before it, zero for no limit
+	MinDate time.Time
+
+	*log.Logger `json:"-"`
+	// api is created from config if it's not set
+	api twitter_api.TwitterAPI
+}
+
+func (task DownloadTweetsTask) TaskType() string {
+	return models.TaskTypeDownloadTweets
+}
 
-	cookies map[string]string
-	headers map[string]string
-	*log.Logger
+func (task DownloadTweetsTask) TaskKey() string {
+	return task.ScreenName
 }
 
-func (task DownloadTweetsTask) Exec(stor storage.Storage) error {
+func (task DownloadTweetsTask) Exec(ctx context.Context, stor storage.Storage) error {
 	task.Logger = log.NewLogger(fmt.Sprintf("DownloadTweetsTask '%s'", task.ScreenName))
 
-	config, err := conf.LoadConfig()
-	if err != nil {
-		return fmt.Errorf("can't load config, err='%v'", err)
+	if task.api == nil {
+		api, err := twitterApi()
+		if err != nil {
+			return errors.Wrap(err, "can't create twitter api client")
+		}
+		task.api = api
+	}
+
+	user, err := loadUser(ctx, stor, task.api, task.ScreenName, task.Logger)
+	if err != nil || user == nil {
+		return err
 	}
-	if !checkRequiredCookiesExists(config.Cookies) {
-		return fmt.Errorf("not all of required cookies are set in config, should be set %v", requiredCookies)
+	if user.CrawlStatus.IsTerminal() && user.CrawlStatus != models.CrawlStatusDone {
+		task.LogInfo("Exit cause user is %s", user.CrawlStatus)
+		return nil
 	}
-	if !checkRequiredHeadersExists(config.Headers) {
-		return fmt.Errorf("not all of required headers are set in config, should be set %v", requiredHeaders)
+	if user.TweetsCursor != "" {
+		task.LogInfo("Continue downloading tweets older than cursor %s", user.TweetsCursor)
 	}
-	task.cookies = config.Cookies
-	task.headers = config.Headers
 
-	user, err := stor.GetUserByScreenName(task.ScreenName)
-	if err != nil {
-		task.LogInfo("User '%s' not found in db, requesting...", task.ScreenName)
-		user, err = task.doShowRequest()
+	downloaded := 0
+	for {
+		if ShuttingDown(ctx) {
+			err = stor.UpdateUserTweetsState(ctx, user)
+			if err != nil {
+				return err
+			}
+			task.LogInfo("Stopped by shutdown, next cursor = %s", user.TweetsCursor)
+			return ErrInterrupted
+		}
+		timeline, err := task.api.ProfileTimeline(ctx, user.Id, user.TweetsCursor)
+		if status, ok := userCrawlStatus(err); ok {
+			user.CrawlStatus = status
+			task.LogInfo("Exit cause user is %s", status)
+			return stor.UpdateUserState(ctx, user)
+		}
 		if err != nil {
 			return err
 		}
-		err = stor.AddNewUsers([]*models.User{user})
+
+		tweets, last := task.newTweets(timeline, user, downloaded)
+		err = stor.AddNewTweets(ctx, tweets)
 		if err != nil {
 			return err
 		}
+		err = stor.AddNewInteractions(ctx, models.ExtractInteractions(tweets, timeline.GlobalObjects.Tweets))
+		if err != nil {
+			return err
+		}
+		// authors of retweeted, quoted and mentioned tweets aren't saved, otherwise they would become
+		// seeds of the followers crawl
+		if owner, ok := timeline.GlobalObjects.Users[user.IdStr]; ok {
+			err = stor.AddNewUsers(ctx, []*models.User{owner})
+			if err != nil {
+				return err
+			}
+		}
+		for _, tweet := range tweets {
+			if tweet.UserId == user.Id {
+				downloaded++
+			}
+		}
+
+		cursor := timeline.BottomCursor()
+		if last || cursor == "" || cursor == user.TweetsCursor {
+			break
+		}
+		user.TweetsCursor = cursor
+		err = stor.UpdateUserTweetsState(ctx, user)
+		if err != nil {
+			return err
+		}
+		task.LogInfo("downloaded %d tweets", downloaded)
 	}
-	cursor := ""
 
-	tweetJsonResp, err := task.doTweetsRequest(user.Id, cursor)
+	// the next crawl stops at the newest tweet downloaded so far
+	lastTweetId, err := stor.GetLastTweetId(ctx, user.Id)
 	if err != nil {
 		return err
 	}
-	tweets := tweetJsonResp.GlobalObjects.Tweets
-	users := tweetJsonResp.GlobalObjects.Users
-
-	dataToSave := struct {
-		Tweets map[string]*models.Tweet
-		Users  map[string]*models.User
-	}{
-		Tweets: tweets,
-		Users:  users,
-	}
-	jsonBytes, err := json.MarshalIndent(dataToSave, "", "\t")
-
-	fileName := "data/tweets/test.json" //fmt.Sprintf("data/tweets/%s", task.ScreenName)
-	err = ioutil.WriteFile(fileName, jsonBytes, os.ModePerm)
+	user.TweetsCursor = ""
+	user.TweetsSinceId = lastTweetId
+	err = stor.UpdateUserTweetsState(ctx, user)
 	if err != nil {
 		return err
 	}
-
-	task.LogInfo("Tweets successfully downloaded for user %s.", task.ScreenName)
+	task.LogInfo("Tweets successfully downloaded, %d new tweets.", downloaded)
 
 	return nil
 }
 
-func (task DownloadTweetsTask) doShowRequest() (user *models.User, err error) {
-	showReq, err := task.createShowRequest()
-	if err != nil {
-		return nil, err
-	}
-	resp, err := http.DefaultClient.Do(showReq)
-	if err != nil {
-		return nil, fmt.Errorf("request failed, err='%v'", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("bad response status code, got %d, want 200", resp.StatusCode)
-	}
-
-	jsonBytes, err := ioutil.ReadAll(resp.Body)
-
-	user = &models.User{}
-	err = json.Unmarshal(jsonBytes, user)
-	if err != nil {
-		return nil, err
-	}
-
-	//user.AdditionalData = string(jsonBytes)
-	user.NextCursor = -1
-	user.NextCursorStr = "-1"
-
-	return user, nil
-}
-
-func (task DownloadTweetsTask) doTweetsRequest(userId int64, cursor string) (userJsonResp *tweetJsonResponse, err error) {
-	tweetsReq, err := task.createTweetsRequest(userId, cursor)
-	if err != nil {
-		return nil, err
+// newTweets returns tweets of the page which should be saved, tweets of other users the page refers to
+// are saved too. last is true if the crawl should stop after the page.
+func (task DownloadTweetsTask) newTweets(timeline *twitter_api.Timeline, user *models.User, downloaded int) (tweets []*models.Tweet, last bool) {
+	own := make([]*models.Tweet, 0, len(timeline.GlobalObjects.Tweets))
+	for _, tweet := range timeline.GlobalObjects.Tweets {
+		if tweet.UserId == user.Id {
+			own = append(own, tweet)
+		} else {
+			tweets = append(tweets, tweet)
+		}
 	}
-	resp, err := http.DefaultClient.Do(tweetsReq)
-	if err != nil {
-		return nil, fmt.Errorf("request failed, err='%v'", err)
+	if len(own) == 0 {
+		return tweets, true
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("bad response status code, got %d, want 200", resp.StatusCode)
+	sort.Slice(own, func(i, j int) bool {
+		return own[i].Id > own[j].Id
+	})
+	// a pinned tweet can be older than the others, so only the oldest tweet of the page ends the crawl
+	oldest := own[len(own)-1]
+	if oldest.Id <= user.TweetsSinceId || task.tooOld(oldest) {
+		last = true
 	}
-
-	jsonBytes, err := ioutil.ReadAll(resp.Body)
-
-	tweetsJsonResp := &tweetJsonResponse{}
-	err = json.Unmarshal(jsonBytes, tweetsJsonResp)
-	if err != nil {
-		return nil, err
+	for _, tweet := range own {
+		if tweet.Id <= user.TweetsSinceId || task.tooOld(tweet) {
+			continue
+		}
+		if task.MaxTweets > 0 && downloaded >= task.MaxTweets {
+			return tweets, true
+		}
+		tweets = append(tweets, tweet)
+		downloaded++
 	}
-
-	return tweetsJsonResp, nil
-
-}
-
-func (task DownloadTweetsTask) createShowRequest() (*http.Request, error) {
-	req, err := http.NewRequest("GET", "https://api.twitter.com/1.1/users/show.json", nil)
-	if err != nil {
-		return nil, err
+	if task.MaxTweets > 0 && downloaded >= task.MaxTweets {
+		last = true
 	}
-	q := req.URL.Query()
-
-	q.Add("include_profile_interstitial_type", "1")
-	q.Add("include_blocking", "1")
-	q.Add("include_blocked_by", "1")
-	q.Add("include_followed_by", "1")
-	q.Add("include_want_retweets", "1")
-	q.Add("include_mute_edge", "1")
-	q.Add("include_can_dm", "1")
-	q.Add("include_can_media_tag", "1")
-	q.Add("skip_status", "1")
-	q.Add("screen_name", strings.ToLower(task.ScreenName))
-
-	req.URL.RawQuery = q.Encode()
-
-	req.Header.Set("authorization", task.headers["authorization"])
-	req.Header.Set("Origin", "https://twitter.com")
-	req.Header.Set("Referer", fmt.Sprintf("https://twitter.com/%s/followers", task.ScreenName))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/73.0.3683.103 Safari/537.36")
-	req.Header.Set("x-csrf-token", task.cookies["ct0"])
-	req.Header.Set("x-twitter-active-user", "yes")
-	req.Header.Set("x-twitter-auth-type", "OAuth2Session")
-	req.Header.Set("x-twitter-client-language", "en")
-
-	setCookiesForRequest(req, task.cookies)
-
-	return req, nil
+	return tweets, last
 }
 
-func (task DownloadTweetsTask) createTweetsRequest(userId int64, cursor string) (*http.Request, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://api.twitter.com/2/timeline/profile/%d.json", userId), nil)
-	if err != nil {
-		return nil, err
+func (task DownloadTweetsTask) tooOld(tweet *models.Tweet) bool {
+	if task.MinDate.IsZero() {
+		return false
 	}
-	q := req.URL.Query()
-	q.Add("include_profile_interstitial_type", "1")
-	q.Add("include_blocking", "1")
-	q.Add("include_blocked_by", "1")
-	q.Add("include_followed_by", "1")
-	q.Add("include_want_retweets", "1")
-	q.Add("include_mute_edge", "1")
-	q.Add("include_can_dm", "1")
-	q.Add("include_can_media_tag", "1")
-	q.Add("skip_status", "1")
-
-	q.Add("cards_platform", "Web-12")
-	q.Add("include_cards", "1")
-	q.Add("include_composer_source", "true")
-	q.Add("include_ext_alt_text", "true")
-	q.Add("include_reply_count", "1")
-	q.Add("tweet_mode", "extended")
-	q.Add("include_entities", "true")
-	q.Add("include_user_entities", "true")
-	q.Add("include_ext_media_color", "true")
-	q.Add("include_ext_media_availability", "true")
-	q.Add("send_error_codes", "true")
-	q.Add("include_tweet_replies", "false")
-
-	q.Add("userId", strconv.FormatInt(userId, 10))
-	q.Add("count", "200")
-
-	if cursor != "" {
-		q.Add("cursor", cursor)
-	}
-
-	q.Add("ext", "mediaStats,highlightedLabel,cameraMoment")
-
-	req.URL.RawQuery = q.Encode()
-
-	req.Header.Set("authorization", task.headers["authorization"])
-	req.Header.Set("Origin", "https://twitter.com")
-	req.Header.Set("Referer", fmt.Sprintf("https://twitter.com/%s", task.ScreenName))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/73.0.3683.103 Safari/537.36")
-	req.Header.Set("x-csrf-token", task.cookies["ct0"])
-	req.Header.Set("x-twitter-active-user", "yes")
-	req.Header.Set("x-twitter-auth-type", "OAuth2Session")
-	req.Header.Set("x-twitter-client-language", "en")
-
-	setCookiesForRequest(req, task.cookies)
-
-	return req, nil
+	createdAt, err := time.Parse(time.RubyDate, tweet.CreatedAt)
+	return err == nil && createdAt.Before(task.MinDate)
 }
@@ -0,0 +1,161 @@
+package crawler_tasks
+
+import (
+	"context"
+	fake_twitter "github.com/scarecrow6977/twitter-crawler/crawler/fake-twitter"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// tweetIds returns ids of saved tweets of the user.
+func (s *followersStorage) tweetIds(userId int64) map[int64]bool {
+	ids := make(map[int64]bool)
+	for _, tweet := range s.tweets {
+		if tweet.UserId == userId {
+			ids[tweet.Id] = true
+		}
+	}
+	return ids
+}
+
+func idsOf(tweets []*models.Tweet) map[int64]bool {
+	ids := make(map[int64]bool)
+	for _, tweet := range tweets {
+		ids[tweet.Id] = true
+	}
+	return ids
+}
+
+func TestDownloadTweetsTask_Exec(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	target := graph.AddUser("target", false, nil)
+	tweets := graph.AddTweets(target.Id, 450)
+
+	stor := newFollowersStorage()
+	task := DownloadTweetsTask{ScreenName: "target", api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, idsOf(tweets), stor.tweetIds(target.Id))
+	stored := stor.users[target.Id]
+	assert.Equal(t, "", stored.TweetsCursor)
+	assert.Equal(t, tweets[len(tweets)-1].Id, stored.TweetsSinceId)
+	assert.NotEmpty(t, stor.tweets[tweets[0].Id].Raw)
+	// 3 pages of 200 tweets and the last empty one
+	assert.Equal(t, 4, server.Requests("/2/timeline/profile"))
+}
+
+func TestDownloadTweetsTask_Refresh(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	target := graph.AddUser("target", false, nil)
+	graph.AddTweets(target.Id, 250)
+
+	stor := newFollowersStorage()
+	task := DownloadTweetsTask{ScreenName: "target", api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+	requests := server.Requests("/2/timeline/profile")
+
+	newTweets := graph.AddTweets(target.Id, 30)
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Len(t, stor.tweetIds(target.Id), 280)
+	assert.Equal(t, newTweets[len(newTweets)-1].Id, stor.users[target.Id].TweetsSinceId)
+	// the first page has got all new tweets and some downloaded before
+	assert.Equal(t, requests+1, server.Requests("/2/timeline/profile"))
+}
+
+// otherAuthorApi adds the profile of another user to every page of timelines, like twitter does
+// for authors of retweeted tweets.
+type otherAuthorApi struct {
+	twitter_api.TwitterAPI
+	author *models.User
+}
+
+func (a *otherAuthorApi) ProfileTimeline(ctx context.Context, userId int64, cursor string) (*twitter_api.Timeline, error) {
+	timeline, err := a.TwitterAPI.ProfileTimeline(ctx, userId, cursor)
+	if err == nil {
+		timeline.GlobalObjects.Users[a.author.IdStr] = a.author
+	}
+	return timeline, err
+}
+
+func TestDownloadTweetsTask_SavesOnlyOwner(t *testing.T) {
+	graph, _, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	target := graph.AddUser("target", false, nil)
+	graph.AddTweets(target.Id, 10)
+	author := graph.Users()[0]
+
+	stor := newFollowersStorage()
+	task := DownloadTweetsTask{ScreenName: "target", api: &otherAuthorApi{TwitterAPI: api, author: author}}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Contains(t, stor.users, target.Id)
+	assert.NotContains(t, stor.users, author.Id, "authors of other tweets should not become seeds of the crawl")
+}
+
+func TestDownloadTweetsTask_MaxTweets(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	target := graph.AddUser("target", false, nil)
+	tweets := graph.AddTweets(target.Id, 450)
+
+	stor := newFollowersStorage()
+	task := DownloadTweetsTask{ScreenName: "target", MaxTweets: 300, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, idsOf(tweets[150:]), stor.tweetIds(target.Id))
+	assert.Equal(t, 2, server.Requests("/2/timeline/profile"))
+}
+
+func TestDownloadTweetsTask_MinDate(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	target := graph.AddUser("target", false, nil)
+	tweets := graph.AddTweets(target.Id, 450)
+
+	stor := newFollowersStorage()
+	// tweets are a minute apart starting from 2010-01-01
+	minDate := time.Date(2010, 1, 1, 0, 100, 0, 0, time.UTC)
+	task := DownloadTweetsTask{ScreenName: "target", MinDate: minDate, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, idsOf(tweets[100:]), stor.tweetIds(target.Id))
+	assert.Equal(t, 2, server.Requests("/2/timeline/profile"))
+}
+
+func TestDownloadTweetsTask_Resume(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	target := graph.AddUser("target", false, nil)
+	tweets := graph.AddTweets(target.Id, 450)
+
+	stor := newFollowersStorage()
+	resumed := *target
+	resumed.TweetsCursor = "1600000000000000200"
+	assert.NoError(t, stor.AddNewUsers(context.Background(), []*models.User{&resumed}))
+	task := DownloadTweetsTask{ScreenName: "target", api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, idsOf(tweets[:250]), stor.tweetIds(target.Id))
+	assert.Equal(t, "", stor.users[target.Id].TweetsCursor)
+	assert.Equal(t, 3, server.Requests("/2/timeline/profile"))
+}
+
+func TestDownloadTweetsTask_PrivateProfile(t *testing.T) {
+	graph, _, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	target := graph.AddUser("private", true, nil)
+	graph.AddTweets(target.Id, 10)
+
+	stor := newFollowersStorage()
+	task := DownloadTweetsTask{ScreenName: "private", api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Empty(t, stor.tweetIds(target.Id))
+	assert.Equal(t, models.CrawlStatusProtected, stor.users[target.Id].CrawlStatus)
+}
@@ -0,0 +1,84 @@
+package crawler_tasks
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+	"net"
+)
+
+// ErrorClass groups task errors which should be retried the same way.
+type ErrorClass string
+
+const (
+	ErrorClassRateLimit ErrorClass = "rate_limit"
+	ErrorClassNetwork   ErrorClass = "network"
+	ErrorClassServer    ErrorClass = "server"
+	ErrorClassAuth      ErrorClass = "auth"
+	ErrorClassParse     ErrorClass = "parse"
+	ErrorClassOther     ErrorClass = "other"
+)
+
+// ClassifiedError is an error which class is already known, e.g. an error reported by a remote worker.
+type ClassifiedError struct {
+	Class   ErrorClass
+	Message string
+}
+
+func (e *ClassifiedError) Error() string {
+	return e.Message
+}
+
+// ClassifyError finds out the class of the error returned by a task.
+func ClassifyError(err error) ErrorClass {
+	var classifiedErr *ClassifiedError
+	if errors.As(err, &classifiedErr) {
+		return classifiedErr.Class
+	}
+	if errors.Is(err, twitter_api.ErrLimitReached) {
+		return ErrorClassRateLimit
+	}
+	// sessions rejected by twitter are quarantined, the task waits for accounts to come back
+	if errors.Is(err, twitter_api.ErrBadAuth) || errors.Is(err, twitter_api.ErrAccountLocked) {
+		return ErrorClassAuth
+	}
+	var statusErr *twitter_api.StatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.StatusCode >= 500 {
+			return ErrorClassServer
+		}
+		return ErrorClassOther
+	}
+	var apiErr *twitter_api.ApiError
+	if errors.As(err, &apiErr) {
+		if apiErr.StatusCode >= 500 {
+			return ErrorClassServer
+		}
+		return ErrorClassOther
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return ErrorClassParse
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrorClassNetwork
+	}
+	return ErrorClassOther
+}
+
+// userCrawlStatus returns the terminal crawl status of the user the api error is about, e.g. the user
+// has been suspended. Such errors aren't retried, the user isn't queued again.
+func userCrawlStatus(err error) (models.CrawlStatus, bool) {
+	switch {
+	case errors.Is(err, twitter_api.ErrPrivateProfile):
+		return models.CrawlStatusProtected, true
+	case errors.Is(err, twitter_api.ErrUserNotFound):
+		return models.CrawlStatusNotFound, true
+	case errors.Is(err, twitter_api.ErrUserSuspended):
+		return models.CrawlStatusSuspended, true
+	}
+	return "", false
+}
@@ -0,0 +1,119 @@
+package crawler_tasks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+	"strconv"
+)
+
+// HydrateUsersTask downloads profiles of users known only by id, e.g. followers saved by DownloadFollowerIdsTask.
+// UserIds should contain at most twitter_api.UsersLookupSize ids.
+type HydrateUsersTask struct {
+	UserIds []int64
+
+	*log.Logger `json:"-"`
+	// api is created from config if it's not set
+	api twitter_api.TwitterAPI
+}
+
+func (task *HydrateUsersTask) TaskType() string {
+	return models.TaskTypeHydrateUsers
+}
+
+// TaskKey is the first id of the batch, batches are made of ids in ascending order so they don't overlap.
+func (task *HydrateUsersTask) TaskKey() string {
+	if len(task.UserIds) == 0 {
+		return ""
+	}
+	return strconv.FormatInt(task.UserIds[0], 10)
+}
+
+func (task *HydrateUsersTask) Exec(ctx context.Context, stor storage.Storage) error {
+	task.Logger = log.NewLogger(fmt.Sprintf("HydrateUsersTask '%s'", task.TaskKey()))
+	if task.api == nil {
+		api, err := twitterApi()
+		if err != nil {
+			return errors.Wrap(err, "can't create twitter api client")
+		}
+		task.api = api
+	}
+
+	users, err := task.api.UsersLookup(ctx, task.UserIds)
+	if errors.Is(err, twitter_api.ErrUserNotFound) {
+		users, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		initCrawlState(user)
+	}
+	err = stor.AddNewUsers(ctx, users)
+	if err != nil {
+		return err
+	}
+	err = task.saveNotFoundUsers(ctx, stor, users)
+	if err != nil {
+		return errors.Wrap(err, "save users not found")
+	}
+	task.LogInfo("downloaded %d of %d users", len(users), len(task.UserIds))
+	return nil
+}
+
+// saveNotFoundUsers saves users of the batch which twitter didn't return, e.g. deleted or suspended ones,
+// with not_found status, so they aren't unknown users anymore and aren't looked up again. Saved users,
+// e.g. backfilled ones, keep their profiles.
+func (task *HydrateUsersTask) saveNotFoundUsers(ctx context.Context, stor storage.Storage, users []*models.User) error {
+	found := make(map[int64]bool, len(users))
+	for _, user := range users {
+		found[user.Id] = true
+	}
+	notFound := make([]*models.User, 0)
+	for _, userId := range task.UserIds {
+		if found[userId] {
+			continue
+		}
+		found[userId] = true
+		_, err := stor.GetUserById(ctx, userId)
+		if err == nil {
+			continue
+		}
+		if errors.Cause(err) != sql.ErrNoRows {
+			return err
+		}
+		user := &models.User{
+			Id:    userId,
+			IdStr: strconv.FormatInt(userId, 10),
+		}
+		initCrawlState(user)
+		user.CrawlStatus = models.CrawlStatusNotFound
+		user.FriendsCrawlStatus = models.CrawlStatusNotFound
+		notFound = append(notFound, user)
+	}
+	if len(notFound) == 0 {
+		return nil
+	}
+	err := stor.AddNewUsers(ctx, notFound)
+	if err != nil {
+		return err
+	}
+	// new users are saved as pending, so the state is set separately
+	for _, user := range notFound {
+		err = stor.UpdateUserState(ctx, user)
+		if err != nil {
+			return err
+		}
+		err = stor.UpdateUserFriendsState(ctx, user)
+		if err != nil {
+			return err
+		}
+	}
+	task.LogInfo("%d of %d users don't exist anymore", len(notFound), len(task.UserIds))
+	return nil
+}
@@ -0,0 +1,152 @@
+package crawler_tasks
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+	"time"
+)
+
+const searchDateLayout = "2006-01-02"
+
+// SearchTweetsTask downloads tweets matching Query posted from Since till Until. Twitter finds a limited number
+// of tweets by a query, so the range is searched by slices of SliceDays days from the newest one. Authors of
+// found tweets are saved as seeds for downloading followers. The progress is saved after every page.
+type SearchTweetsTask struct {
+	Query string
+	Since time.Time
+	// Until is zero for the search till the day the search is started on, the day is kept in the search state,
+	// so the search started before a restart of the crawler is continued rather than started over.
+	Until time.Time
+	// SliceDays is the length of date slices, 1 if it's not set
+	SliceDays int
+
+	*log.Logger `json:"-"`
+	// api is created from config if it's not set
+	api twitter_api.TwitterAPI
+}
+
+func (task *SearchTweetsTask) TaskType() string {
+	return models.TaskTypeSearchTweets
+}
+
+func (task *SearchTweetsTask) TaskKey() string {
+	if task.Until.IsZero() {
+		return fmt.Sprintf("%s since:%s", task.Query, task.Since.Format(searchDateLayout))
+	}
+	return fmt.Sprintf("%s since:%s until:%s", task.Query, task.Since.Format(searchDateLayout), task.Until.Format(searchDateLayout))
+}
+
+func (task *SearchTweetsTask) Exec(ctx context.Context, stor storage.Storage) error {
+	task.Logger = log.NewLogger(fmt.Sprintf("SearchTweetsTask '%s'", task.TaskKey()))
+	if task.api == nil {
+		api, err := twitterApi()
+		if err != nil {
+			return errors.Wrap(err, "can't create twitter api client")
+		}
+		task.api = api
+	}
+	sliceDays := task.SliceDays
+	if sliceDays <= 0 {
+		sliceDays = 1
+	}
+
+	state, err := stor.GetSearchState(ctx, task.TaskKey())
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		until := task.Until
+		if until.IsZero() {
+			// tweets of today are found too
+			until = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+		}
+		if !task.Since.Before(until) {
+			return fmt.Errorf("bad date range of search, since %s isn't before until %s", task.Since, until)
+		}
+		state = &models.SearchState{Key: task.TaskKey(), SliceUntil: until}
+	}
+	if state.Done {
+		task.LogInfo("Exit cause search is done")
+		return nil
+	}
+
+	found := 0
+	for state.SliceUntil.After(task.Since) {
+		sliceSince := state.SliceUntil.AddDate(0, 0, -sliceDays)
+		if sliceSince.Before(task.Since) {
+			sliceSince = task.Since
+		}
+		query := fmt.Sprintf("%s since:%s until:%s", task.Query, sliceSince.Format(searchDateLayout), state.SliceUntil.Format(searchDateLayout))
+		for {
+			if ShuttingDown(ctx) {
+				err = stor.UpdateSearchState(ctx, state)
+				if err != nil {
+					return err
+				}
+				task.LogInfo("Stopped by shutdown, slice until %s, next cursor = %s", state.SliceUntil.Format(searchDateLayout), state.Cursor)
+				return ErrInterrupted
+			}
+			timeline, err := task.api.SearchTimeline(ctx, query, state.Cursor)
+			if err != nil {
+				return err
+			}
+			err = task.save(ctx, stor, timeline)
+			if err != nil {
+				return err
+			}
+			found += len(timeline.GlobalObjects.Tweets)
+
+			cursor := timeline.BottomCursor()
+			if len(timeline.GlobalObjects.Tweets) == 0 || cursor == "" || cursor == state.Cursor {
+				break
+			}
+			state.Cursor = cursor
+			err = stor.UpdateSearchState(ctx, state)
+			if err != nil {
+				return err
+			}
+		}
+		state.SliceUntil = sliceSince
+		state.Cursor = ""
+		err = stor.UpdateSearchState(ctx, state)
+		if err != nil {
+			return err
+		}
+		task.LogInfo("searched '%s', found %d tweets", query, found)
+	}
+
+	state.Done = true
+	err = stor.UpdateSearchState(ctx, state)
+	if err != nil {
+		return err
+	}
+	task.LogInfo("Search successfully done, %d tweets found.", found)
+	return nil
+}
+
+// save saves tweets of the page and their authors, new authors become seeds of the crawl.
+func (task *SearchTweetsTask) save(ctx context.Context, stor storage.Storage, timeline *twitter_api.Timeline) error {
+	tweets := make([]*models.Tweet, 0, len(timeline.GlobalObjects.Tweets))
+	for _, tweet := range timeline.GlobalObjects.Tweets {
+		tweets = append(tweets, tweet)
+	}
+	err := stor.AddNewTweets(ctx, tweets)
+	if err != nil {
+		return err
+	}
+	err = stor.AddNewInteractions(ctx, models.ExtractInteractions(tweets, timeline.GlobalObjects.Tweets))
+	if err != nil {
+		return err
+	}
+	users := make([]*models.User, 0, len(timeline.GlobalObjects.Users))
+	for _, user := range timeline.GlobalObjects.Users {
+		initCrawlState(user)
+		users = append(users, user)
+	}
+	return stor.AddNewUsers(ctx, users)
+}
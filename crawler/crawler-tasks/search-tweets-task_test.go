@@ -0,0 +1,119 @@
+package crawler_tasks
+
+import (
+	"context"
+	fake_twitter "github.com/scarecrow6977/twitter-crawler/crawler/fake-twitter"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// postTopicTweets posts tweets about golang by users of the graph, perDay tweets a day by different users.
+func postTopicTweets(graph *fake_twitter.Graph, since time.Time, days, perDay int) []*models.Tweet {
+	var posted []*models.Tweet
+	users := graph.Users()
+	for day := 0; day < days; day++ {
+		for i := 0; i < perDay; i++ {
+			user := users[day*perDay+i]
+			createdAt := since.AddDate(0, 0, day).Add(time.Duration(i) * time.Minute)
+			posted = append(posted, graph.PostTweet(user.Id, "Learning #Golang today", createdAt))
+		}
+	}
+	return posted
+}
+
+func TestSearchTweetsTask_Exec(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{SearchLimit: 150})
+	defer httpServer.Close()
+	since := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	posted := postTopicTweets(graph, since, 3, 120)
+
+	stor := newFollowersStorage()
+	task := &SearchTweetsTask{Query: "#golang", Since: since, Until: since.AddDate(0, 0, 3), api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, idsOf(posted), idsOf(tweetsOf(stor)))
+	for _, tweet := range posted {
+		author := stor.users[tweet.UserId]
+		if assert.NotNil(t, author) {
+			assert.Equal(t, models.CrawlStatusPending, author.CrawlStatus)
+			assert.Equal(t, "-1", author.NextCursorStr)
+		}
+	}
+	state := stor.searches[task.TaskKey()]
+	assert.True(t, state.Done)
+	assert.Equal(t, since, state.SliceUntil)
+	// a slice a day, each one of 2 pages of 100 tweets and the last empty one
+	assert.Equal(t, 9, server.Requests("/2/search/adaptive.json"))
+}
+
+func TestSearchTweetsTask_ResultsLimit(t *testing.T) {
+	graph, _, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{SearchLimit: 150})
+	defer httpServer.Close()
+	since := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	postTopicTweets(graph, since, 3, 120)
+
+	stor := newFollowersStorage()
+	task := &SearchTweetsTask{Query: "#golang", Since: since, Until: since.AddDate(0, 0, 3), SliceDays: 3, api: api}
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	// the whole range in one slice hits the limit of results
+	assert.Len(t, tweetsOf(stor), 150)
+}
+
+func TestSearchTweetsTask_Resume(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	since := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	posted := postTopicTweets(graph, since, 3, 120)
+
+	stor := newFollowersStorage()
+	task := &SearchTweetsTask{Query: "#golang", Since: since, Until: since.AddDate(0, 0, 3), api: api}
+	// the last day has been searched and the first page of the second one has been downloaded
+	assert.NoError(t, stor.UpdateSearchState(context.Background(), &models.SearchState{
+		Key:        task.TaskKey(),
+		Cursor:     "1600000000000000100",
+		SliceUntil: since.AddDate(0, 0, 2),
+	}))
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, idsOf(append(posted[:120], posted[120:140]...)), idsOf(tweetsOf(stor)))
+	assert.True(t, stor.searches[task.TaskKey()].Done)
+	assert.Equal(t, 5, server.Requests("/2/search/adaptive.json"))
+
+	// the done search isn't repeated
+	assert.NoError(t, task.Exec(context.Background(), stor))
+	assert.Equal(t, 5, server.Requests("/2/search/adaptive.json"))
+}
+
+func TestSearchTweetsTask_ResumeOpenEnded(t *testing.T) {
+	graph, server, httpServer, api := newFakeTwitter(t, fake_twitter.ServerOptions{})
+	defer httpServer.Close()
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -2)
+	posted := postTopicTweets(graph, since, 2, 20)
+
+	stor := newFollowersStorage()
+	task := &SearchTweetsTask{Query: "#golang", Since: since, api: api}
+	// the key doesn't depend on the day the search is started on
+	assert.Equal(t, "#golang since:"+since.Format("2006-01-02"), task.TaskKey())
+	// the search started a day ago has searched its first slice
+	assert.NoError(t, stor.UpdateSearchState(context.Background(), &models.SearchState{
+		Key:        task.TaskKey(),
+		SliceUntil: since.AddDate(0, 0, 1),
+	}))
+	assert.NoError(t, task.Exec(context.Background(), stor))
+
+	assert.Equal(t, idsOf(posted[:20]), idsOf(tweetsOf(stor)))
+	assert.True(t, stor.searches[task.TaskKey()].Done)
+	// only the slice of the first day is searched, a page of tweets and the empty one
+	assert.Equal(t, 2, server.Requests("/2/search/adaptive.json"))
+}
+
+func tweetsOf(stor *followersStorage) []*models.Tweet {
+	tweets := make([]*models.Tweet, 0, len(stor.tweets))
+	for _, tweet := range stor.tweets {
+		tweets = append(tweets, tweet)
+	}
+	return tweets
+}
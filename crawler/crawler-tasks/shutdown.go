@@ -0,0 +1,34 @@
+package crawler_tasks
+
+import (
+	"context"
+	"github.com/pkg/errors"
+)
+
+var ErrInterrupted = errors.New("task interrupted by shutdown")
+
+type shutdownKey struct{}
+
+// WithShutdown returns a copy of ctx carrying a channel which is closed when the task should stop
+// at the next safe point, i.e. after the page being downloaded is saved. Cancelling ctx itself
+// aborts the task immediately.
+func WithShutdown(ctx context.Context, shutdownCh <-chan struct{}) context.Context {
+	return context.WithValue(ctx, shutdownKey{}, shutdownCh)
+}
+
+// ShuttingDown reports whether the task running with ctx was asked to stop.
+func ShuttingDown(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	shutdownCh, ok := ctx.Value(shutdownKey{}).(<-chan struct{})
+	if !ok {
+		return false
+	}
+	select {
+	case <-shutdownCh:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,35 +1,88 @@
 package crawler_tasks
 
-import "net/http"
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	http_client "github.com/scarecrow6977/twitter-crawler/crawler/http-client"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+	"sync"
+	"time"
+)
 
-var requiredCookies = []string{
-	"ct0",
+// sharedClient is used by all tasks of the process, so accounts, their rate limits and proxies are shared by workers.
+var sharedClient struct {
+	once sync.Once
+	api  twitter_api.TwitterAPI
+	err  error
 }
 
-var requiredHeaders = []string{
-	"authorization",
+// twitterApi returns the api client created from config on first use.
+func twitterApi() (twitter_api.TwitterAPI, error) {
+	sharedClient.once.Do(func() {
+		config, err := conf.LoadConfig()
+		if err != nil {
+			sharedClient.err = errors.Wrap(err, "can't load config")
+			return
+		}
+		accounts, err := http_client.NewTwitterAccounts(config)
+		if err != nil {
+			sharedClient.err = err
+			return
+		}
+		proxies, err := http_client.NewProxyPoolFromConfig(config.ProxyPool)
+		if err != nil {
+			sharedClient.err = errors.Wrap(err, "can't create proxy pool")
+			return
+		}
+		if proxies != nil {
+			interval := time.Duration(config.ProxyPool.HealthCheckInterval) * time.Second
+			go proxies.RunHealthChecks(context.Background(), interval)
+		}
+		quarantine := http_client.DefaultQuarantineDuration
+		if config.AccountQuarantine > 0 {
+			quarantine = time.Duration(config.AccountQuarantine) * time.Second
+		}
+		httpClient := http_client.NewHttpClient(accounts, proxies, quarantine)
+		sharedClient.api = twitter_api.NewClient(config.TwitterApiUrl, httpClient)
+	})
+	return sharedClient.api, sharedClient.err
 }
 
-func setCookiesForRequest(req *http.Request, cookies map[string]string) {
-	for name, value := range cookies {
-		req.AddCookie(&http.Cookie{Name: name, Value: value})
+// loadUser returns the user from storage, requesting and saving it if it isn't there yet. Nil is returned
+// if twitter has got no crawlable user with the screen name, e.g. it has been suspended.
+func loadUser(ctx context.Context, stor storage.Storage, api twitter_api.TwitterAPI, screenName string, logger *log.Logger) (*models.User, error) {
+	user, err := stor.GetUserByScreenName(ctx, screenName)
+	if err == nil {
+		logger.LogInfo("User '%s' found in db, next cursor = %s", screenName, user.NextCursorStr)
+		return user, nil
 	}
-}
-
-func checkRequiredCookiesExists(cookies map[string]string) bool {
-	for _, reqName := range requiredCookies {
-		if _, ok := cookies[reqName]; !ok {
-			return false
-		}
+	logger.LogInfo("User '%s' not found in db, requesting...", screenName)
+	user, err = api.ShowUser(ctx, screenName)
+	if status, ok := userCrawlStatus(err); ok {
+		logger.LogInfo("User '%s' is %s", screenName, status)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
-	return true
+	initCrawlState(user)
+	err = stor.AddNewUsers(ctx, []*models.User{user})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
-func checkRequiredHeadersExists(headers map[string]string) bool {
-	for _, reqName := range requiredHeaders {
-		if _, ok := headers[reqName]; !ok {
-			return false
-		}
-	}
-	return true
+// initCrawlState makes a new user a seed, followers and friends of the user are downloaded from the first page.
+func initCrawlState(user *models.User) {
+	user.NextCursor = -1
+	user.NextCursorStr = "-1"
+	user.CrawlStatus = models.CrawlStatusPending
+	user.FriendsNextCursor = -1
+	user.FriendsNextCursorStr = "-1"
+	user.FriendsCrawlStatus = models.CrawlStatusPending
 }
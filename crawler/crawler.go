@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
 	"github.com/scarecrow6977/twitter-crawler/crawler/crawler"
 	"github.com/scarecrow6977/twitter-crawler/crawler/log"
-	"github.com/scarecrow6977/twitter-crawler/crawler/storage/pg-storage"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage/backend"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+const defaultShutdownTimeout = 30 * time.Second
+const defaultTaskLeaseTimeout = 10 * time.Minute
+
 func main() {
 	var configPath string
+	var seedListId int64
 	flag.StringVar(&configPath, "config", "config.yaml", "path to the config file")
+	flag.Int64Var(&seedListId, "seed-list", 0, "id of a twitter list, members of the list are downloaded first and become seeds of the crawl")
 	flag.Parse()
 
 	conf.Init(configPath)
@@ -22,12 +33,99 @@ func main() {
 	}
 	log.SetVerbosityLevel(2)
 
-	pgStorage, err := pg_storage.NewPgStorage(config.PostgresAccess)
+	if config.MasterListen != "" {
+		if config.MasterToken == "" {
+			log.LogError("master_token must be set to serve remote workers")
+			return
+		}
+		// tasks of the memory queue claimed by a remote worker which died would never be given to another one
+		if config.TaskQueue != crawler.TaskQueueStorage && config.TaskQueue != crawler.TaskQueuePostgres {
+			log.LogError("remote workers need task_queue: %s, got '%s'", crawler.TaskQueueStorage, config.TaskQueue)
+			return
+		}
+	}
+	stor, err := backend.NewStorage(config)
+	if err != nil {
+		log.LogError("can't open storage, err='%v'", err)
+		return
+	}
+	defer stor.Close()
+	if seedListId != 0 {
+		config.TaskSources = withSeedList(config.TaskSources, seedListId)
+	}
+	sources, err := crawler.NewTaskSources(config.TaskSources, stor)
 	if err != nil {
-		log.LogError(fmt.Sprintf("can't load config, err='%v'", err))
+		log.LogError("can't create task sources, err='%v'", err)
 		return
 	}
-	m := crawler.NewCrawlerMaster(config.NumOfWorkers, config.QueueSize, config.QueueNoRefillLimit, pgStorage)
+	shutdownTimeout := defaultShutdownTimeout
+	if config.ShutdownTimeout > 0 {
+		shutdownTimeout = time.Duration(config.ShutdownTimeout) * time.Second
+	}
+	taskLeaseTimeout := defaultTaskLeaseTimeout
+	if config.TaskLeaseTimeout > 0 {
+		taskLeaseTimeout = time.Duration(config.TaskLeaseTimeout) * time.Second
+	}
+	retryPolicies, err := crawler.NewRetryPolicies(config.RetryPolicies, config.ApiLimitTimeout)
+	if err != nil {
+		log.LogError("can't create retry policies, err='%v'", err)
+		return
+	}
+	queue, err := crawler.NewTaskQueue(config.TaskQueue, stor, taskLeaseTimeout, retryPolicies)
+	if err != nil {
+		log.LogError("can't create task queue, err='%v'", err)
+		return
+	}
+	m := crawler.NewCrawlerMaster(config.NumOfWorkers, config.QueueSize, config.QueueNoRefillLimit, shutdownTimeout, stor, queue, sources)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signalCh
+		log.LogInfo("%v received, shutting down (send it again to exit immediately)", sig)
+		cancel()
+		<-signalCh
+		os.Exit(1)
+	}()
 
-	m.Run()
+	if config.MasterListen != "" {
+		server := &http.Server{
+			Addr:    config.MasterListen,
+			Handler: crawler.NewMasterService(queue, stor, config.MasterToken),
+		}
+		go func() {
+			log.LogInfo("Waiting for remote workers on %s", config.MasterListen)
+			err := server.ListenAndServe()
+			if err != http.ErrServerClosed {
+				log.LogError("master service stopped, err='%v'", err)
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancelShutdown()
+			server.Shutdown(shutdownCtx)
+		}()
+	}
+
+	err = m.Run(ctx)
+	if err != nil {
+		log.LogError("crawler master stopped with error, err='%v'", err)
+	}
+}
+
+// withSeedList adds the lists source for the list with priority over configured sources.
+func withSeedList(configs []conf.TaskSourceConfig, listId int64) []conf.TaskSourceConfig {
+	if len(configs) == 0 {
+		configs = []conf.TaskSourceConfig{{Type: crawler.TaskSourceFollowers}}
+	}
+	priority := 0
+	for _, c := range configs {
+		if c.Priority >= priority {
+			priority = c.Priority + 1
+		}
+	}
+	seed := conf.TaskSourceConfig{Type: crawler.TaskSourceLists, ListIds: []int64{listId}, Priority: priority}
+	return append([]conf.TaskSourceConfig{seed}, configs...)
 }
@@ -0,0 +1,165 @@
+package crawler
+
+import (
+	"context"
+	"crypto/subtle"
+	"github.com/pkg/errors"
+	crawler_tasks "github.com/scarecrow6977/twitter-crawler/crawler/crawler-tasks"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	remote_storage "github.com/scarecrow6977/twitter-crawler/crawler/storage/remote-storage"
+	"net/http"
+	"time"
+)
+
+const (
+	claimTaskPath    = "/tasks/claim"
+	extendLeasePath  = "/tasks/heartbeat"
+	completeTaskPath = "/tasks/complete"
+	failTaskPath     = "/tasks/fail"
+	releaseTaskPath  = "/tasks/release"
+	pushTasksPath    = "/tasks/push"
+	queueLenPath     = "/tasks/len"
+)
+
+type claimTaskArgs struct {
+	Owner string `json:"owner"`
+}
+
+type claimTaskResult struct {
+	Task          *models.CrawlTask `json:"task"`
+	LeaseDuration time.Duration     `json:"lease_duration"`
+}
+
+type taskArgs struct {
+	Id         int64  `json:"id"`
+	Owner      string `json:"owner"`
+	Attempts   int    `json:"attempts,omitempty"`
+	Error      string `json:"error,omitempty"`
+	ErrorClass string `json:"error_class,omitempty"`
+}
+
+type pushTasksArgs struct {
+	Priority int                 `json:"priority"`
+	Tasks    []*models.CrawlTask `json:"tasks"`
+}
+
+// MasterService lets remote workers claim tasks from the master's queue and report their results.
+// Remote workers read and write data through the master's storage, which is served at
+// remote_storage.StoragePathPrefix, so the master is the only process writing to the storage.
+// Every request must carry the token in remote_storage.TokenHeader.
+type MasterService struct {
+	queue TaskQueue
+	token string
+	mux   *http.ServeMux
+	*log.Logger
+}
+
+func NewMasterService(queue TaskQueue, stor storage.Storage, token string) *MasterService {
+	s := &MasterService{
+		queue: queue,
+		token: token,
+		mux:   http.NewServeMux(),
+	}
+	s.Logger = log.NewLogger("MasterService")
+
+	s.mux.Handle(remote_storage.StoragePathPrefix, remote_storage.NewStorageHandler(stor))
+	s.mux.HandleFunc(claimTaskPath, s.handleClaim)
+	s.mux.HandleFunc(extendLeasePath, s.handleTask(queue.ExtendLease))
+	s.mux.HandleFunc(completeTaskPath, s.handleTask(queue.Complete))
+	s.mux.HandleFunc(releaseTaskPath, s.handleTask(queue.Release))
+	s.mux.HandleFunc(failTaskPath, s.handleFail)
+	s.mux.HandleFunc(pushTasksPath, s.handlePush)
+	s.mux.HandleFunc(queueLenPath, s.handleLen)
+	return s
+}
+
+func (s *MasterService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get(remote_storage.TokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		s.LogWarning("request to %s from %s with wrong token", r.URL.Path, r.RemoteAddr)
+		remote_storage.WriteUnauthorized(w)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *MasterService) handleClaim(w http.ResponseWriter, r *http.Request) {
+	args := &claimTaskArgs{}
+	err := remote_storage.ReadArgs(r, args)
+	if err != nil {
+		remote_storage.WriteBadRequest(w, err)
+		return
+	}
+	queued, err := s.queue.Claim(r.Context(), args.Owner)
+	if err != nil || queued == nil {
+		remote_storage.WriteResult(w, &claimTaskResult{}, err)
+		return
+	}
+	record, err := encodeTask(queued.Task, 0)
+	if err != nil {
+		err = errors.Wrapf(err, "task %d can't be sent to remote worker", queued.Id)
+		failErr := s.queue.Fail(r.Context(), queued, err)
+		if failErr != nil {
+			s.LogError("can't fail task %d, err='%v'", queued.Id, failErr)
+		}
+		remote_storage.WriteResult(w, nil, err)
+		return
+	}
+	record.Id = queued.Id
+	record.Attempts = queued.Attempts
+	s.LogInfo("task %d (%s '%s') is given to %s", record.Id, record.Type, record.Key, args.Owner)
+	remote_storage.WriteResult(w, &claimTaskResult{Task: record, LeaseDuration: s.queue.LeaseDuration()}, nil)
+}
+
+func (s *MasterService) handleTask(action func(ctx context.Context, task *QueuedTask) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		args := &taskArgs{}
+		err := remote_storage.ReadArgs(r, args)
+		if err != nil {
+			remote_storage.WriteBadRequest(w, err)
+			return
+		}
+		err = action(r.Context(), &QueuedTask{Id: args.Id, Owner: args.Owner})
+		remote_storage.WriteResult(w, struct{}{}, err)
+	}
+}
+
+func (s *MasterService) handleFail(w http.ResponseWriter, r *http.Request) {
+	args := &taskArgs{}
+	err := remote_storage.ReadArgs(r, args)
+	if err != nil {
+		remote_storage.WriteBadRequest(w, err)
+		return
+	}
+	// the error is classified by the worker, since its type is lost on the way
+	taskErr := &crawler_tasks.ClassifiedError{Class: crawler_tasks.ErrorClass(args.ErrorClass), Message: args.Error}
+	err = s.queue.Fail(r.Context(), &QueuedTask{Id: args.Id, Owner: args.Owner, Attempts: args.Attempts}, taskErr)
+	remote_storage.WriteResult(w, struct{}{}, err)
+}
+
+func (s *MasterService) handlePush(w http.ResponseWriter, r *http.Request) {
+	args := &pushTasksArgs{}
+	err := remote_storage.ReadArgs(r, args)
+	if err != nil {
+		remote_storage.WriteBadRequest(w, err)
+		return
+	}
+	tasks := make([]CrawlerTask, 0, len(args.Tasks))
+	for _, record := range args.Tasks {
+		task, err := decodeTask(record)
+		if err != nil {
+			remote_storage.WriteBadRequest(w, err)
+			return
+		}
+		tasks = append(tasks, task)
+	}
+	pushed, err := s.queue.Push(r.Context(), args.Priority, tasks)
+	remote_storage.WriteResult(w, pushed, err)
+}
+
+func (s *MasterService) handleLen(w http.ResponseWriter, r *http.Request) {
+	queueLen, err := s.queue.Len(r.Context())
+	remote_storage.WriteResult(w, queueLen, err)
+}
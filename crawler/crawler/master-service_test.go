@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	remote_storage "github.com/scarecrow6977/twitter-crawler/crawler/storage/remote-storage"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testTaskTypeSaveUser = "test_save_user"
+
+const testMasterToken = "secret"
+
+func init() {
+	taskFactories[testTaskTypeSaveUser] = func() CrawlerTask { return &saveUserTask{} }
+}
+
+// saveUserTask stores a user unless it's stored already.
+type saveUserTask struct {
+	ScreenName string
+}
+
+func (t *saveUserTask) TaskType() string {
+	return testTaskTypeSaveUser
+}
+
+func (t *saveUserTask) TaskKey() string {
+	return t.ScreenName
+}
+
+func (t *saveUserTask) Exec(ctx context.Context, stor storage.Storage) error {
+	_, err := stor.GetUserByScreenName(ctx, t.ScreenName)
+	if err != sql.ErrNoRows {
+		return err
+	}
+	return stor.AddNewUsers(ctx, []*models.User{{ScreenName: t.ScreenName, CrawlStatus: models.CrawlStatusDone}})
+}
+
+// usersStorage keeps users in memory, other storage methods aren't used by the tests.
+type usersStorage struct {
+	storage.Storage
+	users map[string]*models.User
+	lock  sync.Mutex
+}
+
+func (s *usersStorage) AddNewUsers(ctx context.Context, users []*models.User) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, user := range users {
+		s.users[user.ScreenName] = user
+	}
+	return nil
+}
+
+func (s *usersStorage) GetUserByScreenName(ctx context.Context, screenName string) (*models.User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	user, ok := s.users[screenName]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (s *usersStorage) CompleteCrawlTask(ctx context.Context, id int64, owner string) error {
+	return storage.ErrLeaseLost
+}
+
+func (s *usersStorage) usersCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.users)
+}
+
+func TestMasterService_RemoteWorkers(t *testing.T) {
+	ctx := context.Background()
+	stor := &usersStorage{users: make(map[string]*models.User)}
+	queue := NewMemoryTaskQueue(nil)
+	screenNames := []string{"a", "b", "c", "d", "e"}
+	tasks := make([]CrawlerTask, 0, len(screenNames))
+	for _, screenName := range screenNames {
+		tasks = append(tasks, &saveUserTask{ScreenName: screenName})
+	}
+	_, err := queue.Push(ctx, 0, tasks)
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(NewMasterService(queue, stor, testMasterToken))
+	defer server.Close()
+
+	client := remote_storage.NewClient(server.URL, testMasterToken)
+	workers := NewCrawlerMaster(2, 0, 0, time.Second, remote_storage.NewRemoteStorage(client), NewRemoteTaskQueue(client), nil)
+	workers.claimInterval = 10 * time.Millisecond
+	runCtx, cancel := context.WithCancel(ctx)
+	runResult := make(chan error, 1)
+	go func() {
+		runResult <- workers.Run(runCtx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for stor.usersCount() < len(screenNames) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	assert.NoError(t, <-runResult)
+
+	assert.Equal(t, len(screenNames), stor.usersCount(), "all tasks should be done by remote workers")
+	for _, screenName := range screenNames {
+		assert.Equal(t, models.CrawlStatusDone, stor.users[screenName].CrawlStatus, "user state should be sent to master")
+	}
+	queueLen, err := queue.Len(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), queueLen)
+}
+
+func TestRemoteStorage_Errors(t *testing.T) {
+	stor := &usersStorage{users: make(map[string]*models.User)}
+	server := httptest.NewServer(NewMasterService(NewMemoryTaskQueue(nil), stor, testMasterToken))
+	defer server.Close()
+	remoteStorage := remote_storage.NewRemoteStorage(remote_storage.NewClient(server.URL, testMasterToken))
+
+	_, err := remoteStorage.GetUserByScreenName(context.Background(), "not_exists")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	err = remoteStorage.CompleteCrawlTask(context.Background(), 1, "someone")
+	assert.Equal(t, storage.ErrLeaseLost, err)
+}
+
+func TestMasterService_Token(t *testing.T) {
+	stor := &usersStorage{users: make(map[string]*models.User)}
+	server := httptest.NewServer(NewMasterService(NewMemoryTaskQueue(nil), stor, testMasterToken))
+	defer server.Close()
+
+	for _, token := range []string{"", "wrong"} {
+		client := remote_storage.NewClient(server.URL, token)
+		err := remote_storage.NewRemoteStorage(client).AddNewUsers(context.Background(), []*models.User{{ScreenName: "a"}})
+		assert.Error(t, err, "storage should not be written without the token")
+		_, err = NewRemoteTaskQueue(client).Claim(context.Background(), "worker")
+		assert.Error(t, err, "tasks should not be given without the token")
+	}
+	assert.Equal(t, 0, stor.usersCount())
+}
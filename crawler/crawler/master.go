@@ -1,38 +1,68 @@
 package crawler
 
 import (
+	"context"
+	"fmt"
 	"github.com/hako/durafmt"
 	"github.com/pkg/errors"
-	crawler_tasks "github.com/scarecrow6977/twitter-crawler/crawler/crawler-tasks"
 	"github.com/scarecrow6977/twitter-crawler/crawler/log"
 	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"os"
 	"sync"
 	"time"
 )
 
+const defaultClaimInterval = 5 * time.Second
+
 type CrawlerMaster struct {
-	workers   []*CrawlerWorker
-	taskQueue chan CrawlerTask
-	lock      sync.Mutex
+	workers []*CrawlerWorker
+	queue   TaskQueue
+	lock    sync.Mutex
 
 	stor         storage.Storage
+	sources      []*WeightedTaskSource
 	workerDoneCh chan int
 
 	queueSize          int
 	queueNoRefillLimit int
+	shutdownTimeout    time.Duration
+	// claimInterval is how long idle workers wait before checking the queue again.
+	claimInterval time.Duration
+	// ownerPrefix identifies this process among others sharing the task queue.
+	ownerPrefix string
+
+	// shutdownCh is closed when the master stops handing out tasks, running tasks are expected to
+	// save their current page and return.
+	shutdownCh chan struct{}
+	// execCtx is passed to running tasks, it is cancelled only when shutdownTimeout is exceeded.
+	execCtx    context.Context
+	cancelExec context.CancelFunc
 
 	*log.Logger
 }
 
-func NewCrawlerMaster(numOfWorkers int, queueSize int, queueNoRefillLimit int, stor storage.Storage) *CrawlerMaster {
+func NewCrawlerMaster(numOfWorkers int, queueSize int, queueNoRefillLimit int, shutdownTimeout time.Duration, stor storage.Storage, queue TaskQueue, sources []*WeightedTaskSource) *CrawlerMaster {
 	logger := log.NewLogger("CrawlerMaster")
 
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	execCtx, cancelExec := context.WithCancel(context.Background())
 	master := &CrawlerMaster{
-		taskQueue:          make(chan CrawlerTask, queueSize),
+		queue:              queue,
 		workerDoneCh:       make(chan int),
 		stor:               stor,
+		sources:            sources,
 		queueSize:          queueSize,
 		queueNoRefillLimit: queueNoRefillLimit,
+		shutdownTimeout:    shutdownTimeout,
+		claimInterval:      defaultClaimInterval,
+		ownerPrefix:        fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		shutdownCh:         make(chan struct{}),
+		execCtx:            execCtx,
+		cancelExec:         cancelExec,
 	}
 	master.Logger = logger
 	workers := make([]*CrawlerWorker, 0, numOfWorkers)
@@ -44,7 +74,9 @@ func NewCrawlerMaster(numOfWorkers int, queueSize int, queueNoRefillLimit int, s
 	return master
 }
 
-func (m *CrawlerMaster) Run() error {
+// Run starts workers and keeps the task queue filled until ctx is cancelled or all workers exit.
+// After ctx is cancelled, running tasks get shutdownTimeout to save their progress before being aborted.
+func (m *CrawlerMaster) Run(ctx context.Context) error {
 	m.LogInfo("Starting crawler master...")
 	for _, w := range m.workers {
 		go w.Run()
@@ -52,10 +84,14 @@ func (m *CrawlerMaster) Run() error {
 
 	startTime := time.Now()
 	workersDone := 0
+	var runErr error
 
 loop:
 	for {
 		select {
+		case <-ctx.Done():
+			m.LogInfo("Shutdown requested")
+			break loop
 		case _ = <-m.workerDoneCh:
 			workersDone++
 			if workersDone == len(m.workers) {
@@ -67,29 +103,89 @@ loop:
 			timePassed := durafmt.Parse(currentTime.Sub(startTime)).LimitFirstN(3).String()
 			m.LogInfo("Time passed: %s", timePassed)
 
-			if len(m.taskQueue) < m.queueNoRefillLimit {
-				newTasksAmount, err := m.refillTaskQueue()
+			if len(m.sources) == 0 {
+				// tasks are queued by another process, e.g. this is a remote worker
+				continue
+			}
+			queueLen, err := m.queue.Len(ctx)
+			if err != nil {
+				m.LogError("can't get task queue length, err='%v'", err)
+				continue
+			}
+			if queueLen < int64(m.queueNoRefillLimit) {
+				newTasksAmount, err := m.refillTaskQueue(ctx)
 				if err != nil {
-					return errors.Wrap(err, "get users with not downloaded followers")
+					runErr = errors.Wrap(err, "refill task queue")
+					break loop
 				}
 				m.LogInfo("%d new tasks received", newTasksAmount)
 			}
 		}
 	}
-	return nil
+	m.shutdown(len(m.workers) - workersDone)
+	return runErr
 }
 
-func (m *CrawlerMaster) refillTaskQueue() (int64, error) {
-	// Этот код не универсальный, заточен под единственный вид тасков, TODO: придумать как обобщить
+// shutdown stops workers and waits for the running ones to finish, aborting them after shutdownTimeout.
+func (m *CrawlerMaster) shutdown(runningWorkers int) {
+	close(m.shutdownCh)
+	if runningWorkers > 0 {
+		m.LogInfo("Waiting for %d workers to finish their current pages...", runningWorkers)
+	}
+	deadline := time.After(m.shutdownTimeout)
+	for runningWorkers > 0 {
+		select {
+		case _ = <-m.workerDoneCh:
+			runningWorkers--
+		case <-deadline:
+			m.LogWarning("Shutdown timeout exceeded, aborting %d running workers", runningWorkers)
+			m.cancelExec()
+		}
+	}
+	m.cancelExec()
+	m.LogInfo("Stopped")
+}
+
+// refillTaskQueue asks every task source for its weighted share of the free queue slots. A source giving
+// less than its share has nothing more at the moment, so what it left is shared among the other sources.
+func (m *CrawlerMaster) refillTaskQueue(ctx context.Context) (int64, error) {
 	newTasksAmount := int64(m.queueSize - m.queueNoRefillLimit)
-	users, err := m.stor.GetUsersWithNotDownloadedFollowers(newTasksAmount)
-	if err != nil {
-		return 0, err
+	sources := make([]*WeightedTaskSource, 0, len(m.sources))
+	for _, source := range m.sources {
+		if source.Weight > 0 {
+			sources = append(sources, source)
+		}
 	}
-	for _, user := range users {
-		m.taskQueue <- &crawler_tasks.DownloadFollowersTask{
-			ScreenName: user.ScreenName,
+
+	var received int64
+	for newTasksAmount > 0 && len(sources) > 0 {
+		weights := make([]int, 0, len(sources))
+		for _, source := range sources {
+			weights = append(weights, source.Weight)
+		}
+		quotas := splitByWeight(newTasksAmount, weights)
+
+		notExhausted := make([]*WeightedTaskSource, 0, len(sources))
+		for i, source := range sources {
+			if quotas[i] == 0 {
+				notExhausted = append(notExhausted, source)
+				continue
+			}
+			tasks, err := source.Source.NextTasks(ctx, quotas[i])
+			if err != nil {
+				return received, errors.Wrapf(err, "get tasks from source '%s'", source.Source.Name())
+			}
+			queued, err := m.queue.Push(ctx, source.Priority, tasks)
+			if err != nil {
+				return received, errors.Wrapf(err, "queue tasks from source '%s'", source.Source.Name())
+			}
+			received += queued
+			newTasksAmount -= int64(len(tasks))
+			if int64(len(tasks)) == quotas[i] {
+				notExhausted = append(notExhausted, source)
+			}
 		}
+		sources = notExhausted
 	}
-	return newTasksAmount, nil
+	return received, nil
 }
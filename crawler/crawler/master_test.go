@@ -0,0 +1,352 @@
+package crawler
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	crawler_tasks "github.com/scarecrow6977/twitter-crawler/crawler/crawler-tasks"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type fakeTask struct {
+	source string
+}
+
+func (t *fakeTask) Exec(ctx context.Context, stor storage.Storage) error {
+	return nil
+}
+
+// pagedTask downloads pages until it is told to stop, ignoreShutdown makes it wait for the abort instead.
+// wrapInterrupt makes it wrap ErrInterrupted like tasks adding context to their errors do.
+type pagedTask struct {
+	ignoreShutdown bool
+	wrapInterrupt  bool
+	started        chan struct{}
+	result         chan error
+}
+
+func (t *pagedTask) Exec(ctx context.Context, stor storage.Storage) error {
+	close(t.started)
+	for {
+		select {
+		case <-ctx.Done():
+			t.result <- ctx.Err()
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+		if !t.ignoreShutdown && crawler_tasks.ShuttingDown(ctx) {
+			t.result <- crawler_tasks.ErrInterrupted
+			if t.wrapInterrupt {
+				return errors.Wrap(crawler_tasks.ErrInterrupted, "download page")
+			}
+			return crawler_tasks.ErrInterrupted
+		}
+	}
+}
+
+type fakeTaskSource struct {
+	name      string
+	available int64
+}
+
+func (s *fakeTaskSource) Name() string {
+	return s.name
+}
+
+func (s *fakeTaskSource) NextTasks(ctx context.Context, n int64) ([]CrawlerTask, error) {
+	if n > s.available {
+		n = s.available
+	}
+	s.available -= n
+	tasks := make([]CrawlerTask, 0, n)
+	for i := int64(0); i < n; i++ {
+		tasks = append(tasks, &fakeTask{source: s.name})
+	}
+	return tasks, nil
+}
+
+func TestSplitByWeight(t *testing.T) {
+	cases := []struct {
+		total    int64
+		weights  []int
+		expected []int64
+	}{
+		{total: 80, weights: []int{3, 1}, expected: []int64{60, 20}},
+		{total: 10, weights: []int{1, 1, 1}, expected: []int64{4, 3, 3}},
+		{total: 7, weights: []int{1, 0, 2}, expected: []int64{2, 0, 5}},
+		{total: 5, weights: []int{}, expected: []int64{}},
+		{total: 0, weights: []int{1, 2}, expected: []int64{0, 0}},
+	}
+	for _, testCase := range cases {
+		parts := splitByWeight(testCase.total, testCase.weights)
+		assert.Equal(t, testCase.expected, parts, "wrong split of %d by %v", testCase.total, testCase.weights)
+	}
+}
+
+func TestCrawlerMaster_RefillTaskQueue(t *testing.T) {
+	followers := &fakeTaskSource{name: "followers", available: 1000}
+	tweets := &fakeTaskSource{name: "tweets", available: 5}
+	queue := NewMemoryTaskQueue(nil)
+	m := NewCrawlerMaster(0, 100, 20, time.Second, nil, queue, []*WeightedTaskSource{
+		{Source: followers, Weight: 3},
+		{Source: tweets, Weight: 1, Priority: 1},
+	})
+
+	received, err := m.refillTaskQueue(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(80), received, "share of the tweets source it didn't use should go to followers")
+	queueLen, err := queue.Len(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(80), queueLen)
+
+	sourcesOrder := make([]string, 0, received)
+	for {
+		queued, err := queue.Claim(context.Background(), "test")
+		assert.NoError(t, err)
+		if queued == nil {
+			break
+		}
+		source := queued.Task.(*fakeTask).source
+		if len(sourcesOrder) == 0 || sourcesOrder[len(sourcesOrder)-1] != source {
+			sourcesOrder = append(sourcesOrder, source)
+		}
+	}
+	assert.Equal(t, []string{"tweets", "followers"}, sourcesOrder, "tasks with higher priority should go first")
+	assert.Equal(t, int64(925), followers.available)
+	assert.Equal(t, int64(0), tweets.available)
+}
+
+func TestNewTaskSources_Weight(t *testing.T) {
+	zero, negative := 0, -1
+	sources, err := NewTaskSources([]conf.TaskSourceConfig{
+		{Type: TaskSourceTweets, Weight: &zero},
+		{Type: TaskSourceLists},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(sources), "source with weight 0 should be disabled")
+	assert.Equal(t, TaskSourceLists, sources[0].Source.Name())
+	assert.Equal(t, 1, sources[0].Weight, "weight should be 1 by default")
+
+	_, err = NewTaskSources([]conf.TaskSourceConfig{{Type: TaskSourceLists, Weight: &negative}}, nil)
+	assert.Error(t, err)
+}
+
+func TestScreenNamesTaskSource_NextTasks(t *testing.T) {
+	source := NewTweetsTaskSource([]string{"a", "b", "c"}, 0, time.Time{})
+
+	tasks, err := source.NextTasks(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(tasks))
+
+	tasks, err = source.NextTasks(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tasks))
+
+	tasks, err = source.NextTasks(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(tasks))
+}
+
+// unknownUsersStorage returns ids from a fixed list as unknown users.
+type unknownUsersStorage struct {
+	storage.Storage
+	userIds []int64
+}
+
+func (s *unknownUsersStorage) GetUnknownUserIds(ctx context.Context, afterId, n int64) ([]int64, error) {
+	userIds := make([]int64, 0)
+	for _, id := range s.userIds {
+		if id > afterId && int64(len(userIds)) < n {
+			userIds = append(userIds, id)
+		}
+	}
+	return userIds, nil
+}
+
+func TestHydrateTaskSource_NextTasks(t *testing.T) {
+	stor := &unknownUsersStorage{}
+	for id := int64(1); id <= 250; id++ {
+		stor.userIds = append(stor.userIds, id)
+	}
+	source := NewHydrateTaskSource(stor)
+
+	tasks, err := source.NextTasks(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(tasks))
+	assert.Equal(t, int64(101), tasks[1].(*crawler_tasks.HydrateUsersTask).UserIds[0])
+
+	tasks, err = source.NextTasks(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tasks))
+	assert.Equal(t, 50, len(tasks[0].(*crawler_tasks.HydrateUsersTask).UserIds))
+
+	tasks, err = source.NextTasks(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(tasks))
+
+	tasks, err = source.NextTasks(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", tasks[0].(*crawler_tasks.HydrateUsersTask).TaskKey(), "scan should start over")
+}
+
+// storageWithUsers returns the same users as users with not downloaded followers.
+type storageWithUsers struct {
+	storage.Storage
+	users []*models.User
+}
+
+func (s *storageWithUsers) GetUsersWithNotDownloadedFollowers(ctx context.Context, n int64) ([]*models.User, error) {
+	return s.users, nil
+}
+
+func (s *storageWithUsers) GetUsersWithNotDownloadedFriends(ctx context.Context, n int64) ([]*models.User, error) {
+	return s.users, nil
+}
+
+func TestNewTaskSources_FollowersMode(t *testing.T) {
+	stor := &storageWithUsers{users: []*models.User{{ScreenName: "jack"}}}
+	sources, err := NewTaskSources([]conf.TaskSourceConfig{
+		{Type: TaskSourceFollowers, Mode: FollowersModeEdges},
+		{Type: TaskSourceHydrate},
+	}, stor)
+	assert.NoError(t, err)
+	assert.Equal(t, TaskSourceHydrate, sources[1].Source.Name())
+	tasks, err := sources[0].Source.NextTasks(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, &crawler_tasks.DownloadFollowerIdsTask{ScreenName: "jack"}, tasks[0])
+
+	sources, err = NewTaskSources([]conf.TaskSourceConfig{{Type: TaskSourceFriends, Mode: FollowersModeEdges}}, stor)
+	assert.NoError(t, err)
+	tasks, err = sources[0].Source.NextTasks(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, &crawler_tasks.DownloadFriendsTask{ScreenName: "jack", IdsOnly: true}, tasks[0])
+
+	sources, err = NewTaskSources(nil, stor)
+	assert.NoError(t, err)
+	tasks, err = sources[0].Source.NextTasks(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, &crawler_tasks.DownloadFollowersTask{ScreenName: "jack"}, tasks[0], "profiles mode is the default")
+
+	_, err = NewTaskSources([]conf.TaskSourceConfig{{Type: TaskSourceFollowers, Mode: "unknown"}}, stor)
+	assert.Error(t, err)
+}
+
+func TestNewTaskSources_Search(t *testing.T) {
+	sources, err := NewTaskSources([]conf.TaskSourceConfig{
+		{Type: TaskSourceSearch, Queries: []string{"#golang"}, Since: "2021-03-01", Until: "2021-03-08", SliceDays: 2},
+	}, nil)
+	assert.NoError(t, err)
+	tasks, err := sources[0].Source.NextTasks(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []CrawlerTask{&crawler_tasks.SearchTweetsTask{
+		Query:     "#golang",
+		Since:     time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC),
+		Until:     time.Date(2021, 3, 8, 0, 0, 0, 0, time.UTC),
+		SliceDays: 2,
+	}}, tasks)
+
+	// the search without until is open-ended
+	sources, err = NewTaskSources([]conf.TaskSourceConfig{{Type: TaskSourceSearch, Queries: []string{"#golang"}, Since: "2021-03-01"}}, nil)
+	assert.NoError(t, err)
+	tasks, err = sources[0].Source.NextTasks(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.True(t, tasks[0].(*crawler_tasks.SearchTweetsTask).Until.IsZero())
+
+	_, err = NewTaskSources([]conf.TaskSourceConfig{{Type: TaskSourceSearch, Queries: []string{"#golang"}}}, nil)
+	assert.Error(t, err, "since is required")
+	_, err = NewTaskSources([]conf.TaskSourceConfig{{Type: TaskSourceSearch, Since: "2021-03-08", Until: "2021-03-01"}}, nil)
+	assert.Error(t, err)
+}
+
+func TestNewTaskSources_Lists(t *testing.T) {
+	sources, err := NewTaskSources([]conf.TaskSourceConfig{{Type: TaskSourceLists, ListIds: []int64{7, 8}, Subscribers: true}}, nil)
+	assert.NoError(t, err)
+	tasks, err := sources[0].Source.NextTasks(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []CrawlerTask{
+		&crawler_tasks.DownloadListTask{ListId: 7},
+		&crawler_tasks.DownloadListTask{ListId: 7, Subscribers: true},
+		&crawler_tasks.DownloadListTask{ListId: 8},
+		&crawler_tasks.DownloadListTask{ListId: 8, Subscribers: true},
+	}, tasks)
+}
+
+func runUntilTaskStarted(t *testing.T, task *pagedTask, shutdownTimeout time.Duration) (time.Duration, *MemoryTaskQueue) {
+	queue := NewMemoryTaskQueue(nil)
+	_, err := queue.Push(context.Background(), 0, []CrawlerTask{task})
+	assert.NoError(t, err)
+	m := NewCrawlerMaster(1, 10, 0, shutdownTimeout, nil, queue, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runResult := make(chan error, 1)
+	go func() {
+		runResult <- m.Run(ctx)
+	}()
+	<-task.started
+	shutdownStart := time.Now()
+	cancel()
+
+	select {
+	case err := <-runResult:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("master didn't stop")
+	}
+	assert.False(t, m.workers[0].IsAlive())
+	return time.Since(shutdownStart), queue
+}
+
+func TestCrawlerMaster_RunGracefulShutdown(t *testing.T) {
+	task := &pagedTask{started: make(chan struct{}), result: make(chan error, 1)}
+	stopTime, _ := runUntilTaskStarted(t, task, time.Minute)
+
+	assert.Equal(t, crawler_tasks.ErrInterrupted, <-task.result, "task should stop between pages")
+	assert.True(t, stopTime < time.Second, "graceful shutdown took %v", stopTime)
+}
+
+func TestCrawlerMaster_RunReleasesWrappedInterrupt(t *testing.T) {
+	task := &pagedTask{wrapInterrupt: true, started: make(chan struct{}), result: make(chan error, 1)}
+	_, queue := runUntilTaskStarted(t, task, time.Minute)
+
+	queueLen, err := queue.Len(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), queueLen, "interrupted task should be returned to the queue, not failed")
+}
+
+func TestCrawlerMaster_RunShutdownTimeout(t *testing.T) {
+	task := &pagedTask{ignoreShutdown: true, started: make(chan struct{}), result: make(chan error, 1)}
+	stopTime, _ := runUntilTaskStarted(t, task, 100*time.Millisecond)
+
+	assert.Equal(t, context.Canceled, <-task.result, "task should be aborted after shutdown timeout")
+	assert.True(t, stopTime >= 100*time.Millisecond, "task was aborted before shutdown timeout")
+}
+
+func TestEncodeDecodeTask(t *testing.T) {
+	task := &crawler_tasks.DownloadFollowersTask{ScreenName: "jack"}
+	record, err := encodeTask(task, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, models.TaskTypeDownloadFollowers, record.Type)
+	assert.Equal(t, "jack", record.Key)
+	assert.Equal(t, 2, record.Priority)
+
+	decoded, err := decodeTask(record)
+	assert.NoError(t, err)
+	assert.Equal(t, task, decoded)
+
+	hydrate := &crawler_tasks.HydrateUsersTask{UserIds: []int64{3, 5, 8}}
+	record, err = encodeTask(hydrate, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "3", record.Key)
+	decoded, err = decodeTask(record)
+	assert.NoError(t, err)
+	assert.Equal(t, hydrate, decoded)
+
+	_, err = encodeTask(&fakeTask{}, 0)
+	assert.Error(t, err, "tasks without type can't be queued")
+	_, err = decodeTask(&models.CrawlTask{Type: "unknown", Payload: "{}"})
+	assert.Error(t, err)
+}
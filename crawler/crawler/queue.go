@@ -0,0 +1,299 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	crawler_tasks "github.com/scarecrow6977/twitter-crawler/crawler/crawler-tasks"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	TaskQueueMemory = "memory"
+	// TaskQueueStorage keeps tasks in the storage set in config, TaskQueuePostgres is its old name.
+	TaskQueueStorage  = "storage"
+	TaskQueuePostgres = "postgres"
+)
+
+// QueuedTask is a task claimed by a worker, Owner identifies the worker holding its lease.
+type QueuedTask struct {
+	Id       int64
+	Owner    string
+	Attempts int
+	Task     CrawlerTask
+}
+
+// TaskQueue holds tasks waiting to be executed by workers.
+type TaskQueue interface {
+	// Push adds tasks to the queue, returning the amount of tasks which weren't queued already.
+	Push(ctx context.Context, priority int, tasks []CrawlerTask) (int64, error)
+	// Claim returns the next task for owner or nil if the queue is empty.
+	Claim(ctx context.Context, owner string) (*QueuedTask, error)
+	ExtendLease(ctx context.Context, task *QueuedTask) error
+	Complete(ctx context.Context, task *QueuedTask) error
+	Fail(ctx context.Context, task *QueuedTask, taskErr error) error
+	// Release returns the task to the queue without counting the attempt.
+	Release(ctx context.Context, task *QueuedTask) error
+	Len(ctx context.Context) (int64, error)
+	LeaseDuration() time.Duration
+}
+
+type memoryQueueItem struct {
+	// key identifies queueable tasks, it's empty for the others
+	key       string
+	priority  int
+	attempts  int
+	notBefore time.Time
+	task      CrawlerTask
+}
+
+// MemoryTaskQueue keeps tasks in process memory, they are lost on restart.
+// Failed tasks are retried according to retry policies and dropped when they are exhausted.
+// Like in the storage queue, a queueable task isn't queued again while the same work is queued or claimed.
+type MemoryTaskQueue struct {
+	items    []*memoryQueueItem
+	leased   map[int64]*memoryQueueItem
+	active   map[string]bool
+	lastId   int64
+	policies RetryPolicies
+	lock     sync.Mutex
+	*log.Logger
+}
+
+func NewMemoryTaskQueue(policies RetryPolicies) *MemoryTaskQueue {
+	q := &MemoryTaskQueue{
+		leased:   make(map[int64]*memoryQueueItem),
+		active:   make(map[string]bool),
+		policies: policies,
+	}
+	q.Logger = log.NewLogger("MemoryTaskQueue")
+	return q
+}
+
+func (q *MemoryTaskQueue) Push(ctx context.Context, priority int, tasks []CrawlerTask) (int64, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	var queued int64
+	for _, task := range tasks {
+		key := memoryTaskKey(task)
+		if key != "" {
+			if q.active[key] {
+				continue
+			}
+			q.active[key] = true
+		}
+		q.items = append(q.items, &memoryQueueItem{key: key, priority: priority, task: task})
+		queued++
+	}
+	q.sortItems()
+	return queued, nil
+}
+
+// memoryTaskKey returns the key of the work a queueable task does, or empty string for other tasks.
+func memoryTaskKey(task CrawlerTask) string {
+	queueable, ok := task.(QueueableTask)
+	if !ok {
+		return ""
+	}
+	return queueable.TaskType() + ":" + queueable.TaskKey()
+}
+
+func (q *MemoryTaskQueue) sortItems() {
+	sort.SliceStable(q.items, func(i, j int) bool {
+		return q.items[i].priority > q.items[j].priority
+	})
+}
+
+func (q *MemoryTaskQueue) Claim(ctx context.Context, owner string) (*QueuedTask, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	now := time.Now()
+	for i, item := range q.items {
+		if item.notBefore.After(now) {
+			continue
+		}
+		q.items = append(q.items[:i], q.items[i+1:]...)
+		q.lastId++
+		item.attempts++
+		q.leased[q.lastId] = item
+		return &QueuedTask{
+			Id:       q.lastId,
+			Owner:    owner,
+			Attempts: item.attempts,
+			Task:     item.task,
+		}, nil
+	}
+	return nil, nil
+}
+
+func (q *MemoryTaskQueue) ExtendLease(ctx context.Context, task *QueuedTask) error {
+	return nil
+}
+
+func (q *MemoryTaskQueue) Complete(ctx context.Context, task *QueuedTask) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	item, ok := q.leased[task.Id]
+	if !ok {
+		return nil
+	}
+	delete(q.leased, task.Id)
+	delete(q.active, item.key)
+	return nil
+}
+
+func (q *MemoryTaskQueue) Fail(ctx context.Context, task *QueuedTask, taskErr error) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	item, ok := q.leased[task.Id]
+	if !ok {
+		return nil
+	}
+	delete(q.leased, task.Id)
+	class, retryAt, retry := q.policies.Retry(item.attempts, taskErr)
+	if !retry {
+		q.LogError("task %d is dropped after %d attempts, last error (%s): %v", task.Id, item.attempts, class, taskErr)
+		delete(q.active, item.key)
+		return nil
+	}
+	item.notBefore = retryAt
+	q.items = append(q.items, item)
+	q.sortItems()
+	return nil
+}
+
+func (q *MemoryTaskQueue) Release(ctx context.Context, task *QueuedTask) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	item, ok := q.leased[task.Id]
+	if !ok {
+		return nil
+	}
+	delete(q.leased, task.Id)
+	item.attempts--
+	q.items = append(q.items, item)
+	q.sortItems()
+	return nil
+}
+
+func (q *MemoryTaskQueue) Len(ctx context.Context) (int64, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return int64(len(q.items)), nil
+}
+
+func (q *MemoryTaskQueue) LeaseDuration() time.Duration {
+	return 0
+}
+
+// StorageTaskQueue keeps tasks in storage, so they survive restarts and can be shared by several
+// crawler processes. A task is leased to one worker at a time, the lease must be extended while the
+// task is running, otherwise the task is given to another worker. Failed tasks are retried according
+// to retry policies, exhausted ones are moved to the dead-letter table.
+type StorageTaskQueue struct {
+	stor          storage.TaskQueueStorage
+	leaseDuration time.Duration
+	policies      RetryPolicies
+}
+
+func NewStorageTaskQueue(stor storage.TaskQueueStorage, leaseDuration time.Duration, policies RetryPolicies) *StorageTaskQueue {
+	return &StorageTaskQueue{
+		stor:          stor,
+		leaseDuration: leaseDuration,
+		policies:      policies,
+	}
+}
+
+func (q *StorageTaskQueue) Push(ctx context.Context, priority int, tasks []CrawlerTask) (int64, error) {
+	records := make([]*models.CrawlTask, 0, len(tasks))
+	for _, task := range tasks {
+		record, err := encodeTask(task, priority)
+		if err != nil {
+			return 0, err
+		}
+		records = append(records, record)
+	}
+	return q.stor.EnqueueCrawlTasks(ctx, records)
+}
+
+func (q *StorageTaskQueue) Claim(ctx context.Context, owner string) (*QueuedTask, error) {
+	var record *models.CrawlTask
+	for record == nil {
+		records, err := q.stor.ClaimCrawlTasks(ctx, owner, 1, q.leaseDuration)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+		record = records[0]
+		// every claim counts an attempt, so the task whose lease has expired is dead-lettered here,
+		// otherwise the task killing its workers would be claimed forever
+		if q.policies.LeaseExpired(record.Attempts, record.LastError != nil) {
+			err = q.stor.DeadLetterCrawlTask(ctx, record.Id, owner, string(crawler_tasks.ErrorClassOther), "lease expired")
+			if err != nil {
+				return nil, errors.Wrapf(err, "fail task %d with expired lease", record.Id)
+			}
+			record = nil
+		}
+	}
+	task, err := decodeTask(record)
+	if err != nil {
+		failErr := q.stor.DeadLetterCrawlTask(ctx, record.Id, owner, string(crawler_tasks.ErrorClassParse), err.Error())
+		if failErr != nil {
+			return nil, errors.Wrapf(failErr, "fail undecodable task %d", record.Id)
+		}
+		return nil, errors.Wrapf(err, "decode task %d", record.Id)
+	}
+	return &QueuedTask{
+		Id:       record.Id,
+		Owner:    owner,
+		Attempts: record.Attempts,
+		Task:     task,
+	}, nil
+}
+
+func (q *StorageTaskQueue) ExtendLease(ctx context.Context, task *QueuedTask) error {
+	return q.stor.ExtendCrawlTaskLease(ctx, task.Id, task.Owner, q.leaseDuration)
+}
+
+func (q *StorageTaskQueue) Complete(ctx context.Context, task *QueuedTask) error {
+	return q.stor.CompleteCrawlTask(ctx, task.Id, task.Owner)
+}
+
+func (q *StorageTaskQueue) Fail(ctx context.Context, task *QueuedTask, taskErr error) error {
+	class, retryAt, retry := q.policies.Retry(task.Attempts, taskErr)
+	if !retry {
+		return q.stor.DeadLetterCrawlTask(ctx, task.Id, task.Owner, string(class), taskErr.Error())
+	}
+	return q.stor.FailCrawlTask(ctx, task.Id, task.Owner, taskErr.Error(), retryAt)
+}
+
+func (q *StorageTaskQueue) Release(ctx context.Context, task *QueuedTask) error {
+	return q.stor.ReleaseCrawlTask(ctx, task.Id, task.Owner)
+}
+
+func (q *StorageTaskQueue) Len(ctx context.Context) (int64, error) {
+	return q.stor.CountPendingCrawlTasks(ctx)
+}
+
+func (q *StorageTaskQueue) LeaseDuration() time.Duration {
+	return q.leaseDuration
+}
+
+// NewTaskQueue creates a queue of the kind set in config, memory queue is used by default.
+func NewTaskQueue(kind string, stor storage.TaskQueueStorage, leaseDuration time.Duration, policies RetryPolicies) (TaskQueue, error) {
+	switch kind {
+	case "", TaskQueueMemory:
+		return NewMemoryTaskQueue(policies), nil
+	case TaskQueueStorage, TaskQueuePostgres:
+		return NewStorageTaskQueue(stor, leaseDuration, policies), nil
+	default:
+		return nil, fmt.Errorf("unknown task queue '%s'", kind)
+	}
+}
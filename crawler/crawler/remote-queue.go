@@ -0,0 +1,97 @@
+package crawler
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	crawler_tasks "github.com/scarecrow6977/twitter-crawler/crawler/crawler-tasks"
+	remote_storage "github.com/scarecrow6977/twitter-crawler/crawler/storage/remote-storage"
+	"sync/atomic"
+	"time"
+)
+
+// RemoteTaskQueue is the task queue of a master, used by remote workers through MasterService.
+type RemoteTaskQueue struct {
+	client *remote_storage.Client
+	// leaseDuration is reported by the master with every claimed task.
+	leaseDuration int64
+}
+
+func NewRemoteTaskQueue(client *remote_storage.Client) *RemoteTaskQueue {
+	return &RemoteTaskQueue{
+		client: client,
+	}
+}
+
+func (q *RemoteTaskQueue) Push(ctx context.Context, priority int, tasks []CrawlerTask) (int64, error) {
+	args := &pushTasksArgs{Priority: priority}
+	for _, task := range tasks {
+		record, err := encodeTask(task, priority)
+		if err != nil {
+			return 0, err
+		}
+		args.Tasks = append(args.Tasks, record)
+	}
+	var pushed int64
+	err := q.client.Call(ctx, pushTasksPath, args, &pushed)
+	return pushed, err
+}
+
+func (q *RemoteTaskQueue) Claim(ctx context.Context, owner string) (*QueuedTask, error) {
+	result := &claimTaskResult{}
+	err := q.client.Call(ctx, claimTaskPath, &claimTaskArgs{Owner: owner}, result)
+	if err != nil {
+		return nil, err
+	}
+	atomic.StoreInt64(&q.leaseDuration, int64(result.LeaseDuration))
+	if result.Task == nil {
+		return nil, nil
+	}
+	queued := &QueuedTask{
+		Id:       result.Task.Id,
+		Owner:    owner,
+		Attempts: result.Task.Attempts,
+	}
+	queued.Task, err = decodeTask(result.Task)
+	if err != nil {
+		err = errors.Wrapf(err, "decode task %d", queued.Id)
+		failErr := q.Fail(ctx, queued, err)
+		if failErr != nil {
+			return nil, errors.Wrapf(failErr, "fail undecodable task %d", queued.Id)
+		}
+		return nil, err
+	}
+	return queued, nil
+}
+
+func (q *RemoteTaskQueue) ExtendLease(ctx context.Context, task *QueuedTask) error {
+	return q.client.Call(ctx, extendLeasePath, &taskArgs{Id: task.Id, Owner: task.Owner}, nil)
+}
+
+func (q *RemoteTaskQueue) Complete(ctx context.Context, task *QueuedTask) error {
+	return q.client.Call(ctx, completeTaskPath, &taskArgs{Id: task.Id, Owner: task.Owner}, nil)
+}
+
+func (q *RemoteTaskQueue) Fail(ctx context.Context, task *QueuedTask, taskErr error) error {
+	args := &taskArgs{
+		Id:         task.Id,
+		Owner:      task.Owner,
+		Attempts:   task.Attempts,
+		Error:      taskErr.Error(),
+		ErrorClass: string(crawler_tasks.ClassifyError(taskErr)),
+	}
+	return q.client.Call(ctx, failTaskPath, args, nil)
+}
+
+func (q *RemoteTaskQueue) Release(ctx context.Context, task *QueuedTask) error {
+	return q.client.Call(ctx, releaseTaskPath, &taskArgs{Id: task.Id, Owner: task.Owner}, nil)
+}
+
+func (q *RemoteTaskQueue) Len(ctx context.Context) (int64, error) {
+	var queueLen int64
+	err := q.client.Call(ctx, queueLenPath, struct{}{}, &queueLen)
+	return queueLen, err
+}
+
+func (q *RemoteTaskQueue) LeaseDuration() time.Duration {
+	return time.Duration(atomic.LoadInt64(&q.leaseDuration))
+}
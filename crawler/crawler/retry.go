@@ -0,0 +1,113 @@
+package crawler
+
+import (
+	"fmt"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	crawler_tasks "github.com/scarecrow6977/twitter-crawler/crawler/crawler-tasks"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy sets how many times a failed task is tried and how long to wait before the next attempt.
+// The delay doubles with every attempt up to MaxDelay, Jitter is the fraction the delay is randomly changed by,
+// so tasks failed at the same time aren't retried at the same time.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+// Delay returns the time to wait before the next attempt after attempt failed, attempts are counted from 1.
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// RetryPolicies keeps a policy for every class of task errors, tasks aren't retried with nil policies.
+type RetryPolicies map[crawler_tasks.ErrorClass]*RetryPolicy
+
+// DefaultRetryPolicies returns policies used for error classes not set in config.
+func DefaultRetryPolicies() RetryPolicies {
+	return RetryPolicies{
+		crawler_tasks.ErrorClassRateLimit: {MaxAttempts: 10, BaseDelay: time.Minute, MaxDelay: 15 * time.Minute, Jitter: 0.2},
+		crawler_tasks.ErrorClassNetwork:   {MaxAttempts: 5, BaseDelay: 5 * time.Second, MaxDelay: 5 * time.Minute, Jitter: 0.2},
+		crawler_tasks.ErrorClassServer:    {MaxAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: 10 * time.Minute, Jitter: 0.2},
+		crawler_tasks.ErrorClassAuth:      {MaxAttempts: 5, BaseDelay: 30 * time.Minute, MaxDelay: 2 * time.Hour, Jitter: 0.2},
+		crawler_tasks.ErrorClassParse:     {MaxAttempts: 2, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute, Jitter: 0.2},
+		crawler_tasks.ErrorClassOther:     {MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: 30 * time.Minute, Jitter: 0.2},
+	}
+}
+
+// NewRetryPolicies overrides default policies with the ones set in config.
+// Api limit timeout, if set, is used as the base delay of rate limit errors.
+func NewRetryPolicies(configs map[string]conf.RetryPolicyConfig, apiLimitTimeout int) (RetryPolicies, error) {
+	policies := DefaultRetryPolicies()
+	if apiLimitTimeout > 0 {
+		policies[crawler_tasks.ErrorClassRateLimit].BaseDelay = time.Duration(apiLimitTimeout) * time.Second
+	}
+	for class, config := range configs {
+		policy, ok := policies[crawler_tasks.ErrorClass(class)]
+		if !ok {
+			return nil, fmt.Errorf("unknown error class '%s'", class)
+		}
+		if config.MaxAttempts > 0 {
+			policy.MaxAttempts = config.MaxAttempts
+		}
+		if config.BaseDelay > 0 {
+			policy.BaseDelay = time.Duration(config.BaseDelay) * time.Second
+		}
+		if config.MaxDelay > 0 {
+			policy.MaxDelay = time.Duration(config.MaxDelay) * time.Second
+		}
+		// jitter over 1 could make the delay negative, so the task would be retried at once
+		if config.Jitter < 0 || config.Jitter > 1 {
+			return nil, fmt.Errorf("jitter of error class '%s' is %v, it should be from 0 to 1", class, config.Jitter)
+		}
+		if config.Jitter > 0 {
+			policy.Jitter = config.Jitter
+		}
+	}
+	return policies, nil
+}
+
+// LeaseExpired tells if the task claimed on the given attempt has been claimed too many times, i.e. its lease
+// keeps expiring because the workers running it crash or are killed. The attempts of the task which has never
+// failed with an error are limited by the policy of other errors, the task failed before may be retried
+// by the policy of its error, so its attempts are limited by the largest policy only.
+func (p RetryPolicies) LeaseExpired(attempt int, failed bool) bool {
+	maxAttempts := 0
+	if policy, ok := p[crawler_tasks.ErrorClassOther]; ok && !failed {
+		maxAttempts = policy.MaxAttempts
+	} else {
+		for _, policy := range p {
+			if policy.MaxAttempts > maxAttempts {
+				maxAttempts = policy.MaxAttempts
+			}
+		}
+	}
+	return attempt > maxAttempts
+}
+
+// Retry classifies the error a task failed with on the given attempt and returns the time of the next attempt,
+// ok is false when the task shouldn't be retried anymore.
+func (p RetryPolicies) Retry(attempt int, taskErr error) (class crawler_tasks.ErrorClass, retryAt time.Time, ok bool) {
+	class = crawler_tasks.ClassifyError(taskErr)
+	policy, found := p[class]
+	if !found {
+		policy, found = p[crawler_tasks.ErrorClassOther]
+	}
+	if !found || attempt >= policy.MaxAttempts {
+		return class, time.Time{}, false
+	}
+	return class, time.Now().Add(policy.Delay(attempt)), true
+}
@@ -0,0 +1,163 @@
+package crawler
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	crawler_tasks "github.com/scarecrow6977/twitter-crawler/crawler/crawler-tasks"
+	memory_storage "github.com/scarecrow6977/twitter-crawler/crawler/storage/memory-storage"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	assert.Equal(t, time.Second, policy.Delay(1))
+	assert.Equal(t, 2*time.Second, policy.Delay(2))
+	assert.Equal(t, 8*time.Second, policy.Delay(4))
+	assert.Equal(t, 10*time.Second, policy.Delay(5), "delay should be capped")
+	assert.Equal(t, 10*time.Second, policy.Delay(100))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(2)
+		assert.True(t, delay >= time.Second && delay <= 3*time.Second, "delay %v is out of jitter bounds", delay)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	assert.Equal(t, crawler_tasks.ErrorClassRateLimit, crawler_tasks.ClassifyError(twitter_api.ErrLimitReached))
+	assert.Equal(t, crawler_tasks.ErrorClassServer, crawler_tasks.ClassifyError(&twitter_api.StatusError{StatusCode: 503}))
+	assert.Equal(t, crawler_tasks.ErrorClassOther, crawler_tasks.ClassifyError(&twitter_api.StatusError{StatusCode: 404}))
+	assert.Equal(t, crawler_tasks.ErrorClassAuth, crawler_tasks.ClassifyError(&twitter_api.ApiError{StatusCode: 401, Code: twitter_api.CodeInvalidToken}))
+	netErr := errors.Wrap(&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "request failed")
+	assert.Equal(t, crawler_tasks.ErrorClassNetwork, crawler_tasks.ClassifyError(netErr))
+	assert.Equal(t, crawler_tasks.ErrorClassOther, crawler_tasks.ClassifyError(errors.New("something")))
+	classified := &crawler_tasks.ClassifiedError{Class: crawler_tasks.ErrorClassParse, Message: "bad json"}
+	assert.Equal(t, crawler_tasks.ErrorClassParse, crawler_tasks.ClassifyError(classified))
+}
+
+func TestRetryPolicies_Retry(t *testing.T) {
+	policies, err := NewRetryPolicies(map[string]conf.RetryPolicyConfig{
+		"rate_limit": {MaxAttempts: 3},
+	}, 120)
+	assert.NoError(t, err)
+	assert.Equal(t, 120*time.Second, policies[crawler_tasks.ErrorClassRateLimit].BaseDelay)
+
+	class, retryAt, ok := policies.Retry(2, twitter_api.ErrLimitReached)
+	assert.Equal(t, crawler_tasks.ErrorClassRateLimit, class)
+	assert.True(t, ok)
+	assert.True(t, retryAt.After(time.Now().Add(time.Minute)))
+
+	_, _, ok = policies.Retry(3, twitter_api.ErrLimitReached)
+	assert.False(t, ok, "task should not be retried after max attempts")
+
+	_, err = NewRetryPolicies(map[string]conf.RetryPolicyConfig{"unknown": {}}, 0)
+	assert.Error(t, err)
+	_, err = NewRetryPolicies(map[string]conf.RetryPolicyConfig{"network": {Jitter: 1.5}}, 0)
+	assert.Error(t, err, "jitter over 1 should be rejected")
+	_, err = NewRetryPolicies(map[string]conf.RetryPolicyConfig{"network": {Jitter: -0.1}}, 0)
+	assert.Error(t, err)
+}
+
+func TestMemoryTaskQueue_Retry(t *testing.T) {
+	ctx := context.Background()
+	queue := NewMemoryTaskQueue(RetryPolicies{
+		crawler_tasks.ErrorClassOther: {MaxAttempts: 2, BaseDelay: 50 * time.Millisecond, MaxDelay: time.Second},
+	})
+	_, err := queue.Push(ctx, 0, []CrawlerTask{&saveUserTask{ScreenName: "a"}})
+	assert.NoError(t, err)
+
+	task, err := queue.Claim(ctx, "worker")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, task.Attempts)
+	assert.NoError(t, queue.Fail(ctx, task, errors.New("failed")))
+
+	task, err = queue.Claim(ctx, "worker")
+	assert.NoError(t, err)
+	assert.Nil(t, task, "task should wait for retry delay")
+
+	time.Sleep(60 * time.Millisecond)
+	task, err = queue.Claim(ctx, "worker")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, task.Attempts)
+	assert.NoError(t, queue.Fail(ctx, task, errors.New("failed again")))
+
+	queueLen, err := queue.Len(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), queueLen, "task should be dropped after max attempts")
+}
+
+func TestMemoryTaskQueue_Dedup(t *testing.T) {
+	ctx := context.Background()
+	queue := NewMemoryTaskQueue(RetryPolicies{
+		crawler_tasks.ErrorClassOther: {MaxAttempts: 1},
+	})
+	queued, err := queue.Push(ctx, 0, []CrawlerTask{&saveUserTask{ScreenName: "a"}, &saveUserTask{ScreenName: "a"}, &saveUserTask{ScreenName: "b"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), queued, "the same work should be queued once")
+
+	task, err := queue.Claim(ctx, "worker")
+	assert.NoError(t, err)
+	queued, err = queue.Push(ctx, 0, []CrawlerTask{&saveUserTask{ScreenName: "a"}, &saveUserTask{ScreenName: "b"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), queued, "claimed and queued tasks should not be queued again")
+
+	assert.NoError(t, queue.Complete(ctx, task))
+	queued, err = queue.Push(ctx, 0, []CrawlerTask{&saveUserTask{ScreenName: "a"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), queued, "completed work can be queued again")
+
+	task, err = queue.Claim(ctx, "worker")
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Fail(ctx, task, errors.New("failed")))
+	queued, err = queue.Push(ctx, 0, []CrawlerTask{task.Task})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), queued, "dropped work can be queued again")
+}
+
+func TestStorageTaskQueue_LeaseExpired(t *testing.T) {
+	ctx := context.Background()
+	stor := memory_storage.NewMemoryStorage()
+	queue := NewStorageTaskQueue(stor, 10*time.Millisecond, RetryPolicies{
+		crawler_tasks.ErrorClassRateLimit: {MaxAttempts: 5},
+		crawler_tasks.ErrorClassOther:     {MaxAttempts: 2},
+	})
+	_, err := queue.Push(ctx, 0, []CrawlerTask{&saveUserTask{ScreenName: "a"}})
+	assert.NoError(t, err)
+
+	// the worker is killed every time it runs the task, so the lease expires
+	for attempt := 1; attempt <= 2; attempt++ {
+		task, err := queue.Claim(ctx, "worker")
+		assert.NoError(t, err)
+		if assert.NotNil(t, task) {
+			assert.Equal(t, attempt, task.Attempts)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	task, err := queue.Claim(ctx, "worker")
+	assert.NoError(t, err)
+	assert.Nil(t, task, "the task whose lease expired too many times should not be claimed")
+	dead, err := stor.GetDeadCrawlTasks(ctx, "", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, dead, 1) {
+		assert.Equal(t, "a", dead[0].Key)
+		assert.Equal(t, string(crawler_tasks.ErrorClassOther), dead[0].ErrorClass)
+		assert.Equal(t, "lease expired", dead[0].LastError)
+	}
+
+	// the task failed with an error is retried by the policy of the error
+	_, err = queue.Push(ctx, 0, []CrawlerTask{&saveUserTask{ScreenName: "b"}})
+	assert.NoError(t, err)
+	for attempt := 1; attempt <= 4; attempt++ {
+		task, err = queue.Claim(ctx, "worker")
+		assert.NoError(t, err)
+		if assert.NotNil(t, task) {
+			assert.Equal(t, attempt, task.Attempts)
+			assert.NoError(t, queue.Fail(ctx, task, twitter_api.ErrLimitReached))
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	crawler_tasks "github.com/scarecrow6977/twitter-crawler/crawler/crawler-tasks"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TaskSourceFollowers = "followers"
+	TaskSourceFriends   = "friends"
+	TaskSourceHydrate   = "hydrate"
+	TaskSourceTweets    = "tweets"
+	TaskSourceSearch    = "search"
+	TaskSourceLists     = "lists"
+)
+
+// Modes of followers and friends task sources: profiles-first campaigns download users with their profiles
+// by 200 a page, edges-first ones download 5000 ids a page and hydrate unknown users separately.
+const (
+	FollowersModeProfiles = "profiles"
+	FollowersModeEdges    = "edges"
+)
+
+// TaskSource produces new tasks for the master's queue. NextTasks should return at most n tasks,
+// returning less (or none) when the source has nothing more to offer at the moment.
+type TaskSource interface {
+	Name() string
+	NextTasks(ctx context.Context, n int64) ([]CrawlerTask, error)
+}
+
+// WeightedTaskSource is a task source together with its share of the queue refill
+// and the priority its tasks are queued with.
+type WeightedTaskSource struct {
+	Source   TaskSource
+	Weight   int
+	Priority int
+}
+
+type usersTaskSource struct {
+	name     string
+	getUsers func(ctx context.Context, n int64) ([]*models.User, error)
+	newTask  func(user *models.User) CrawlerTask
+}
+
+func (s *usersTaskSource) Name() string {
+	return s.name
+}
+
+func (s *usersTaskSource) NextTasks(ctx context.Context, n int64) ([]CrawlerTask, error) {
+	users, err := s.getUsers(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]CrawlerTask, 0, len(users))
+	for _, user := range users {
+		tasks = append(tasks, s.newTask(user))
+	}
+	return tasks, nil
+}
+
+// NewFollowersTaskSource creates DownloadFollowersTask, or DownloadFollowerIdsTask in edges mode,
+// for users whose followers are not downloaded yet.
+func NewFollowersTaskSource(stor storage.Storage, mode string) (TaskSource, error) {
+	var newTask func(user *models.User) CrawlerTask
+	switch mode {
+	case "", FollowersModeProfiles:
+		newTask = func(user *models.User) CrawlerTask {
+			return &crawler_tasks.DownloadFollowersTask{
+				ScreenName: user.ScreenName,
+			}
+		}
+	case FollowersModeEdges:
+		newTask = func(user *models.User) CrawlerTask {
+			return &crawler_tasks.DownloadFollowerIdsTask{
+				ScreenName: user.ScreenName,
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown followers mode '%s'", mode)
+	}
+	return &usersTaskSource{
+		name:     TaskSourceFollowers,
+		getUsers: stor.GetUsersWithNotDownloadedFollowers,
+		newTask:  newTask,
+	}, nil
+}
+
+// NewFriendsTaskSource creates DownloadFriendsTask for users whose friends are not downloaded yet.
+func NewFriendsTaskSource(stor storage.Storage, mode string) (TaskSource, error) {
+	if mode != "" && mode != FollowersModeProfiles && mode != FollowersModeEdges {
+		return nil, fmt.Errorf("unknown friends mode '%s'", mode)
+	}
+	return &usersTaskSource{
+		name:     TaskSourceFriends,
+		getUsers: stor.GetUsersWithNotDownloadedFriends,
+		newTask: func(user *models.User) CrawlerTask {
+			return &crawler_tasks.DownloadFriendsTask{
+				ScreenName: user.ScreenName,
+				IdsOnly:    mode == FollowersModeEdges,
+			}
+		},
+	}, nil
+}
+
+type hydrateTaskSource struct {
+	stor storage.Storage
+	// afterId is the last id handed out, ids are scanned in ascending order and the scan starts over
+	// when it reaches the end
+	afterId int64
+	lock    sync.Mutex
+}
+
+// NewHydrateTaskSource creates HydrateUsersTask for batches of users which are known only by id.
+func NewHydrateTaskSource(stor storage.Storage) TaskSource {
+	return &hydrateTaskSource{stor: stor}
+}
+
+func (s *hydrateTaskSource) Name() string {
+	return TaskSourceHydrate
+}
+
+func (s *hydrateTaskSource) NextTasks(ctx context.Context, n int64) ([]CrawlerTask, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	userIds, err := s.stor.GetUnknownUserIds(ctx, s.afterId, n*twitter_api.UsersLookupSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(userIds) == 0 {
+		s.afterId = 0
+		return nil, nil
+	}
+	s.afterId = userIds[len(userIds)-1]
+	tasks := make([]CrawlerTask, 0, n)
+	for len(userIds) > 0 {
+		size := twitter_api.UsersLookupSize
+		if size > len(userIds) {
+			size = len(userIds)
+		}
+		tasks = append(tasks, &crawler_tasks.HydrateUsersTask{UserIds: userIds[:size]})
+		userIds = userIds[size:]
+	}
+	return tasks, nil
+}
+
+type screenNamesTaskSource struct {
+	name        string
+	screenNames []string
+	newTask     func(screenName string) CrawlerTask
+	lock        sync.Mutex
+}
+
+// NewScreenNamesTaskSource yields one task per screen name from a fixed list, each screen name exactly once.
+func NewScreenNamesTaskSource(name string, screenNames []string, newTask func(screenName string) CrawlerTask) TaskSource {
+	return &screenNamesTaskSource{
+		name:        name,
+		screenNames: append([]string(nil), screenNames...),
+		newTask:     newTask,
+	}
+}
+
+func (s *screenNamesTaskSource) Name() string {
+	return s.name
+}
+
+func (s *screenNamesTaskSource) NextTasks(ctx context.Context, n int64) ([]CrawlerTask, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if n > int64(len(s.screenNames)) {
+		n = int64(len(s.screenNames))
+	}
+	tasks := make([]CrawlerTask, 0, n)
+	for _, screenName := range s.screenNames[:n] {
+		tasks = append(tasks, s.newTask(screenName))
+	}
+	s.screenNames = s.screenNames[n:]
+	return tasks, nil
+}
+
+// NewTweetsTaskSource creates DownloadTweetsTask for the given screen names, maxTweets and minDate
+// are passed to the tasks.
+func NewTweetsTaskSource(screenNames []string, maxTweets int, minDate time.Time) TaskSource {
+	return NewScreenNamesTaskSource(TaskSourceTweets, screenNames, func(screenName string) CrawlerTask {
+		return crawler_tasks.DownloadTweetsTask{
+			ScreenName: screenName,
+			MaxTweets:  maxTweets,
+			MinDate:    minDate,
+		}
+	})
+}
+
+// NewSearchTaskSource creates SearchTweetsTask for the given queries.
+func NewSearchTaskSource(queries []string, since, until time.Time, sliceDays int) TaskSource {
+	return NewScreenNamesTaskSource(TaskSourceSearch, queries, func(query string) CrawlerTask {
+		return &crawler_tasks.SearchTweetsTask{
+			Query:     query,
+			Since:     since,
+			Until:     until,
+			SliceDays: sliceDays,
+		}
+	})
+}
+
+// NewListsTaskSource creates DownloadListTask for members of the given lists, and for their subscribers
+// if subscribers is set.
+func NewListsTaskSource(listIds []int64, subscribers bool) TaskSource {
+	keys := make([]string, 0, 2*len(listIds))
+	for _, listId := range listIds {
+		keys = append(keys, strconv.FormatInt(listId, 10))
+		if subscribers {
+			keys = append(keys, strconv.FormatInt(listId, 10)+":subscribers")
+		}
+	}
+	return NewScreenNamesTaskSource(TaskSourceLists, keys, func(key string) CrawlerTask {
+		listId, _ := strconv.ParseInt(strings.TrimSuffix(key, ":subscribers"), 10, 64)
+		return &crawler_tasks.DownloadListTask{
+			ListId:      listId,
+			Subscribers: strings.HasSuffix(key, ":subscribers"),
+		}
+	})
+}
+
+// NewTaskSources builds task sources described in config. If nothing is configured,
+// the crawler falls back to downloading followers only. Sources with weight 0 are skipped.
+func NewTaskSources(configs []conf.TaskSourceConfig, stor storage.Storage) ([]*WeightedTaskSource, error) {
+	if len(configs) == 0 {
+		configs = []conf.TaskSourceConfig{{Type: TaskSourceFollowers}}
+	}
+	sources := make([]*WeightedTaskSource, 0, len(configs))
+	for _, c := range configs {
+		weight := 1
+		if c.Weight != nil {
+			weight = *c.Weight
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("task source '%s' has negative weight %d", c.Type, weight)
+		}
+		if weight == 0 {
+			continue
+		}
+		var source TaskSource
+		var err error
+		switch c.Type {
+		case TaskSourceFollowers:
+			source, err = NewFollowersTaskSource(stor, c.Mode)
+			if err != nil {
+				return nil, err
+			}
+		case TaskSourceFriends:
+			source, err = NewFriendsTaskSource(stor, c.Mode)
+			if err != nil {
+				return nil, err
+			}
+		case TaskSourceHydrate:
+			source = NewHydrateTaskSource(stor)
+		case TaskSourceTweets:
+			var minDate time.Time
+			if c.MinDate != "" {
+				minDate, err = time.Parse("2006-01-02", c.MinDate)
+				if err != nil {
+					return nil, fmt.Errorf("bad min_date of task source '%s': %v", c.Type, err)
+				}
+			}
+			source = NewTweetsTaskSource(c.ScreenNames, c.MaxTweets, minDate)
+		case TaskSourceSearch:
+			since, err := time.Parse("2006-01-02", c.Since)
+			if err != nil {
+				return nil, fmt.Errorf("bad since of task source '%s': %v", c.Type, err)
+			}
+			// without until the search goes till the day it's started on, see SearchTweetsTask
+			var until time.Time
+			if c.Until != "" {
+				until, err = time.Parse("2006-01-02", c.Until)
+				if err != nil {
+					return nil, fmt.Errorf("bad until of task source '%s': %v", c.Type, err)
+				}
+				if !since.Before(until) {
+					return nil, fmt.Errorf("task source '%s' has got since %s not before until %s", c.Type, c.Since, c.Until)
+				}
+			} else if since.After(time.Now()) {
+				return nil, fmt.Errorf("task source '%s' has got since %s in the future", c.Type, c.Since)
+			}
+			source = NewSearchTaskSource(c.Queries, since, until, c.SliceDays)
+		case TaskSourceLists:
+			source = NewListsTaskSource(c.ListIds, c.Subscribers)
+		default:
+			return nil, fmt.Errorf("unknown task source type '%s'", c.Type)
+		}
+		sources = append(sources, &WeightedTaskSource{Source: source, Weight: weight, Priority: c.Priority})
+	}
+	return sources, nil
+}
+
+// splitByWeight divides total into parts proportional to weights, giving the units lost to rounding
+// to the parts with the largest remainders.
+func splitByWeight(total int64, weights []int) []int64 {
+	parts := make([]int64, len(weights))
+	var weightSum int64
+	for _, w := range weights {
+		weightSum += int64(w)
+	}
+	if weightSum == 0 || total <= 0 {
+		return parts
+	}
+	var assigned int64
+	for i, w := range weights {
+		parts[i] = total * int64(w) / weightSum
+		assigned += parts[i]
+	}
+	for assigned < total {
+		best := -1
+		for i, w := range weights {
+			if w == 0 {
+				continue
+			}
+			if best == -1 || remainderOf(total, w, weightSum) > remainderOf(total, weights[best], weightSum) {
+				best = i
+			}
+		}
+		parts[best]++
+		assigned++
+		weights = append([]int(nil), weights...)
+		weights[best] = 0
+	}
+	return parts
+}
+
+func remainderOf(total int64, weight int, weightSum int64) int64 {
+	return total * int64(weight) % weightSum
+}
@@ -1,7 +1,62 @@
 package crawler
 
-import "github.com/scarecrow6977/twitter-crawler/crawler/storage"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	crawler_tasks "github.com/scarecrow6977/twitter-crawler/crawler/crawler-tasks"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+)
 
 type CrawlerTask interface {
-	Exec(stor storage.Storage) error
+	Exec(ctx context.Context, stor storage.Storage) error
+}
+
+// QueueableTask is a task which can be saved to the persistent queue. Its exported fields are stored
+// as json, TaskKey identifies the work to be done so it isn't queued twice.
+type QueueableTask interface {
+	CrawlerTask
+	TaskType() string
+	TaskKey() string
+}
+
+var taskFactories = map[string]func() CrawlerTask{
+	models.TaskTypeDownloadFollowers:   func() CrawlerTask { return &crawler_tasks.DownloadFollowersTask{} },
+	models.TaskTypeDownloadFollowerIds: func() CrawlerTask { return &crawler_tasks.DownloadFollowerIdsTask{} },
+	models.TaskTypeDownloadFriends:     func() CrawlerTask { return &crawler_tasks.DownloadFriendsTask{} },
+	models.TaskTypeHydrateUsers:        func() CrawlerTask { return &crawler_tasks.HydrateUsersTask{} },
+	models.TaskTypeDownloadTweets:      func() CrawlerTask { return &crawler_tasks.DownloadTweetsTask{} },
+	models.TaskTypeSearchTweets:        func() CrawlerTask { return &crawler_tasks.SearchTweetsTask{} },
+	models.TaskTypeDownloadList:        func() CrawlerTask { return &crawler_tasks.DownloadListTask{} },
+}
+
+func encodeTask(task CrawlerTask, priority int) (*models.CrawlTask, error) {
+	queueable, ok := task.(QueueableTask)
+	if !ok {
+		return nil, fmt.Errorf("task of type %T can't be saved to the queue", task)
+	}
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+	return &models.CrawlTask{
+		Type:     queueable.TaskType(),
+		Key:      queueable.TaskKey(),
+		Payload:  string(payload),
+		Priority: priority,
+	}, nil
+}
+
+func decodeTask(record *models.CrawlTask) (CrawlerTask, error) {
+	newTask, ok := taskFactories[record.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown task type '%s'", record.Type)
+	}
+	task := newTask()
+	err := json.Unmarshal([]byte(record.Payload), task)
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
 }
@@ -1,14 +1,23 @@
 package crawler
 
 import (
+	"context"
 	"fmt"
+	"github.com/pkg/errors"
+	crawler_tasks "github.com/scarecrow6977/twitter-crawler/crawler/crawler-tasks"
 	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type CrawlerWorker struct {
-	id      int
-	master  *CrawlerMaster
-	isAlive bool
+	id       int
+	owner    string
+	master   *CrawlerMaster
+	isAlive  int32
+	stopCh   chan struct{}
+	stopOnce sync.Once
 	*log.Logger
 }
 
@@ -17,39 +26,111 @@ func NewCrawlerWorker(id int, m *CrawlerMaster) *CrawlerWorker {
 
 	worker := &CrawlerWorker{
 		id:     id,
+		owner:  fmt.Sprintf("%s/%d", m.ownerPrefix, id),
 		master: m,
+		stopCh: make(chan struct{}),
 	}
 	worker.Logger = logger
 	return worker
 }
 
 func (w *CrawlerWorker) IsAlive() bool {
-	return w.isAlive
+	return atomic.LoadInt32(&w.isAlive) == 1
 }
 
 func (w *CrawlerWorker) Run() {
 	w.LogInfo("Starting worker")
 
-	w.isAlive = true
-	for w.isAlive {
-		task, ok := <-w.master.taskQueue
-		if !ok {
-			w.master.workerDoneCh <- w.id
-			break
+	atomic.StoreInt32(&w.isAlive, 1)
+	go func() {
+		select {
+		case <-w.master.shutdownCh:
+			w.Kill()
+		case <-w.stopCh:
 		}
-		err := task.Exec(w.master.stor)
+	}()
+	ctx := crawler_tasks.WithShutdown(w.master.execCtx, w.stopCh)
+
+loop:
+	for {
+		select {
+		case <-w.stopCh:
+			break loop
+		default:
+		}
+		queued, err := w.master.queue.Claim(w.master.execCtx, w.owner)
 		if err != nil {
-			w.LogError("error running task, err='%v'", err)
-			//w.master.workerDoneCh <- w.id
-			//break
+			w.LogError("can't claim task, err='%v'", err)
+		}
+		if queued == nil {
+			select {
+			case <-w.stopCh:
+				break loop
+			case <-time.After(w.master.claimInterval):
+			}
 			continue
 		}
+		w.execTask(ctx, queued)
 	}
-	w.isAlive = false
+	atomic.StoreInt32(&w.isAlive, 0)
 	w.LogInfo("Exited")
+	w.master.workerDoneCh <- w.id
+}
+
+func (w *CrawlerWorker) execTask(ctx context.Context, queued *QueuedTask) {
+	stopKeepingLease := w.keepLease(queued)
+	err := queued.Task.Exec(ctx, w.master.stor)
+	stopKeepingLease()
+
+	// the result is saved even if the task was aborted by the shutdown timeout
+	queue := w.master.queue
+	resultCtx := context.Background()
+	switch {
+	case err == nil:
+		err = queue.Complete(resultCtx, queued)
+	case errors.Is(err, crawler_tasks.ErrInterrupted) || errors.Is(err, context.Canceled):
+		w.LogInfo("task interrupted")
+		err = queue.Release(resultCtx, queued)
+	default:
+		w.LogError("error running task, err='%v'", err)
+		err = queue.Fail(resultCtx, queued, err)
+	}
+	if err != nil {
+		w.LogError("can't save result of task %d, err='%v'", queued.Id, err)
+	}
+}
+
+// keepLease extends the lease of the running task until the returned function is called.
+func (w *CrawlerWorker) keepLease(queued *QueuedTask) (stop func()) {
+	leaseDuration := w.master.queue.LeaseDuration()
+	if leaseDuration <= 0 {
+		return func() {}
+	}
+	doneCh := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(leaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-doneCh:
+				return
+			case <-ticker.C:
+				err := w.master.queue.ExtendLease(w.master.execCtx, queued)
+				if err != nil {
+					w.LogWarning("can't extend lease of task %d, err='%v'", queued.Id, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(doneCh)
+	}
 }
 
+// Kill asks the worker to stop. A task in progress saves its current page and returns first.
 func (w *CrawlerWorker) Kill() {
-	w.LogInfo("Stopping worker...")
-	w.isAlive = false
+	w.stopOnce.Do(func() {
+		w.LogInfo("Stopping worker...")
+		close(w.stopCh)
+	})
 }
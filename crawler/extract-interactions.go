@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage/backend"
+	"strconv"
+)
+
+// Extract interactions: parses retweets, replies, quotes and mentions of all saved tweets into the interactions
+// table, e.g. for tweets downloaded before the crawler started to extract them.
+func main() {
+	var configPath string
+	var batch int64
+	var afterId int64
+	flag.StringVar(&configPath, "config", "config.yaml", "path to the config file")
+	flag.Int64Var(&batch, "batch", 1000, "number of tweets parsed at once")
+	flag.Int64Var(&afterId, "after", 0, "parse tweets with greater ids only, e.g. to continue an interrupted run")
+	flag.Parse()
+
+	conf.Init(configPath)
+	config, err := conf.LoadConfig()
+	if err != nil {
+		fmt.Printf("can't load config, err='%v'", err)
+		return
+	}
+	log.SetVerbosityLevel(2)
+
+	stor, err := backend.NewStorage(config)
+	if err != nil {
+		log.LogError("can't open storage, err='%v'", err)
+		return
+	}
+	defer stor.Close()
+	ctx := context.Background()
+
+	var parsed, extracted int
+	for {
+		tweets, err := stor.GetTweets(ctx, afterId, batch)
+		if err != nil {
+			log.LogError("can't get tweets after %d, err='%v'", afterId, err)
+			return
+		}
+		if len(tweets) == 0 {
+			break
+		}
+		known, err := knownTweets(ctx, stor, tweets)
+		if err != nil {
+			log.LogError("can't get referenced tweets, err='%v'", err)
+			return
+		}
+		interactions := models.ExtractInteractions(tweets, known)
+		err = stor.AddNewInteractions(ctx, interactions)
+		if err != nil {
+			log.LogError("can't save interactions, err='%v'", err)
+			return
+		}
+		parsed += len(tweets)
+		extracted += len(interactions)
+		afterId = tweets[len(tweets)-1].Id
+		log.LogInfo("%d tweets parsed, %d interactions extracted, last tweet id = %d", parsed, extracted, afterId)
+	}
+	log.LogInfo("Interactions successfully extracted.")
+}
+
+// knownTweets returns the tweets and the saved tweets they retweet or quote, keyed by tweet id.
+func knownTweets(ctx context.Context, stor storage.TweetsReader, tweets []*models.Tweet) (map[string]*models.Tweet, error) {
+	known := make(map[string]*models.Tweet, len(tweets))
+	for _, tweet := range tweets {
+		known[tweet.IdStr] = tweet
+	}
+	referencedIds := make([]int64, 0)
+	for _, tweet := range tweets {
+		for _, idStr := range []string{tweet.RetweetedStatusIdStr, tweet.QuotedStatusIdStr} {
+			if _, ok := known[idStr]; idStr == "" || ok {
+				continue
+			}
+			id, err := strconv.ParseInt(idStr, 10, 64)
+			if err == nil {
+				referencedIds = append(referencedIds, id)
+			}
+		}
+	}
+	referenced, err := stor.GetTweetsByIds(ctx, referencedIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, tweet := range referenced {
+		known[tweet.IdStr] = tweet
+	}
+	return known, nil
+}
@@ -1,13 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"flag"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
 	"github.com/scarecrow6977/twitter-crawler/crawler/log"
-	pg_storage "github.com/scarecrow6977/twitter-crawler/crawler/storage/pg-storage"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage/backend"
 	"os"
 )
 
@@ -16,52 +18,44 @@ type follow struct {
 	followerId int64
 }
 
-func extractSubgraph(pgStorage *pg_storage.PgStorage, firstUserId, size int64) error {
-	doneCh := make(chan struct{})
+func extractSubgraph(stor storage.FollowersReader, firstUserId, size int64) error {
 	filename := fmt.Sprintf("subgraph_%d_%d.csv", firstUserId, size)
-	followChan := getFollowsChan(pgStorage, doneCh, firstUserId, size)
-	err := consumeFollows(followChan, doneCh, filename)
+	followChan := getFollowsChan(stor, firstUserId, size)
+	err := consumeFollows(followChan, filename)
 	if err != nil {
 		return errors.Wrap(err, "consume follows")
 	}
 	return nil
 }
 
-func getFollowsChan(pgStorage *pg_storage.PgStorage, doneCh chan<- struct{}, firstUserId, size int64) (follows <-chan follow) {
-	userIdChan := make(chan int64, 2*size)
+// getFollowsChan walks the follower graph breadth first from firstUserId, the channel is closed after size edges
+// or when every reachable user is visited.
+func getFollowsChan(stor storage.FollowersReader, firstUserId, size int64) (follows <-chan follow) {
 	followChan := make(chan follow, 1000)
-	userIdChan <- firstUserId
 
 	go func() {
+		defer close(followChan)
 		var edgesCount int64 = 0
-		visited := make(map[int64]struct{})
-	Top:
-		for {
-			select {
-			case userId := <-userIdChan:
-				followerIds, err := pgStorage.GetFollowerIds(userId)
-				if err != nil {
-					log.LogError("get follower ids of user %d, err=%v", userId, err)
-					continue
-				}
-				//log.LogInfo("Received followers of user %v (amount %v), edgesCount=%v", userId, len(followerIds), edgesCount)
-				visited[userId] = struct{}{}
-				for _, followerId := range followerIds {
-					if _, ok := visited[followerId]; !ok {
-						userIdChan <- followerId
-					}
-					followChan <- follow{
-						userId:     userId,
-						followerId: followerId,
-					}
-					edgesCount++
+		queued := map[int64]struct{}{firstUserId: {}}
+		userIds := []int64{firstUserId}
+		for len(userIds) > 0 && edgesCount <= size {
+			userId := userIds[0]
+			userIds = userIds[1:]
+			followerIds, err := stor.GetFollowerIds(context.Background(), userId)
+			if err != nil {
+				log.LogError("get follower ids of user %d, err=%v", userId, err)
+				continue
+			}
+			for _, followerId := range followerIds {
+				if _, ok := queued[followerId]; !ok {
+					queued[followerId] = struct{}{}
+					userIds = append(userIds, followerId)
 				}
-				if edgesCount > size {
-					close(userIdChan)
-					close(followChan)
-					doneCh <- struct{}{}
-					break Top
+				followChan <- follow{
+					userId:     userId,
+					followerId: followerId,
 				}
+				edgesCount++
 			}
 		}
 	}()
@@ -69,36 +63,32 @@ func getFollowsChan(pgStorage *pg_storage.PgStorage, doneCh chan<- struct{}, fir
 	return followChan
 }
 
-func consumeFollows(follows <-chan follow, doneCh <-chan struct{}, filename string) error {
+func consumeFollows(follows <-chan follow, filename string) error {
 	csvFile, err := os.Create(filename)
 
 	if err != nil {
 		return errors.Wrapf(err, "create file %s", filename)
 	}
+	defer csvFile.Close()
 
 	writer := csv.NewWriter(csvFile)
 	counter := 0
-	for {
-		select {
-		case f := <-follows:
-			data := []string{
-				fmt.Sprintf("%v", f.userId),
-				fmt.Sprintf("%v", f.followerId),
-			}
-			err := writer.Write(data)
-			if err != nil {
-				return err
-			}
-			counter++
-			if counter%1000 == 0 {
-				writer.Flush()
-			}
-		case <-doneCh:
+	for f := range follows {
+		data := []string{
+			fmt.Sprintf("%v", f.userId),
+			fmt.Sprintf("%v", f.followerId),
+		}
+		err := writer.Write(data)
+		if err != nil {
+			return err
+		}
+		counter++
+		if counter%1000 == 0 {
 			writer.Flush()
-
-			return nil
 		}
 	}
+	writer.Flush()
+	return writer.Error()
 }
 
 func main() {
@@ -119,13 +109,14 @@ func main() {
 	}
 	log.SetVerbosityLevel(2)
 
-	pgStorage, err := pg_storage.NewPgStorage(config.PostgresAccess)
+	stor, err := backend.NewStorage(config)
 	if err != nil {
-		log.LogError(fmt.Sprintf("can't load config, err='%v'", err))
+		log.LogError("can't open storage, err='%v'", err)
 		return
 	}
+	defer stor.Close()
 
-	err = extractSubgraph(pgStorage, userId, size)
+	err = extractSubgraph(stor, userId, size)
 	if err != nil {
 		log.LogError("can't extract subgraph, err=%v", err)
 	}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	fake_twitter "github.com/scarecrow6977/twitter-crawler/crawler/fake-twitter"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"net/http"
+	"time"
+)
+
+// Fake twitter: serves a synthetic follower graph for offline runs of the crawler,
+// set twitter_api_url in config to its address.
+func main() {
+	var listen string
+	options := fake_twitter.GraphOptions{}
+	serverOptions := fake_twitter.ServerOptions{}
+	var window int
+	flag.StringVar(&listen, "listen", ":8091", "address to listen on")
+	flag.IntVar(&options.Users, "users", 10000, "number of users")
+	flag.IntVar(&options.AvgFollowers, "followers", 300, "average number of followers")
+	flag.IntVar(&options.ProtectedEvery, "protected-every", 20, "every n-th user has got protected profile, 0 for none")
+	flag.IntVar(&options.TweetsPerUser, "tweets", 20, "number of tweets of every user")
+	flag.Int64Var(&options.Seed, "seed", 1, "seed of the graph")
+	flag.IntVar(&serverOptions.RateLimit, "rate-limit", 15, "requests a session can make to an endpoint in a window, 0 for no limit")
+	flag.IntVar(&window, "rate-limit-window", 900, "rate limit window in seconds")
+	flag.IntVar(&serverOptions.SearchLimit, "search-limit", 1000, "max number of tweets found by a search query, 0 for no limit")
+	flag.Parse()
+	serverOptions.RateLimitWindow = time.Duration(window) * time.Second
+
+	log.SetVerbosityLevel(2)
+	graph := fake_twitter.NewGraph(options)
+	log.LogInfo("Serving fake twitter with %d users on %s, try /1.1/users/show.json?screen_name=user0", options.Users, listen)
+	err := http.ListenAndServe(listen, fake_twitter.NewServer(graph, serverOptions))
+	if err != nil {
+		log.LogError("fake twitter stopped, err='%v'", err)
+	}
+}
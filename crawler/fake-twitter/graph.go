@@ -0,0 +1,232 @@
+package fake_twitter
+
+import (
+	"fmt"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// firstUserId is the id of user0, ids of other users follow it.
+const firstUserId = 1000
+
+// firstListId is the id of the first list added to the graph.
+const firstListId = 5000000
+
+// Graph is a synthetic follower graph. Users are named user0, user1, ..., the same seed gives the same graph.
+type Graph struct {
+	users     []*models.User
+	followers map[int64][]int64
+	friends   map[int64][]int64
+	tweets    map[int64][]*models.Tweet
+	suspended map[int64]bool
+	lists     map[int64]*fakeList
+}
+
+type fakeList struct {
+	list        *models.List
+	members     []int64
+	subscribers []int64
+}
+
+// GraphOptions sets the shape of the graph, every ProtectedEvery-th user has got protected profile.
+type GraphOptions struct {
+	Users          int
+	AvgFollowers   int
+	ProtectedEvery int
+	TweetsPerUser  int
+	Seed           int64
+}
+
+func NewGraph(options GraphOptions) *Graph {
+	rng := rand.New(rand.NewSource(options.Seed))
+	g := &Graph{
+		users:     make([]*models.User, 0, options.Users),
+		followers: make(map[int64][]int64),
+		friends:   make(map[int64][]int64),
+		tweets:    make(map[int64][]*models.Tweet),
+		suspended: make(map[int64]bool),
+		lists:     make(map[int64]*fakeList),
+	}
+	createdAt := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < options.Users; i++ {
+		id := int64(firstUserId + i)
+		protected := options.ProtectedEvery > 0 && i > 0 && i%options.ProtectedEvery == 0
+		g.users = append(g.users, &models.User{
+			Id:         id,
+			IdStr:      strconv.FormatInt(id, 10),
+			ScreenName: fmt.Sprintf("user%d", i),
+			Name:       fmt.Sprintf("User %d", i),
+			CreatedAt:  createdAt.Add(time.Duration(i) * time.Hour).Format(time.RubyDate),
+			Protected:  &protected,
+		})
+	}
+	for _, user := range g.users {
+		followersCount := 0
+		if options.AvgFollowers > 0 {
+			followersCount = rng.Intn(2*options.AvgFollowers + 1)
+		}
+		if followersCount > options.Users-1 {
+			followersCount = options.Users - 1
+		}
+		picked := make(map[int64]bool)
+		for len(picked) < followersCount {
+			followerId := int64(firstUserId + rng.Intn(options.Users))
+			if followerId != user.Id && !picked[followerId] {
+				picked[followerId] = true
+				g.followers[user.Id] = append(g.followers[user.Id], followerId)
+			}
+		}
+		g.AddTweets(user.Id, options.TweetsPerUser)
+	}
+	for _, user := range g.users {
+		user.FollowersCount = int64(len(g.followers[user.Id]))
+	}
+	for _, user := range g.users {
+		for _, followerId := range g.followers[user.Id] {
+			g.follow(followerId, user.Id)
+		}
+	}
+	return g
+}
+
+// AddUser adds a user with the given followers, e.g. to test paging of large followers lists.
+func (g *Graph) AddUser(screenName string, protected bool, followerIds []int64) *models.User {
+	id := int64(firstUserId + len(g.users))
+	user := &models.User{
+		Id:             id,
+		IdStr:          strconv.FormatInt(id, 10),
+		ScreenName:     screenName,
+		Name:           screenName,
+		Protected:      &protected,
+		FollowersCount: int64(len(followerIds)),
+	}
+	g.users = append(g.users, user)
+	g.followers[id] = followerIds
+	for _, followerId := range followerIds {
+		g.follow(followerId, id)
+	}
+	return user
+}
+
+// AddTweets posts n new tweets of the user, a minute apart starting from 2010-01-01.
+func (g *Graph) AddTweets(userId int64, n int) []*models.Tweet {
+	user := g.UserById(userId)
+	createdAt := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	added := make([]*models.Tweet, 0, n)
+	for i := len(g.tweets[userId]); len(added) < n; i++ {
+		text := fmt.Sprintf("tweet %d of %s", i, user.ScreenName)
+		added = append(added, g.PostTweet(userId, text, createdAt.Add(time.Duration(i)*time.Minute)))
+	}
+	return added
+}
+
+// PostTweet adds a tweet of the user, tweets of a user should be posted in order of their dates.
+func (g *Graph) PostTweet(userId int64, text string, createdAt time.Time) *models.Tweet {
+	user := g.UserById(userId)
+	tweetId := userId*1000000 + int64(len(g.tweets[userId]))
+	tweet := &models.Tweet{
+		Id:        tweetId,
+		IdStr:     strconv.FormatInt(tweetId, 10),
+		UserId:    userId,
+		UserIdStr: user.IdStr,
+		CreatedAt: createdAt.UTC().Format(time.RubyDate),
+		FullText:  text,
+		Lang:      "en",
+	}
+	g.tweets[userId] = append(g.tweets[userId], tweet)
+	return tweet
+}
+
+// AddList adds a public list of the owner with the given members and subscribers.
+func (g *Graph) AddList(ownerId int64, name string, memberIds, subscriberIds []int64) *models.List {
+	id := int64(firstListId + len(g.lists))
+	list := &models.List{
+		Id:              id,
+		IdStr:           strconv.FormatInt(id, 10),
+		Name:            name,
+		Slug:            strings.ToLower(strings.ReplaceAll(name, " ", "-")),
+		Mode:            "public",
+		MemberCount:     int64(len(memberIds)),
+		SubscriberCount: int64(len(subscriberIds)),
+		CreatedAt:       time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC).Format(time.RubyDate),
+		Owner:           g.UserById(ownerId),
+	}
+	g.lists[id] = &fakeList{list: list, members: memberIds, subscribers: subscriberIds}
+	return list
+}
+
+func (g *Graph) ListById(id int64) *models.List {
+	if list, ok := g.lists[id]; ok {
+		return list.list
+	}
+	return nil
+}
+
+func (g *Graph) ListMembers(listId int64) []int64 {
+	if list, ok := g.lists[listId]; ok {
+		return list.members
+	}
+	return nil
+}
+
+func (g *Graph) ListSubscribers(listId int64) []int64 {
+	if list, ok := g.lists[listId]; ok {
+		return list.subscribers
+	}
+	return nil
+}
+
+// follow adds userId to friends of followerId, the edge is already in followers of userId.
+func (g *Graph) follow(followerId, userId int64) {
+	g.friends[followerId] = append(g.friends[followerId], userId)
+	if follower := g.UserById(followerId); follower != nil {
+		follower.FriendsCount++
+	}
+}
+
+// SuspendUser makes api respond to requests about the user with code 63.
+func (g *Graph) SuspendUser(id int64) {
+	g.suspended[id] = true
+}
+
+func (g *Graph) IsSuspended(id int64) bool {
+	return g.suspended[id]
+}
+
+func (g *Graph) Users() []*models.User {
+	return g.users
+}
+
+func (g *Graph) UserById(id int64) *models.User {
+	idx := id - firstUserId
+	if idx < 0 || idx >= int64(len(g.users)) {
+		return nil
+	}
+	return g.users[idx]
+}
+
+func (g *Graph) UserByScreenName(screenName string) *models.User {
+	for _, user := range g.users {
+		if strings.EqualFold(user.ScreenName, screenName) {
+			return user
+		}
+	}
+	return nil
+}
+
+// Followers returns ids of followers of the user, newest first like twitter does.
+func (g *Graph) Followers(userId int64) []int64 {
+	return g.followers[userId]
+}
+
+// Friends returns ids of users the user follows.
+func (g *Graph) Friends(userId int64) []int64 {
+	return g.friends[userId]
+}
+
+func (g *Graph) Tweets(userId int64) []*models.Tweet {
+	return g.tweets[userId]
+}
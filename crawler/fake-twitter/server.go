@@ -0,0 +1,487 @@
+package fake_twitter
+
+import (
+	"encoding/json"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cursorBase makes cursors look like the ones of twitter, a cursor is cursorBase plus the offset in the list.
+const cursorBase = 1600000000000000000
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 200
+	maxIdsPageSize  = 5000
+	maxLookupSize   = 100
+)
+
+// ServerOptions sets the behaviour of the fake server. RateLimit is the number of requests a session can make
+// to an endpoint within RateLimitWindow, requests aren't limited if it's 0. Sessions with csrf tokens from
+// InvalidTokens are rejected as expired. A search query finds at most SearchLimit tweets like on twitter, where
+// long ranges have to be sliced by dates, there is no limit if it's 0.
+type ServerOptions struct {
+	RateLimit       int
+	RateLimitWindow time.Duration
+	InvalidTokens   []string
+	SearchLimit     int
+}
+
+type rateLimitKey struct {
+	session  string
+	endpoint string
+}
+
+type rateLimitWindow struct {
+	remaining int
+	reset     time.Time
+}
+
+// Server serves the part of twitter api used by the crawler with the data of a synthetic graph.
+type Server struct {
+	graph   *Graph
+	options ServerOptions
+	mux     *http.ServeMux
+
+	lock     sync.Mutex
+	windows  map[rateLimitKey]*rateLimitWindow
+	requests map[string]int
+}
+
+func NewServer(graph *Graph, options ServerOptions) *Server {
+	s := &Server{
+		graph:    graph,
+		options:  options,
+		mux:      http.NewServeMux(),
+		windows:  make(map[rateLimitKey]*rateLimitWindow),
+		requests: make(map[string]int),
+	}
+	s.mux.HandleFunc("/1.1/users/show.json", s.limited(s.handleShowUser))
+	s.mux.HandleFunc("/1.1/followers/list.json", s.limited(s.usersList(s.graph.Followers)))
+	s.mux.HandleFunc("/1.1/followers/ids.json", s.limited(s.idsList(s.graph.Followers)))
+	s.mux.HandleFunc("/1.1/friends/list.json", s.limited(s.usersList(s.graph.Friends)))
+	s.mux.HandleFunc("/1.1/friends/ids.json", s.limited(s.idsList(s.graph.Friends)))
+	s.mux.HandleFunc("/1.1/users/lookup.json", s.limited(s.handleUsersLookup))
+	s.mux.HandleFunc("/2/timeline/profile/", s.limited(s.handleProfileTimeline))
+	s.mux.HandleFunc("/2/search/adaptive.json", s.limited(s.handleSearch))
+	s.mux.HandleFunc("/1.1/lists/show.json", s.limited(s.handleShowList))
+	s.mux.HandleFunc("/1.1/lists/members.json", s.limited(s.listUsers(s.graph.ListMembers)))
+	s.mux.HandleFunc("/1.1/lists/subscribers.json", s.limited(s.listUsers(s.graph.ListSubscribers)))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Requests returns the number of requests made to the endpoint, including rejected ones.
+func (s *Server) Requests(endpoint string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests[endpoint]
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeApiError(w http.ResponseWriter, status int, code int, message string) {
+	writeJson(w, status, map[string][]apiError{"errors": {{Code: code, Message: message}}})
+}
+
+// limited checks the session of the request and counts the request in the rate limit window of the session.
+func (s *Server) limited(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoint := r.URL.Path
+		if strings.HasPrefix(endpoint, "/2/timeline/profile/") {
+			endpoint = "/2/timeline/profile"
+		}
+		s.lock.Lock()
+		s.requests[endpoint]++
+		s.lock.Unlock()
+
+		if r.Header.Get("authorization") == "" {
+			writeApiError(w, http.StatusBadRequest, 215, "Bad Authentication data.")
+			return
+		}
+		session := r.Header.Get("x-csrf-token")
+		for _, token := range s.options.InvalidTokens {
+			if session == token {
+				writeApiError(w, http.StatusUnauthorized, 89, "Invalid or expired token.")
+				return
+			}
+		}
+		if s.options.RateLimit <= 0 {
+			handler(w, r)
+			return
+		}
+
+		s.lock.Lock()
+		key := rateLimitKey{session: session, endpoint: endpoint}
+		window, ok := s.windows[key]
+		now := time.Now()
+		if !ok || !now.Before(window.reset) {
+			window = &rateLimitWindow{
+				remaining: s.options.RateLimit,
+				reset:     now.Add(s.options.RateLimitWindow),
+			}
+			s.windows[key] = window
+		}
+		limited := window.remaining == 0
+		if !limited {
+			window.remaining--
+		}
+		w.Header().Set("x-rate-limit-limit", strconv.Itoa(s.options.RateLimit))
+		w.Header().Set("x-rate-limit-remaining", strconv.Itoa(window.remaining))
+		// twitter reports the reset time in seconds, rounding it up keeps clients from coming too early
+		w.Header().Set("x-rate-limit-reset", strconv.FormatInt(window.reset.Add(time.Second-1).Unix(), 10))
+		s.lock.Unlock()
+
+		if limited {
+			writeApiError(w, http.StatusTooManyRequests, 88, "Rate limit exceeded")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (s *Server) handleShowUser(w http.ResponseWriter, r *http.Request) {
+	user := s.graph.UserByScreenName(r.URL.Query().Get("screen_name"))
+	if user == nil {
+		writeApiError(w, http.StatusNotFound, 50, "User not found.")
+		return
+	}
+	if s.graph.IsSuspended(user.Id) {
+		writeApiError(w, http.StatusForbidden, 63, "User has been suspended.")
+		return
+	}
+	writeJson(w, http.StatusOK, user)
+}
+
+type cursors struct {
+	NextCursor        int64  `json:"next_cursor"`
+	NextCursorStr     string `json:"next_cursor_str"`
+	PreviousCursor    int64  `json:"previous_cursor"`
+	PreviousCursorStr string `json:"previous_cursor_str"`
+}
+
+type usersPage struct {
+	Users []interface{} `json:"users"`
+	cursors
+}
+
+type idsPage struct {
+	Ids []int64 `json:"ids"`
+	cursors
+}
+
+// usersList serves a cursored list of users, e.g. followers or friends, with their profiles.
+func (s *Server) usersList(list func(userId int64) []int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ids, pageCursors, ok := s.listPage(w, r, list, defaultPageSize, maxPageSize)
+		if !ok {
+			return
+		}
+		page := &usersPage{Users: make([]interface{}, 0, len(ids)), cursors: pageCursors}
+		for _, userId := range ids {
+			page.Users = append(page.Users, s.graph.UserById(userId))
+		}
+		writeJson(w, http.StatusOK, page)
+	}
+}
+
+// idsList serves a cursored list of user ids, e.g. followers or friends.
+func (s *Server) idsList(list func(userId int64) []int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ids, pageCursors, ok := s.listPage(w, r, list, maxIdsPageSize, maxIdsPageSize)
+		if !ok {
+			return
+		}
+		writeJson(w, http.StatusOK, &idsPage{Ids: append([]int64{}, ids...), cursors: pageCursors})
+	}
+}
+
+// listPage returns ids of the list of the user on the page requested by cursor, errors are written to w.
+func (s *Server) listPage(w http.ResponseWriter, r *http.Request, list func(userId int64) []int64, defaultSize, maxSize int) ([]int64, cursors, bool) {
+	q := r.URL.Query()
+	userId, err := strconv.ParseInt(q.Get("user_id"), 10, 64)
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, 44, "user_id parameter is invalid.")
+		return nil, cursors{}, false
+	}
+	user := s.graph.UserById(userId)
+	if user == nil {
+		writeApiError(w, http.StatusNotFound, 50, "User not found.")
+		return nil, cursors{}, false
+	}
+	if s.graph.IsSuspended(userId) {
+		writeApiError(w, http.StatusForbidden, 63, "User has been suspended.")
+		return nil, cursors{}, false
+	}
+	if user.Protected != nil && *user.Protected {
+		writeJson(w, http.StatusUnauthorized, map[string]string{"request": r.URL.Path, "error": "Not authorized."})
+		return nil, cursors{}, false
+	}
+	return cursoredPage(w, q, list(userId), defaultSize, maxSize)
+}
+
+// cursoredPage returns ids on the page requested by cursor, errors are written to w.
+func cursoredPage(w http.ResponseWriter, q url.Values, ids []int64, defaultSize, maxSize int) ([]int64, cursors, bool) {
+	offset, ok := decodeCursor(q.Get("cursor"))
+	if !ok {
+		writeApiError(w, http.StatusBadRequest, 44, "cursor parameter is invalid.")
+		return nil, cursors{}, false
+	}
+	pageSize := defaultSize
+	if count, err := strconv.Atoi(q.Get("count")); err == nil && count > 0 {
+		pageSize = count
+	}
+	if pageSize > maxSize {
+		pageSize = maxSize
+	}
+
+	if offset > len(ids) {
+		offset = len(ids)
+	}
+	end := offset + pageSize
+	if end > len(ids) {
+		end = len(ids)
+	}
+	pageCursors := cursors{}
+	if end < len(ids) {
+		pageCursors.NextCursor = cursorBase + int64(end)
+	}
+	if offset > 0 {
+		pageCursors.PreviousCursor = -(cursorBase + int64(offset))
+	}
+	pageCursors.NextCursorStr = strconv.FormatInt(pageCursors.NextCursor, 10)
+	pageCursors.PreviousCursorStr = strconv.FormatInt(pageCursors.PreviousCursor, 10)
+	return ids[offset:end], pageCursors, true
+}
+
+func (s *Server) handleShowList(w http.ResponseWriter, r *http.Request) {
+	listId, _ := strconv.ParseInt(r.URL.Query().Get("list_id"), 10, 64)
+	list := s.graph.ListById(listId)
+	if list == nil {
+		writeApiError(w, http.StatusNotFound, 34, "Sorry, that page does not exist.")
+		return
+	}
+	writeJson(w, http.StatusOK, list)
+}
+
+// listUsers serves a cursored list of users related to a twitter list, e.g. its members, with their profiles.
+func (s *Server) listUsers(list func(listId int64) []int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		listId, _ := strconv.ParseInt(q.Get("list_id"), 10, 64)
+		if s.graph.ListById(listId) == nil {
+			writeApiError(w, http.StatusNotFound, 34, "Sorry, that page does not exist.")
+			return
+		}
+		ids, pageCursors, ok := cursoredPage(w, q, list(listId), defaultPageSize, maxIdsPageSize)
+		if !ok {
+			return
+		}
+		page := &usersPage{Users: make([]interface{}, 0, len(ids)), cursors: pageCursors}
+		for _, userId := range ids {
+			page.Users = append(page.Users, s.graph.UserById(userId))
+		}
+		writeJson(w, http.StatusOK, page)
+	}
+}
+
+func (s *Server) handleUsersLookup(w http.ResponseWriter, r *http.Request) {
+	idStrs := strings.Split(r.URL.Query().Get("user_id"), ",")
+	if len(idStrs) > maxLookupSize {
+		writeApiError(w, http.StatusForbidden, 18, "Too many terms specified in query.")
+		return
+	}
+	users := make([]interface{}, 0, len(idStrs))
+	for _, idStr := range idStrs {
+		userId, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		if user := s.graph.UserById(userId); user != nil && !s.graph.IsSuspended(userId) {
+			users = append(users, user)
+		}
+	}
+	if len(users) == 0 {
+		writeApiError(w, http.StatusNotFound, 17, "No user matches for specified terms.")
+		return
+	}
+	writeJson(w, http.StatusOK, users)
+}
+
+// decodeCursor returns the offset in the list the cursor points to, -1 or empty cursor is the start of the list.
+func decodeCursor(cursor string) (int, bool) {
+	if cursor == "" || cursor == "-1" {
+		return 0, true
+	}
+	value, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || value < cursorBase {
+		return 0, false
+	}
+	return int(value - cursorBase), true
+}
+
+func (s *Server) handleProfileTimeline(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/2/timeline/profile/"), ".json")
+	userId, err := strconv.ParseInt(idStr, 10, 64)
+	user := s.graph.UserById(userId)
+	if err != nil || user == nil {
+		writeApiError(w, http.StatusNotFound, 50, "User not found.")
+		return
+	}
+	if s.graph.IsSuspended(userId) {
+		writeApiError(w, http.StatusForbidden, 63, "User has been suspended.")
+		return
+	}
+	if user.Protected != nil && *user.Protected {
+		writeJson(w, http.StatusUnauthorized, map[string]string{"request": r.URL.Path, "error": "Not authorized."})
+		return
+	}
+	// tweets are ordered newest first
+	tweets := s.graph.Tweets(userId)
+	newestFirst := make([]*models.Tweet, 0, len(tweets))
+	for i := len(tweets) - 1; i >= 0; i-- {
+		newestFirst = append(newestFirst, tweets[i])
+	}
+	s.timelinePage(w, r, idStr, newestFirst)
+}
+
+// handleSearch serves tweets with text containing all words of the query, newest first. Operators since: and
+// until: limit the dates of tweets, at most SearchLimit tweets are found by a query.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var words []string
+	var since, until time.Time
+	for _, term := range strings.Fields(strings.ToLower(r.URL.Query().Get("q"))) {
+		var err error
+		switch {
+		case strings.HasPrefix(term, "since:"):
+			since, err = time.Parse("2006-01-02", strings.TrimPrefix(term, "since:"))
+		case strings.HasPrefix(term, "until:"):
+			until, err = time.Parse("2006-01-02", strings.TrimPrefix(term, "until:"))
+		default:
+			words = append(words, term)
+		}
+		if err != nil {
+			writeApiError(w, http.StatusBadRequest, 44, "q parameter is invalid.")
+			return
+		}
+	}
+
+	var found []*models.Tweet
+	for _, user := range s.graph.Users() {
+		if user.Protected != nil && *user.Protected || s.graph.IsSuspended(user.Id) {
+			continue
+		}
+	Tweets:
+		for _, tweet := range s.graph.Tweets(user.Id) {
+			createdAt, _ := time.Parse(time.RubyDate, tweet.CreatedAt)
+			if !since.IsZero() && createdAt.Before(since) || !until.IsZero() && !createdAt.Before(until) {
+				continue
+			}
+			text := strings.ToLower(tweet.FullText)
+			for _, word := range words {
+				if !strings.Contains(text, word) {
+					continue Tweets
+				}
+			}
+			found = append(found, tweet)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		createdI, _ := time.Parse(time.RubyDate, found[i].CreatedAt)
+		createdJ, _ := time.Parse(time.RubyDate, found[j].CreatedAt)
+		if !createdI.Equal(createdJ) {
+			return createdI.After(createdJ)
+		}
+		return found[i].Id > found[j].Id
+	})
+	if s.options.SearchLimit > 0 && len(found) > s.options.SearchLimit {
+		found = found[:s.options.SearchLimit]
+	}
+	s.timelinePage(w, r, "sq", found)
+}
+
+// timelinePage writes the page of tweets from the cursor of the request. Like twitter, the last page has got
+// no tweets but still has got cursors.
+func (s *Server) timelinePage(w http.ResponseWriter, r *http.Request, entryPrefix string, tweets []*models.Tweet) {
+	q := r.URL.Query()
+	offset, ok := decodeCursor(q.Get("cursor"))
+	if !ok {
+		writeApiError(w, http.StatusBadRequest, 44, "cursor parameter is invalid.")
+		return
+	}
+	pageSize := defaultPageSize
+	if count, err := strconv.Atoi(q.Get("count")); err == nil && count > 0 {
+		pageSize = count
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	if offset > len(tweets) {
+		offset = len(tweets)
+	}
+	end := offset + pageSize
+	if end > len(tweets) {
+		end = len(tweets)
+	}
+	pageTweets := make(map[string]*models.Tweet)
+	pageUsers := make(map[string]*models.User)
+	entries := make([]*twitter_api.TimelineEntry, 0, end-offset+2)
+	for _, tweet := range tweets[offset:end] {
+		pageTweets[tweet.IdStr] = tweet
+		pageUsers[tweet.UserIdStr] = s.graph.UserById(tweet.UserId)
+		entries = append(entries, &twitter_api.TimelineEntry{EntryId: "tweet-" + tweet.IdStr, SortIndex: tweet.IdStr})
+	}
+	topCursor := cursorEntry("cursor-top-"+entryPrefix, "Top", offset)
+	bottomCursor := cursorEntry("cursor-bottom-"+entryPrefix, twitter_api.CursorTypeBottom, end)
+	timeline := &twitter_api.Timeline{
+		GlobalObjects: twitter_api.GlobalObjects{
+			Tweets: pageTweets,
+			Users:  pageUsers,
+		},
+	}
+	if offset == 0 {
+		entries = append(entries, topCursor, bottomCursor)
+		timeline.Timeline.Instructions = []*twitter_api.TimelineInstruction{
+			{AddEntries: &twitter_api.AddEntries{Entries: entries}},
+		}
+	} else {
+		// like twitter, cursors of the next pages replace the ones of the first page
+		timeline.Timeline.Instructions = []*twitter_api.TimelineInstruction{
+			{AddEntries: &twitter_api.AddEntries{Entries: entries}},
+			{ReplaceEntry: &twitter_api.ReplaceEntry{EntryIdToReplace: topCursor.EntryId, Entry: topCursor}},
+			{ReplaceEntry: &twitter_api.ReplaceEntry{EntryIdToReplace: bottomCursor.EntryId, Entry: bottomCursor}},
+		}
+	}
+	writeJson(w, http.StatusOK, timeline)
+}
+
+func cursorEntry(entryId string, cursorType string, offset int) *twitter_api.TimelineEntry {
+	entry := &twitter_api.TimelineEntry{EntryId: entryId}
+	entry.Content.Operation = &twitter_api.EntryOperation{
+		Cursor: twitter_api.TimelineCursor{
+			Value:      strconv.FormatInt(cursorBase+int64(offset), 10),
+			CursorType: cursorType,
+		},
+	}
+	return entry
+}
@@ -1,13 +1,15 @@
 module github.com/scarecrow6977/twitter-crawler/crawler
 
-go 1.13
+go 1.16
 
 require (
 	github.com/hako/durafmt v0.0.0-20191009132224-3f39dc1ed9f4
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/lib/pq v1.3.0
+	github.com/mattn/go-sqlite3 v1.14.17
 	github.com/neo4j-drivers/gobolt v1.7.4 // indirect
 	github.com/neo4j/neo4j-go-driver v1.7.4
 	github.com/pkg/errors v0.9.1
+	github.com/stretchr/testify v1.9.0
 	gopkg.in/yaml.v2 v2.2.8
 )
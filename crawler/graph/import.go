@@ -123,3 +123,51 @@ func addFollowerTx(tx neo4j.Transaction, userId, followerId int64) error {
 	}
 	return nil
 }
+
+// interactionRelationships are neo4j relationship types of interactions, cypher can't take them as parameters.
+var interactionRelationships = map[models.InteractionType]string{
+	models.InteractionTypeRetweet: "RETWEETED",
+	models.InteractionTypeReply:   "REPLIED_TO",
+	models.InteractionTypeQuote:   "QUOTED",
+	models.InteractionTypeMention: "MENTIONED",
+}
+
+// ImportInteractions adds interactions as relationships between users next to FOLLOWS, one relationship
+// per tweet. Users missing in the graph are added with their ids only.
+func (importer *Neo4jImporter) ImportInteractions(interactions []*models.Interaction) error {
+	_, err := importer.session.WriteTransaction(func(tx neo4j.Transaction) (i interface{}, e error) {
+		for _, interaction := range interactions {
+			err := addInteractionTx(tx, interaction)
+			if err != nil {
+				return nil, errors.Wrapf(err, "add interaction to graph, userId=%d, targetUserId=%d, tweetId=%d",
+					interaction.UserId, interaction.TargetUserId, interaction.TweetId)
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func addInteractionTx(tx neo4j.Transaction, interaction *models.Interaction) error {
+	relationship, ok := interactionRelationships[interaction.Type]
+	if !ok {
+		return fmt.Errorf("unknown interaction type '%s'", interaction.Type)
+	}
+	_, err := tx.Run(
+		fmt.Sprintf(`MERGE (user:User { id: $user_id })
+				MERGE (target:User { id: $target_user_id })
+				MERGE (user)-[r:%s { tweet_id: $tweet_id }]->(target)
+				SET r.target_tweet_id = $target_tweet_id, r.created_at = $created_at`, relationship),
+		map[string]interface{}{
+			"user_id":         interaction.UserId,
+			"target_user_id":  interaction.TargetUserId,
+			"tweet_id":        interaction.TweetId,
+			"target_tweet_id": interaction.TargetTweetId,
+			"created_at":      interaction.CreatedAt.Unix(),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
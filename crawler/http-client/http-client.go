@@ -1,6 +1,239 @@
 package http_client
 
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	twitter_api "github.com/scarecrow6977/twitter-crawler/crawler/twitter-api"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoHealthyAccounts = errors.New("all twitter accounts are quarantined")
+
+// DefaultQuarantineDuration is how long an account rejected by twitter isn't used.
+const DefaultQuarantineDuration = time.Hour
+
+const requestTimeout = 10 * time.Second
+
+// defaultLimitWindow is used when twitter responds with 429 without rate limit headers.
+const defaultLimitWindow = 15 * time.Minute
+
+// HttpClient makes requests to twitter on behalf of a pool of accounts. Every request is made with
+// an account which isn't quarantined and has requests left in the rate limit window of the endpoint,
+// accounts are taken in turn. When twitter responds with 429 the request is repeated with the next
+// account, accounts rejected by twitter are quarantined. Requests go through proxies of the pool, if it's set.
 type HttpClient struct {
-	sessions	map[string]bool
+	accounts           []*TwitterAccount
+	next               int
+	limiter            *RateLimiter
+	proxies            *ProxyPool
+	directClient       *http.Client
+	quarantineDuration time.Duration
+	lock               sync.Mutex
+	*log.Logger
+}
+
+func NewHttpClient(accounts []*TwitterAccount, proxies *ProxyPool, quarantineDuration time.Duration) *HttpClient {
+	c := &HttpClient{
+		accounts: accounts,
+		limiter:  NewRateLimiter(),
+		proxies:  proxies,
+		directClient: &http.Client{
+			Timeout: requestTimeout,
+		},
+		quarantineDuration: quarantineDuration,
+	}
+	c.Logger = log.NewLogger("HttpClient")
+	return c
+}
+
+// Do sends req with one of the accounts. If every account is rate limited or rejected, the last response is returned.
+// When a request through tor is rate limited, the circuit of the tor instance is renewed. If twitter didn't report
+// the rate limit of the account, the limit is assumed to be of the exit node and the account is tried again.
+func (c *HttpClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	endpoint := endpointOf(req.URL)
+	tried := make(map[*TwitterAccount]bool)
+	renewed := make(map[*Proxy]bool)
+	var lastResp *http.Response
+	for {
+		account, err := c.acquireAccount(ctx, endpoint, tried)
+		if err != nil {
+			closeResponse(lastResp)
+			return nil, err
+		}
+		if account == nil {
+			if lastResp != nil {
+				return lastResp, nil
+			}
+			return nil, ErrNoHealthyAccounts
+		}
+		tried[account] = true
+
+		accountReq := req.Clone(ctx)
+		account.authorize(accountReq)
+		resp, proxy, err := c.send(accountReq, account)
+		if err != nil {
+			closeResponse(lastResp)
+			return nil, err
+		}
+		c.limiter.Update(account.CsrfToken(), endpoint, resp.Header)
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			accountLimited := resp.Header.Get(headerRateLimitReset) != ""
+			if proxy != nil && proxy.Tor != nil && !renewed[proxy] {
+				renewed[proxy] = true
+				err = proxy.Tor.NewCircuit(ctx)
+				if err != nil {
+					c.LogWarning("can't renew tor circuit of %s, err='%v'", proxy.Url.Host, err)
+				} else if !accountLimited {
+					delete(tried, account)
+				}
+			}
+			if !accountLimited && tried[account] {
+				c.limiter.Block(account.CsrfToken(), endpoint, time.Now().Add(defaultLimitWindow))
+			}
+			c.LogInfo("account '%s' is rate limited at %s", account.Name, endpoint)
+		case isAuthFailure(resp):
+			c.quarantine(account)
+		default:
+			closeResponse(lastResp)
+			return resp, nil
+		}
+		closeResponse(lastResp)
+		lastResp = resp
+	}
+}
+
+// endpointOf returns the endpoint rate limits of u are counted for. Ids in the path, like user id of
+// /2/timeline/profile/<id>.json, are replaced, so requests for different users share the window of the endpoint.
+func endpointOf(u *url.URL) string {
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		id := segment
+		ext := ""
+		if dot := strings.IndexByte(segment, '.'); dot != -1 {
+			id, ext = segment[:dot], segment[dot:]
+		}
+		if isNumeric(id) {
+			segments[i] = ":id" + ext
+		}
+	}
+	return u.Host + strings.Join(segments, "/")
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// send makes the request through the proxy picked for account, the proxy is nil if requests are made directly.
+func (c *HttpClient) send(req *http.Request, account *TwitterAccount) (*http.Response, *Proxy, error) {
+	if c.proxies == nil {
+		resp, err := c.directClient.Do(req)
+		return resp, nil, err
+	}
+	proxy, err := c.proxies.Pick(account.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := proxy.client.Do(req)
+	// requests cancelled by the crawler aren't failures of the proxy
+	if req.Context().Err() == nil {
+		c.proxies.Report(proxy, err)
+	}
+	return resp, proxy, err
+}
+
+// acquireAccount returns the next account which can make a request to endpoint, waiting for the rate limit
+// window to reset when all of them are limited. Nil is returned if there are no accounts left to try.
+func (c *HttpClient) acquireAccount(ctx context.Context, endpoint string, tried map[*TwitterAccount]bool) (*TwitterAccount, error) {
+	c.lock.Lock()
+	now := time.Now()
+	var limited *TwitterAccount
+	var earliestReset time.Time
+	for i := range c.accounts {
+		idx := (c.next + i) % len(c.accounts)
+		account := c.accounts[idx]
+		if tried[account] || now.Before(account.quarantinedUntil) {
+			continue
+		}
+		ok, reset := c.limiter.TryAcquire(account.CsrfToken(), endpoint)
+		if ok {
+			c.next = (idx + 1) % len(c.accounts)
+			c.lock.Unlock()
+			return account, nil
+		}
+		if limited == nil || reset.Before(earliestReset) {
+			limited, earliestReset = account, reset
+		}
+	}
+	c.lock.Unlock()
+
+	if limited == nil {
+		return nil, nil
+	}
+	err := c.limiter.Wait(ctx, limited.CsrfToken(), endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return limited, nil
+}
+
+func (c *HttpClient) quarantine(account *TwitterAccount) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	account.quarantinedUntil = time.Now().Add(c.quarantineDuration)
+	c.LogWarning("account '%s' is rejected by twitter, quarantined for %d minutes", account.Name, int(c.quarantineDuration.Minutes()))
+}
+
+type apiErrorsResponse struct {
+	Errors []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// isAuthFailure checks whether twitter rejected the session. The body of resp stays readable.
+func isAuthFailure(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	errResp := &apiErrorsResponse{}
+	if json.Unmarshal(body, errResp) != nil {
+		return false
+	}
+	for _, apiErr := range errResp.Errors {
+		if twitter_api.IsAuthErrorCode(apiErr.Code) {
+			return true
+		}
+	}
+	return false
+}
 
+func closeResponse(resp *http.Response) {
+	if resp != nil {
+		resp.Body.Close()
+	}
 }
@@ -0,0 +1,145 @@
+package http_client
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestAccount(t *testing.T, name string) *TwitterAccount {
+	account, err := NewTwitterAccount(name, map[string]string{"ct0": name}, map[string]string{"authorization": "Bearer " + name})
+	assert.NoError(t, err)
+	return account
+}
+
+// accountsServer responds to every account with the handler set for its csrf token and records
+// the order accounts are used in.
+type accountsServer struct {
+	handlers map[string]http.HandlerFunc
+	used     []string
+	lock     sync.Mutex
+}
+
+func (s *accountsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	csrfToken := r.Header.Get("x-csrf-token")
+	s.lock.Lock()
+	s.used = append(s.used, csrfToken)
+	s.lock.Unlock()
+	if handler, ok := s.handlers[csrfToken]; ok {
+		handler(w, r)
+	}
+}
+
+func get(t *testing.T, client *HttpClient, url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NoError(t, err)
+	return client.Do(req)
+}
+
+func TestHttpClient_RotatesAccounts(t *testing.T) {
+	server := &accountsServer{handlers: map[string]http.HandlerFunc{}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client := NewHttpClient([]*TwitterAccount{newTestAccount(t, "a"), newTestAccount(t, "b")}, nil, time.Hour)
+
+	for i := 0; i < 4; i++ {
+		resp, err := get(t, client, httpServer.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, []string{"a", "b", "a", "b"}, server.used)
+}
+
+func TestHttpClient_RotatesOnTooManyRequests(t *testing.T) {
+	server := &accountsServer{handlers: map[string]http.HandlerFunc{
+		"a": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		},
+	}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client := NewHttpClient([]*TwitterAccount{newTestAccount(t, "a"), newTestAccount(t, "b")}, nil, time.Hour)
+
+	resp, err := get(t, client, httpServer.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	resp, err = get(t, client, httpServer.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []string{"a", "b", "b"}, server.used, "rate limited account should not be used until the window is reset")
+
+	client = NewHttpClient([]*TwitterAccount{newTestAccount(t, "a")}, nil, time.Hour)
+	resp, err = get(t, client, httpServer.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "429 should be returned when all accounts are limited")
+	resp.Body.Close()
+}
+
+func TestHttpClient_SharesWindowOfEndpointForUsers(t *testing.T) {
+	server := &accountsServer{handlers: map[string]http.HandlerFunc{
+		"a": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerRateLimitRemaining, "0")
+			w.Header().Set(headerRateLimitReset, strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		},
+	}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client := NewHttpClient([]*TwitterAccount{newTestAccount(t, "a"), newTestAccount(t, "b")}, nil, time.Hour)
+
+	for _, userId := range []string{"1", "2", "3"} {
+		resp, err := get(t, client, httpServer.URL+"/2/timeline/profile/"+userId+".json")
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, []string{"a", "b", "b"}, server.used, "exhausted account should not be used for other users")
+	assert.Equal(t, 1, len(client.limiter.windows))
+}
+
+func TestHttpClient_QuarantinesRejectedAccounts(t *testing.T) {
+	server := &accountsServer{handlers: map[string]http.HandlerFunc{
+		"a": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errors":[{"code":89,"message":"Invalid or expired token."}]}`))
+		},
+		"b": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"request":"/1.1/followers/list.json","error":"Not authorized."}`))
+		},
+	}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client := NewHttpClient([]*TwitterAccount{newTestAccount(t, "a"), newTestAccount(t, "b")}, nil, time.Hour)
+
+	resp, err := get(t, client, httpServer.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "private profile response should be returned as is")
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "Not authorized")
+	resp.Body.Close()
+
+	resp, err = get(t, client, httpServer.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []string{"a", "b", "b"}, server.used, "rejected account should be quarantined")
+
+	client = NewHttpClient([]*TwitterAccount{newTestAccount(t, "a")}, nil, time.Hour)
+	resp, err = get(t, client, httpServer.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	_, err = get(t, client, httpServer.URL)
+	assert.Equal(t, ErrNoHealthyAccounts, err)
+}
+
+func TestNewTwitterAccount_RequiresCredentials(t *testing.T) {
+	_, err := NewTwitterAccount("a", map[string]string{}, map[string]string{"authorization": ""})
+	assert.Error(t, err)
+	_, err = NewTwitterAccount("a", map[string]string{"ct0": ""}, map[string]string{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,243 @@
+package http_client
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var ErrNoProxies = errors.New("all proxies are evicted")
+
+const (
+	defaultMaxProxyFailures    = 5
+	defaultHealthCheckUrl      = "https://api.twitter.com/"
+	defaultHealthCheckInterval = time.Minute
+	healthCheckTimeout         = 10 * time.Second
+)
+
+// Proxy is an egress of the crawler, requests through it are counted to weight it by success rate.
+// Proxies of tor instances have the controller which renews their circuits.
+type Proxy struct {
+	Url    *url.URL
+	Tor    *TorController
+	client *http.Client
+
+	// guarded by the lock of ProxyPool
+	successes           int64
+	failures            int64
+	consecutiveFailures int
+	evicted             bool
+}
+
+func newProxy(rawUrl string) (*Proxy, error) {
+	proxyUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse proxy url '%s'", rawUrl)
+	}
+	switch proxyUrl.Scheme {
+	case "socks5", "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported scheme of proxy '%s', should be socks5, http or https", rawUrl)
+	}
+	return &Proxy{
+		Url: proxyUrl,
+		client: &http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyURL(proxyUrl)},
+			Timeout:   requestTimeout,
+		},
+	}, nil
+}
+
+// weight is the success rate of the proxy, new proxies start at 0.5.
+func (p *Proxy) weight() float64 {
+	return float64(p.successes+1) / float64(p.successes+p.failures+2)
+}
+
+// ProxyPool spreads requests over proxies in proportion to their success rate. Proxies failed
+// maxFailures times in a row are evicted until a health check finds them working again.
+// With pinAccounts every account makes all its requests through the same proxy while it's alive.
+type ProxyPool struct {
+	proxies        []*Proxy
+	pins           map[string]*Proxy
+	pinAccounts    bool
+	maxFailures    int
+	healthCheckUrl string
+	lock           sync.Mutex
+	*log.Logger
+}
+
+func NewProxyPool(urls []string, maxFailures int, pinAccounts bool, healthCheckUrl string) (*ProxyPool, error) {
+	if maxFailures <= 0 {
+		maxFailures = defaultMaxProxyFailures
+	}
+	if healthCheckUrl == "" {
+		healthCheckUrl = defaultHealthCheckUrl
+	}
+	p := &ProxyPool{
+		pins:           make(map[string]*Proxy),
+		pinAccounts:    pinAccounts,
+		maxFailures:    maxFailures,
+		healthCheckUrl: healthCheckUrl,
+	}
+	p.Logger = log.NewLogger("ProxyPool")
+	for _, rawUrl := range urls {
+		proxy, err := newProxy(rawUrl)
+		if err != nil {
+			return nil, err
+		}
+		p.proxies = append(p.proxies, proxy)
+	}
+	return p, nil
+}
+
+// NewProxyPoolFromConfig creates the pool set in config, nil is returned if no proxies are set,
+// then requests are made directly. Every tor instance is a separate proxy.
+func NewProxyPoolFromConfig(config conf.ProxyPoolConfig) (*ProxyPool, error) {
+	if len(config.Proxies) == 0 && len(config.Tor) == 0 {
+		return nil, nil
+	}
+	p, err := NewProxyPool(config.Proxies, config.MaxFailures, config.PinAccounts, config.HealthCheckUrl)
+	if err != nil {
+		return nil, err
+	}
+	newCircuitWait := time.Duration(config.NewCircuitWait) * time.Second
+	for _, torConfig := range config.Tor {
+		controller := NewTorController(torConfig.Control, torConfig.Password, torConfig.CookieFile, newCircuitWait)
+		err = p.AddTorInstance(torConfig.Socks, controller)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// AddTorInstance adds the socks proxy of a tor instance, controller is used to renew its circuits.
+func (p *ProxyPool) AddTorInstance(socksUrl string, controller *TorController) error {
+	proxy, err := newProxy(socksUrl)
+	if err != nil {
+		return err
+	}
+	proxy.Tor = controller
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.proxies = append(p.proxies, proxy)
+	return nil
+}
+
+// Pick returns the proxy for the next request of account.
+func (p *ProxyPool) Pick(account string) (*Proxy, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.pinAccounts {
+		if proxy, ok := p.pins[account]; ok && !proxy.evicted {
+			return proxy, nil
+		}
+	}
+	var total float64
+	for _, proxy := range p.proxies {
+		if !proxy.evicted {
+			total += proxy.weight()
+		}
+	}
+	if total == 0 {
+		return nil, ErrNoProxies
+	}
+	var picked *Proxy
+	point := rand.Float64() * total
+	for _, proxy := range p.proxies {
+		if proxy.evicted {
+			continue
+		}
+		picked = proxy
+		point -= proxy.weight()
+		if point < 0 {
+			break
+		}
+	}
+	if p.pinAccounts {
+		p.pins[account] = picked
+	}
+	return picked, nil
+}
+
+// Report counts the result of a request made through proxy, err is the error of the transport.
+func (p *ProxyPool) Report(proxy *Proxy, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if err == nil {
+		proxy.successes++
+		proxy.consecutiveFailures = 0
+		return
+	}
+	proxy.failures++
+	proxy.consecutiveFailures++
+	if !proxy.evicted && proxy.consecutiveFailures >= p.maxFailures {
+		proxy.evicted = true
+		p.LogWarning("proxy %s is evicted after %d failures in a row, last error: %v", proxy.Url.Host, proxy.consecutiveFailures, err)
+	}
+}
+
+// HealthCheck makes a request through every proxy, evicted proxies which respond are returned to the pool.
+func (p *ProxyPool) HealthCheck(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, proxy := range p.proxies {
+		wg.Add(1)
+		go func(proxy *Proxy) {
+			defer wg.Done()
+			err := p.check(ctx, proxy)
+			p.Report(proxy, err)
+			if err == nil {
+				p.revive(proxy)
+			}
+		}(proxy)
+	}
+	wg.Wait()
+}
+
+func (p *ProxyPool) check(ctx context.Context, proxy *Proxy) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "HEAD", p.healthCheckUrl, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := proxy.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (p *ProxyPool) revive(proxy *Proxy) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if proxy.evicted {
+		proxy.evicted = false
+		p.LogInfo("proxy %s is healthy again", proxy.Url.Host)
+	}
+}
+
+// RunHealthChecks checks proxies every interval until ctx is done.
+func (p *ProxyPool) RunHealthChecks(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.HealthCheck(ctx)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package http_client
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestProxy starts an http proxy which answers requests itself instead of forwarding them.
+func newTestProxy(requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+	}))
+}
+
+func TestNewProxyPool_Schemes(t *testing.T) {
+	_, err := NewProxyPool([]string{"socks5://127.0.0.1:9050", "http://127.0.0.1:3128", "https://127.0.0.1:3129"}, 0, false, "")
+	assert.NoError(t, err)
+	_, err = NewProxyPool([]string{"ftp://127.0.0.1:21"}, 0, false, "")
+	assert.Error(t, err)
+}
+
+func TestProxyPool_PinsAccounts(t *testing.T) {
+	pool, err := NewProxyPool([]string{"http://127.0.0.1:1", "http://127.0.0.1:2", "http://127.0.0.1:3"}, 0, true, "")
+	assert.NoError(t, err)
+	proxy, err := pool.Pick("a")
+	assert.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		picked, err := pool.Pick("a")
+		assert.NoError(t, err)
+		assert.Equal(t, proxy, picked)
+	}
+
+	for i := 0; i < defaultMaxProxyFailures; i++ {
+		pool.Report(proxy, errors.New("connection refused"))
+	}
+	picked, err := pool.Pick("a")
+	assert.NoError(t, err)
+	assert.NotEqual(t, proxy, picked, "account should be pinned to another proxy when its proxy is evicted")
+}
+
+func TestProxyPool_WeightsBySuccess(t *testing.T) {
+	pool, err := NewProxyPool([]string{"http://127.0.0.1:1", "http://127.0.0.1:2"}, 1000, false, "")
+	assert.NoError(t, err)
+	good, bad := pool.proxies[0], pool.proxies[1]
+	for i := 0; i < 100; i++ {
+		pool.Report(good, nil)
+		pool.Report(bad, errors.New("timeout"))
+	}
+	goodPicks := 0
+	for i := 0; i < 1000; i++ {
+		proxy, err := pool.Pick("a")
+		assert.NoError(t, err)
+		if proxy == good {
+			goodPicks++
+		}
+	}
+	assert.True(t, goodPicks > 900, "successful proxy should be picked more often, picked %d of 1000", goodPicks)
+}
+
+func TestProxyPool_EvictsAndRevives(t *testing.T) {
+	var requests int32
+	proxyServer := newTestProxy(&requests)
+	defer proxyServer.Close()
+	pool, err := NewProxyPool([]string{proxyServer.URL}, 2, false, "http://twitter.test/")
+	assert.NoError(t, err)
+	proxy := pool.proxies[0]
+
+	pool.Report(proxy, errors.New("timeout"))
+	_, err = pool.Pick("a")
+	assert.NoError(t, err, "proxy should not be evicted after a single failure")
+	pool.Report(proxy, errors.New("timeout"))
+	_, err = pool.Pick("a")
+	assert.Equal(t, ErrNoProxies, err)
+
+	pool.HealthCheck(context.Background())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	picked, err := pool.Pick("a")
+	assert.NoError(t, err)
+	assert.Equal(t, proxy, picked, "proxy passed health check should be returned to the pool")
+}
+
+func TestHttpClient_UsesProxies(t *testing.T) {
+	var requests int32
+	proxyServer := newTestProxy(&requests)
+	defer proxyServer.Close()
+	pool, err := NewProxyPool([]string{proxyServer.URL}, 0, true, "")
+	assert.NoError(t, err)
+	client := NewHttpClient([]*TwitterAccount{newTestAccount(t, "a")}, pool, time.Hour)
+
+	resp, err := get(t, client, "http://twitter.test/1.1/followers/list.json")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	assert.Equal(t, int64(1), pool.proxies[0].successes)
+}
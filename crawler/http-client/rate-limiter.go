@@ -0,0 +1,137 @@
+package http_client
+
+import (
+	"context"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	headerRateLimitLimit     = "x-rate-limit-limit"
+	headerRateLimitRemaining = "x-rate-limit-remaining"
+	headerRateLimitReset     = "x-rate-limit-reset"
+)
+
+// resetSlack is added to the reset time reported by twitter, so clock skew doesn't cause a 429.
+const resetSlack = time.Second
+
+type rateLimitKey struct {
+	credential string
+	endpoint   string
+}
+
+type rateLimitWindow struct {
+	// limit is the number of requests in a window, 0 if it's unknown
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// RateLimiter keeps the rate limit state of every credential and endpoint, as reported by
+// x-rate-limit-* headers of responses, and makes requests wait for the next window when
+// the current one is exhausted. It's shared by all workers of the process.
+type RateLimiter struct {
+	windows map[rateLimitKey]*rateLimitWindow
+	lock    sync.Mutex
+	*log.Logger
+}
+
+func NewRateLimiter() *RateLimiter {
+	l := &RateLimiter{
+		windows: make(map[rateLimitKey]*rateLimitWindow),
+	}
+	l.Logger = log.NewLogger("RateLimiter")
+	return l
+}
+
+// TryAcquire counts a request with credential to endpoint in the current window if the limit isn't
+// exceeded yet, otherwise it returns the time the window is reset at. Requests with unknown limits are allowed.
+// When the window with known limit is over, the next one is started at its full capacity, so requests made
+// before twitter reports the new window don't exceed it.
+func (l *RateLimiter) TryAcquire(credential, endpoint string) (ok bool, reset time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	window, found := l.windows[rateLimitKey{credential: credential, endpoint: endpoint}]
+	if !found {
+		return true, time.Time{}
+	}
+	if !now.Before(window.reset) {
+		if window.limit == 0 {
+			return true, time.Time{}
+		}
+		window.remaining = window.limit
+		window.reset = now.Add(defaultLimitWindow)
+	}
+	if window.remaining > 0 {
+		window.remaining--
+		return true, time.Time{}
+	}
+	return false, window.reset
+}
+
+// Wait blocks until a request with credential to endpoint can be made without exceeding the rate limit,
+// the request is counted in the current window.
+func (l *RateLimiter) Wait(ctx context.Context, credential, endpoint string) error {
+	for {
+		ok, reset := l.TryAcquire(credential, endpoint)
+		if ok {
+			return nil
+		}
+		wait := time.Until(reset)
+		l.LogInfo("limit of requests to %s is reached, waiting for %d seconds", endpoint, int(wait.Seconds()))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Block forbids requests with credential to endpoint until the given time, it's used when
+// twitter reports the limit is reached without rate limit headers.
+func (l *RateLimiter) Block(credential, endpoint string, until time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.windows[rateLimitKey{credential: credential, endpoint: endpoint}] = &rateLimitWindow{reset: until}
+}
+
+// Update sets the rate limit state of credential and endpoint from response headers.
+// Remaining requests over the limit of the window are not trusted.
+func (l *RateLimiter) Update(credential, endpoint string, header http.Header) {
+	remaining, err := strconv.Atoi(header.Get(headerRateLimitRemaining))
+	if err != nil {
+		return
+	}
+	resetUnix, err := strconv.ParseInt(header.Get(headerRateLimitReset), 10, 64)
+	if err != nil {
+		return
+	}
+	reset := time.Unix(resetUnix, 0).Add(resetSlack)
+	limit, err := strconv.Atoi(header.Get(headerRateLimitLimit))
+	if err != nil || limit < 0 {
+		limit = 0
+	}
+	if limit > 0 && remaining > limit {
+		remaining = limit
+	}
+
+	key := rateLimitKey{credential: credential, endpoint: endpoint}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	window, ok := l.windows[key]
+	if ok && window.reset.Equal(reset) && window.remaining < remaining {
+		// requests counted by Wait may be still in flight, they aren't counted by twitter yet
+		remaining = window.remaining
+	}
+	l.windows[key] = &rateLimitWindow{
+		limit:     limit,
+		remaining: remaining,
+		reset:     reset,
+	}
+}
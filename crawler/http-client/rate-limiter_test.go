@@ -0,0 +1,74 @@
+package http_client
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func rateLimitHeader(limit, remaining int, reset time.Time) http.Header {
+	header := http.Header{}
+	header.Set(headerRateLimitLimit, strconv.Itoa(limit))
+	header.Set(headerRateLimitRemaining, strconv.Itoa(remaining))
+	header.Set(headerRateLimitReset, strconv.FormatInt(reset.Unix(), 10))
+	return header
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	limiter := NewRateLimiter()
+	ctx := context.Background()
+	assert.NoError(t, limiter.Wait(ctx, "a", "followers"), "unknown limits should not delay requests")
+
+	limiter.Update("a", "followers", rateLimitHeader(15, 2, time.Now().Add(time.Hour)))
+	assert.NoError(t, limiter.Wait(ctx, "a", "followers"))
+	assert.NoError(t, limiter.Wait(ctx, "a", "followers"))
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, limiter.Wait(timeoutCtx, "a", "followers"), "window should be exhausted")
+
+	assert.NoError(t, limiter.Wait(ctx, "b", "followers"), "other credentials should not be limited")
+	assert.NoError(t, limiter.Wait(ctx, "a", "show"), "other endpoints should not be limited")
+}
+
+func TestRateLimiter_UpdateKeepsInFlightRequests(t *testing.T) {
+	limiter := NewRateLimiter()
+	reset := time.Now().Add(time.Hour)
+	limiter.Update("a", "followers", rateLimitHeader(15, 1, reset))
+	assert.NoError(t, limiter.Wait(context.Background(), "a", "followers"))
+	// response to an earlier request still reports the request counted by Wait as remaining
+	limiter.Update("a", "followers", rateLimitHeader(15, 1, reset))
+
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, limiter.Wait(timeoutCtx, "a", "followers"))
+}
+
+func TestRateLimiter_WaitsForReset(t *testing.T) {
+	limiter := NewRateLimiter()
+	limiter.Update("a", "followers", rateLimitHeader(15, 0, time.Now().Add(-resetSlack/2)))
+	start := time.Now()
+	assert.NoError(t, limiter.Wait(context.Background(), "a", "followers"))
+	assert.True(t, time.Since(start) < 2*resetSlack, "request should be made when the window is reset")
+}
+
+func TestRateLimiter_Limit(t *testing.T) {
+	limiter := NewRateLimiter()
+	limiter.Update("a", "followers", rateLimitHeader(2, 100, time.Now().Add(time.Hour)))
+	assert.NoError(t, limiter.Wait(context.Background(), "a", "followers"))
+	assert.NoError(t, limiter.Wait(context.Background(), "a", "followers"))
+	ok, _ := limiter.TryAcquire("a", "followers")
+	assert.False(t, ok, "remaining requests should not exceed the limit")
+
+	limiter.Update("a", "show", rateLimitHeader(2, 0, time.Now().Add(-resetSlack-time.Second)))
+	for i := 0; i < 2; i++ {
+		ok, _ = limiter.TryAcquire("a", "show")
+		assert.True(t, ok)
+	}
+	ok, reset := limiter.TryAcquire("a", "show")
+	assert.False(t, ok, "new window should start with the limit of the previous one")
+	assert.True(t, reset.After(time.Now().Add(defaultLimitWindow-time.Minute)))
+}
@@ -0,0 +1,143 @@
+package http_client
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultNewCircuitWait is the time given to tor to switch to new circuits, tor also
+// ignores NEWNYM signals sent more often than that.
+const DefaultNewCircuitWait = 10 * time.Second
+
+// TorController talks to the control port of a tor instance to renew its circuits, so requests
+// through the instance come from a new exit node. It authenticates with the password or the
+// auth cookie file, if they are set.
+type TorController struct {
+	address        string
+	password       string
+	cookieFile     string
+	newCircuitWait time.Duration
+
+	lock       sync.Mutex
+	lastNewnym time.Time
+	*log.Logger
+}
+
+func NewTorController(address, password, cookieFile string, newCircuitWait time.Duration) *TorController {
+	if newCircuitWait <= 0 {
+		newCircuitWait = DefaultNewCircuitWait
+	}
+	c := &TorController{
+		address:        address,
+		password:       password,
+		cookieFile:     cookieFile,
+		newCircuitWait: newCircuitWait,
+	}
+	c.Logger = log.NewLogger(fmt.Sprintf("TorController %s", address))
+	return c
+}
+
+// NewCircuit sends SIGNAL NEWNYM and waits for tor to build new circuits. Concurrent calls
+// share a single signal.
+func (c *TorController) NewCircuit(ctx context.Context) error {
+	c.lock.Lock()
+	ready := c.lastNewnym.Add(c.newCircuitWait)
+	if time.Now().After(ready) {
+		err := c.signalNewnym(ctx)
+		if err != nil {
+			c.lock.Unlock()
+			return err
+		}
+		c.lastNewnym = time.Now()
+		ready = c.lastNewnym.Add(c.newCircuitWait)
+		c.LogInfo("new circuit requested")
+	}
+	c.lock.Unlock()
+
+	timer := time.NewTimer(time.Until(ready))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *TorController) signalNewnym(ctx context.Context) error {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return errors.Wrap(err, "connect to tor control port")
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(healthCheckTimeout))
+	}
+
+	authCmd, err := c.authenticateCommand()
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	for _, cmd := range []string{authCmd, "SIGNAL NEWNYM"} {
+		err = sendControlCommand(conn, reader, cmd)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprint(conn, "QUIT\r\n")
+	return nil
+}
+
+func (c *TorController) authenticateCommand() (string, error) {
+	switch {
+	case c.password != "":
+		escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+		return fmt.Sprintf(`AUTHENTICATE "%s"`, escaper.Replace(c.password)), nil
+	case c.cookieFile != "":
+		cookie, err := ioutil.ReadFile(c.cookieFile)
+		if err != nil {
+			return "", errors.Wrap(err, "read tor auth cookie")
+		}
+		return "AUTHENTICATE " + hex.EncodeToString(cookie), nil
+	default:
+		return "AUTHENTICATE", nil
+	}
+}
+
+// sendControlCommand sends cmd and reads the reply, replies other than 250 are returned as errors.
+func sendControlCommand(conn net.Conn, reader *bufio.Reader, cmd string) error {
+	_, err := fmt.Fprintf(conn, "%s\r\n", cmd)
+	if err != nil {
+		return errors.Wrap(err, "write to tor control port")
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return errors.Wrap(err, "read from tor control port")
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) < 4 {
+			return fmt.Errorf("bad reply from tor control port: '%s'", line)
+		}
+		if !strings.HasPrefix(line, "250") {
+			return fmt.Errorf("tor control port: %s", line)
+		}
+		// "250-" and "250+" start multi line replies, "250 " ends them
+		if line[3] == ' ' {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package http_client
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeControlPort speaks enough of the tor control protocol to authenticate and count NEWNYM signals.
+type fakeControlPort struct {
+	listener net.Listener
+	authLine string
+	newnyms  int32
+	wg       sync.WaitGroup
+}
+
+func newFakeControlPort(t *testing.T, authLine string) *fakeControlPort {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := &fakeControlPort{listener: listener, authLine: authLine}
+	port.wg.Add(1)
+	go port.serve()
+	return port
+}
+
+func (p *fakeControlPort) Address() string {
+	return p.listener.Addr().String()
+}
+
+func (p *fakeControlPort) Close() {
+	p.listener.Close()
+	p.wg.Wait()
+}
+
+func (p *fakeControlPort) serve() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.handle(conn)
+	}
+}
+
+func (p *fakeControlPort) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "AUTHENTICATE"):
+			if line != p.authLine {
+				fmt.Fprint(conn, "515 Authentication failed: Password did not match HashedControlPassword value from configuration\r\n")
+				return
+			}
+			authenticated = true
+			fmt.Fprint(conn, "250 OK\r\n")
+		case !authenticated:
+			fmt.Fprint(conn, "514 Authentication required.\r\n")
+			return
+		case line == "SIGNAL NEWNYM":
+			atomic.AddInt32(&p.newnyms, 1)
+			fmt.Fprint(conn, "250 OK\r\n")
+		case line == "QUIT":
+			fmt.Fprint(conn, "250 closing connection\r\n")
+			return
+		default:
+			fmt.Fprint(conn, "510 Unrecognized command\r\n")
+		}
+	}
+}
+
+func TestTorController_PasswordAuth(t *testing.T) {
+	port := newFakeControlPort(t, `AUTHENTICATE "se\"cret"`)
+	defer port.Close()
+
+	controller := NewTorController(port.Address(), `se"cret`, "", 10*time.Millisecond)
+	assert.NoError(t, controller.NewCircuit(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&port.newnyms))
+
+	controller = NewTorController(port.Address(), "wrong", "", 10*time.Millisecond)
+	err := controller.NewCircuit(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "515")
+}
+
+func TestTorController_CookieAuth(t *testing.T) {
+	cookie := []byte("0123456789abcdef0123456789abcdef")
+	cookieFile, err := ioutil.TempFile("", "control_auth_cookie")
+	assert.NoError(t, err)
+	defer os.Remove(cookieFile.Name())
+	cookieFile.Write(cookie)
+	cookieFile.Close()
+
+	port := newFakeControlPort(t, "AUTHENTICATE "+hex.EncodeToString(cookie))
+	defer port.Close()
+
+	controller := NewTorController(port.Address(), "", cookieFile.Name(), 10*time.Millisecond)
+	assert.NoError(t, controller.NewCircuit(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&port.newnyms))
+}
+
+func TestTorController_SharesSignal(t *testing.T) {
+	port := newFakeControlPort(t, "AUTHENTICATE")
+	defer port.Close()
+
+	controller := NewTorController(port.Address(), "", "", 100*time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, controller.NewCircuit(context.Background()))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&port.newnyms), "concurrent renewals should send a single signal")
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, controller.NewCircuit(context.Background()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&port.newnyms))
+}
+
+func TestHttpClient_RenewsTorCircuitOnTooManyRequests(t *testing.T) {
+	port := newFakeControlPort(t, "AUTHENTICATE")
+	defer port.Close()
+	var requests int32
+	// the socks port of tor is replaced by an http proxy, which limits the first request by exit node
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer proxyServer.Close()
+
+	pool, err := NewProxyPool(nil, 0, true, "")
+	assert.NoError(t, err)
+	assert.NoError(t, pool.AddTorInstance(proxyServer.URL, NewTorController(port.Address(), "", "", 10*time.Millisecond)))
+	client := NewHttpClient([]*TwitterAccount{newTestAccount(t, "a")}, pool, time.Hour)
+
+	resp, err := get(t, client, "http://twitter.test/1.1/followers/list.json")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "request should be repeated through the new circuit")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&port.newnyms))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
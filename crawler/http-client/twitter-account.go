@@ -1,5 +1,89 @@
 package http_client
 
+import (
+	"fmt"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"net/http"
+	"time"
+)
+
+var requiredCookies = []string{
+	"ct0",
+}
+
+var requiredHeaders = []string{
+	"authorization",
+}
+
+// TwitterAccount is a logged in twitter session: its cookies, including ct0 which is sent
+// as csrf token, and headers, including authorization.
 type TwitterAccount struct {
+	Name    string
+	cookies map[string]string
+	headers map[string]string
+
+	// quarantinedUntil is set when twitter rejects the session, guarded by the lock of HttpClient.
+	quarantinedUntil time.Time
+}
+
+func NewTwitterAccount(name string, cookies, headers map[string]string) (*TwitterAccount, error) {
+	for _, cookie := range requiredCookies {
+		if _, ok := cookies[cookie]; !ok {
+			return nil, fmt.Errorf("not all of required cookies are set for account '%s', should be set %v", name, requiredCookies)
+		}
+	}
+	for _, header := range requiredHeaders {
+		if _, ok := headers[header]; !ok {
+			return nil, fmt.Errorf("not all of required headers are set for account '%s', should be set %v", name, requiredHeaders)
+		}
+	}
+	return &TwitterAccount{
+		Name:    name,
+		cookies: cookies,
+		headers: headers,
+	}, nil
+}
+
+// NewTwitterAccounts creates accounts listed in config. Cookies and headers set at the top level
+// of config are used as a single default account when no accounts are listed.
+func NewTwitterAccounts(config *conf.MasterConfig) ([]*TwitterAccount, error) {
+	if len(config.Accounts) == 0 {
+		account, err := NewTwitterAccount("default", config.Cookies, config.Headers)
+		if err != nil {
+			return nil, err
+		}
+		return []*TwitterAccount{account}, nil
+	}
+	accounts := make([]*TwitterAccount, 0, len(config.Accounts))
+	for i, accountConfig := range config.Accounts {
+		name := accountConfig.Name
+		if name == "" {
+			name = fmt.Sprintf("account %d", i)
+		}
+		account, err := NewTwitterAccount(name, accountConfig.Cookies, accountConfig.Headers)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+// CsrfToken identifies the session, rate limits are counted for it.
+func (a *TwitterAccount) CsrfToken() string {
+	return a.cookies["ct0"]
+}
 
+// authorize sets cookies and headers of the session to req. Preflight requests get cookies only.
+func (a *TwitterAccount) authorize(req *http.Request) {
+	for name, value := range a.cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	if req.Method == "OPTIONS" {
+		return
+	}
+	for name, value := range a.headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("x-csrf-token", a.CsrfToken())
 }
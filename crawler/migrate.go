@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	pg_storage "github.com/scarecrow6977/twitter-crawler/crawler/storage/pg-storage"
+)
+
+// Migrate: shows the status of schema migrations of the database, applies them with up or reverts them with down.
+// Databases created before migrations are migrated by up too, migrations keep their tables and data.
+func main() {
+	var configPath string
+	var steps int
+	flag.StringVar(&configPath, "config", "config.yaml", "path to the config file")
+	flag.IntVar(&steps, "steps", 0, "number of migrations to apply or revert, all for up and one for down by default")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: migrate [flags] status|up|down\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		return
+	}
+
+	conf.Init(configPath)
+	config, err := conf.LoadConfig()
+	if err != nil {
+		fmt.Printf("can't load config, err='%v'", err)
+		return
+	}
+	log.SetVerbosityLevel(2)
+
+	migrator, err := pg_storage.NewMigrator(config.PostgresAccess)
+	if err != nil {
+		log.LogError("can't connect to storage, err='%v'", err)
+		return
+	}
+	defer migrator.Close()
+	ctx := context.Background()
+
+	switch flag.Arg(0) {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.LogError("can't get status of migrations, err='%v'", err)
+			return
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+	case "up":
+		applied, err := migrator.Up(ctx, steps)
+		for _, migration := range applied {
+			log.LogInfo("Migration %04d '%s' applied", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.LogError("can't migrate up, err='%v'", err)
+			return
+		}
+		log.LogInfo("Schema is up to date.")
+	case "down":
+		if steps == 0 {
+			steps = 1
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			log.LogInfo("Migration %04d '%s' reverted", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.LogError("can't migrate down, err='%v'", err)
+			return
+		}
+	default:
+		flag.Usage()
+	}
+}
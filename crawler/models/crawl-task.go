@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+const (
+	CrawlTaskPending = "pending"
+	CrawlTaskLeased  = "leased"
+	CrawlTaskDone    = "done"
+	CrawlTaskDead    = "dead"
+)
+
+const (
+	TaskTypeDownloadFollowers   = "download_followers"
+	TaskTypeDownloadFollowerIds = "download_follower_ids"
+	TaskTypeDownloadFriends     = "download_friends"
+	TaskTypeHydrateUsers        = "hydrate_users"
+	TaskTypeDownloadTweets      = "download_tweets"
+	TaskTypeSearchTweets        = "search_tweets"
+	TaskTypeDownloadList        = "download_list"
+)
+
+// CrawlTask is a task saved in the persistent task queue. Key identifies the work to be done,
+// only one task with the same type and key can be pending or leased at a time.
+type CrawlTask struct {
+	Id             int64      `db:"id"`
+	Type           string     `db:"task_type"`
+	Key            string     `db:"task_key"`
+	Payload        string     `db:"payload"`
+	State          string     `db:"state"`
+	Priority       int        `db:"priority"`
+	Attempts       int        `db:"attempts"`
+	LeaseOwner     *string    `db:"lease_owner"`
+	LeaseExpiresAt *time.Time `db:"lease_expires_at"`
+	LastError      *string    `db:"last_error"`
+	AvailableAt    time.Time  `db:"available_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at"`
+}
+
+// DeadCrawlTask is a record of the dead-letter table about a task which failed more times than
+// its retry policy allows. The task itself stays in the queue in dead state until it's re-driven.
+type DeadCrawlTask struct {
+	Id         int64     `db:"id"`
+	TaskId     int64     `db:"task_id"`
+	Type       string    `db:"task_type"`
+	Key        string    `db:"task_key"`
+	Attempts   int       `db:"attempts"`
+	ErrorClass string    `db:"error_class"`
+	LastError  string    `db:"last_error"`
+	FailedAt   time.Time `db:"failed_at"`
+}
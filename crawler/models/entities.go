@@ -0,0 +1,153 @@
+package models
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Entities are parts of tweet text parsed by twitter. Extended entities of a tweet have got all its media,
+// the plain ones only the first photo.
+type Entities struct {
+	Hashtags     []*Hashtag     `json:"hashtags"`
+	Urls         []*Url         `json:"urls"`
+	UserMentions []*UserMention `json:"user_mentions"`
+	Media        []*Media       `json:"media"`
+}
+
+type Hashtag struct {
+	Text    string `json:"text"`
+	Indices []int  `json:"indices"`
+}
+
+type Url struct {
+	Url         string `json:"url"`
+	ExpandedUrl string `json:"expanded_url"`
+	Indices     []int  `json:"indices"`
+}
+
+type UserMention struct {
+	IdStr      string `json:"id_str"`
+	ScreenName string `json:"screen_name"`
+	Indices    []int  `json:"indices"`
+}
+
+type Media struct {
+	IdStr         string `json:"id_str"`
+	Type          string `json:"type"`
+	MediaUrlHttps string `json:"media_url_https"`
+	ExtAltText    string `json:"ext_alt_text"`
+}
+
+// TweetHashtag, TweetUrl, TweetMention and TweetMedia are rows of normalized entity tables,
+// Start and End are the indices of the entity in tweet text.
+type TweetHashtag struct {
+	TweetId int64  `db:"tweet_id"`
+	Tag     string `db:"tag"`
+	Start   int    `db:"start_index"`
+	End     int    `db:"end_index"`
+}
+
+type TweetUrl struct {
+	TweetId     int64  `db:"tweet_id"`
+	Url         string `db:"url"`
+	ExpandedUrl string `db:"expanded_url"`
+	Domain      string `db:"domain"`
+	Start       int    `db:"start_index"`
+	End         int    `db:"end_index"`
+}
+
+type TweetMention struct {
+	TweetId    int64  `db:"tweet_id"`
+	UserId     int64  `db:"user_id"`
+	ScreenName string `db:"screen_name"`
+	Start      int    `db:"start_index"`
+	End        int    `db:"end_index"`
+}
+
+type TweetMedia struct {
+	TweetId  int64  `db:"tweet_id"`
+	MediaId  int64  `db:"media_id"`
+	Type     string `db:"type"`
+	MediaUrl string `db:"media_url"`
+	AltText  string `db:"alt_text"`
+}
+
+// Hashtags returns hashtags of the tweet, tags are lower cased so #Go and #go are the same hashtag.
+func (t *Tweet) Hashtags() []*TweetHashtag {
+	hashtags := make([]*TweetHashtag, 0, len(t.Entities.Hashtags))
+	for _, hashtag := range t.Entities.Hashtags {
+		start, end := indices(hashtag.Indices)
+		hashtags = append(hashtags, &TweetHashtag{
+			TweetId: t.Id,
+			Tag:     strings.ToLower(hashtag.Text),
+			Start:   start,
+			End:     end,
+		})
+	}
+	return hashtags
+}
+
+func (t *Tweet) Urls() []*TweetUrl {
+	urls := make([]*TweetUrl, 0, len(t.Entities.Urls))
+	for _, u := range t.Entities.Urls {
+		start, end := indices(u.Indices)
+		urls = append(urls, &TweetUrl{
+			TweetId:     t.Id,
+			Url:         u.Url,
+			ExpandedUrl: u.ExpandedUrl,
+			Domain:      Domain(u.ExpandedUrl),
+			Start:       start,
+			End:         end,
+		})
+	}
+	return urls
+}
+
+func (t *Tweet) Mentions() []*TweetMention {
+	mentions := make([]*TweetMention, 0, len(t.Entities.UserMentions))
+	for _, mention := range t.Entities.UserMentions {
+		start, end := indices(mention.Indices)
+		mentions = append(mentions, &TweetMention{
+			TweetId:    t.Id,
+			UserId:     parseId(mention.IdStr),
+			ScreenName: mention.ScreenName,
+			Start:      start,
+			End:        end,
+		})
+	}
+	return mentions
+}
+
+func (t *Tweet) Media() []*TweetMedia {
+	entities := t.ExtendedEntities.Media
+	if len(entities) == 0 {
+		entities = t.Entities.Media
+	}
+	media := make([]*TweetMedia, 0, len(entities))
+	for _, m := range entities {
+		media = append(media, &TweetMedia{
+			TweetId:  t.Id,
+			MediaId:  parseId(m.IdStr),
+			Type:     m.Type,
+			MediaUrl: m.MediaUrlHttps,
+			AltText:  m.ExtAltText,
+		})
+	}
+	return media
+}
+
+// Domain returns lower cased host of the url without www prefix, empty string if the url can't be parsed.
+func Domain(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+func indices(indices []int) (start, end int) {
+	if len(indices) < 2 {
+		return 0, 0
+	}
+	return indices[0], indices[1]
+}
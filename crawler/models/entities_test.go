@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTweet_Entities(t *testing.T) {
+	raw := `{"id_str": "7", "user_id_str": "100", "full_text": "#Go and #golang @gopher https://t.co/a https://t.co/m",
+"entities": {
+	"hashtags": [{"text": "Go", "indices": [0, 3]}, {"text": "golang", "indices": [8, 15]}],
+	"urls": [{"url": "https://t.co/a", "expanded_url": "https://WWW.Golang.org/doc?x=1", "indices": [24, 38]}],
+	"user_mentions": [{"id_str": "200", "screen_name": "gopher", "indices": [16, 23]}],
+	"media": [{"id_str": "70", "type": "photo", "media_url_https": "https://pbs.twimg.com/70.jpg", "indices": [39, 53]}]
+},
+"extended_entities": {
+	"media": [
+		{"id_str": "70", "type": "photo", "media_url_https": "https://pbs.twimg.com/70.jpg", "ext_alt_text": "a gopher"},
+		{"id_str": "71", "type": "video", "media_url_https": "https://pbs.twimg.com/71.jpg", "ext_alt_text": null}
+	]
+}}`
+	tweet := &Tweet{}
+	assert.NoError(t, json.Unmarshal([]byte(raw), tweet))
+
+	assert.Equal(t, []*TweetHashtag{
+		{TweetId: 7, Tag: "go", Start: 0, End: 3},
+		{TweetId: 7, Tag: "golang", Start: 8, End: 15},
+	}, tweet.Hashtags())
+	assert.Equal(t, []*TweetUrl{
+		{TweetId: 7, Url: "https://t.co/a", ExpandedUrl: "https://WWW.Golang.org/doc?x=1", Domain: "golang.org", Start: 24, End: 38},
+	}, tweet.Urls())
+	assert.Equal(t, []*TweetMention{
+		{TweetId: 7, UserId: 200, ScreenName: "gopher", Start: 16, End: 23},
+	}, tweet.Mentions())
+	assert.Equal(t, []*TweetMedia{
+		{TweetId: 7, MediaId: 70, Type: "photo", MediaUrl: "https://pbs.twimg.com/70.jpg", AltText: "a gopher"},
+		{TweetId: 7, MediaId: 71, Type: "video", MediaUrl: "https://pbs.twimg.com/71.jpg"},
+	}, tweet.Media())
+}
+
+func TestDomain(t *testing.T) {
+	assert.Equal(t, "example.com", Domain("http://www.Example.com:8080/path"))
+	assert.Equal(t, "news.example.com", Domain("https://news.example.com"))
+	assert.Equal(t, "", Domain("not a url"))
+}
@@ -4,3 +4,13 @@ type Follower struct {
 	UserId     int64 `db:"user_id"`
 	FollowerId int64 `db:"follower_id"`
 }
+
+// FollowersPage is a downloaded page of followers of User, or of friends if Friends is set. Users are profiles
+// of the page, they're empty if only ids were downloaded. Cursor and crawl status of User are the state
+// after the page, they are saved with the page.
+type FollowersPage struct {
+	User      *User       `json:"user"`
+	Friends   bool        `json:"friends"`
+	Users     []*User     `json:"users"`
+	Followers []*Follower `json:"followers"`
+}
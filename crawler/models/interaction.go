@@ -0,0 +1,78 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// InteractionType is the kind of edge between the author of a tweet and the user the tweet refers to.
+type InteractionType string
+
+const (
+	InteractionTypeRetweet InteractionType = "retweet"
+	InteractionTypeReply   InteractionType = "reply"
+	InteractionTypeQuote   InteractionType = "quote"
+	InteractionTypeMention InteractionType = "mention"
+)
+
+// Interaction is an edge from the author of tweet TweetId to TargetUserId. TargetTweetId is the retweeted,
+// replied or quoted tweet, it's 0 for mentions.
+type Interaction struct {
+	UserId        int64           `db:"user_id"`
+	TargetUserId  int64           `db:"target_user_id"`
+	Type          InteractionType `db:"type"`
+	TweetId       int64           `db:"tweet_id"`
+	TargetTweetId int64           `db:"target_tweet_id"`
+	CreatedAt     time.Time       `db:"created_at"`
+}
+
+// ExtractInteractions parses retweets, replies, quotes and mentions of the tweets. Authors of retweeted and
+// quoted tweets are looked up in known, which is keyed by tweet id like tweets of a timeline page, edges
+// to tweets missing there are skipped.
+func ExtractInteractions(tweets []*Tweet, known map[string]*Tweet) []*Interaction {
+	interactions := make([]*Interaction, 0)
+	for _, tweet := range tweets {
+		createdAt, _ := time.Parse(time.RubyDate, tweet.CreatedAt)
+		add := func(interactionType InteractionType, targetUserId, targetTweetId int64) {
+			if targetUserId == 0 {
+				return
+			}
+			interactions = append(interactions, &Interaction{
+				UserId:        tweet.UserId,
+				TargetUserId:  targetUserId,
+				Type:          interactionType,
+				TweetId:       tweet.Id,
+				TargetTweetId: targetTweetId,
+				CreatedAt:     createdAt,
+			})
+		}
+		if tweet.RetweetedStatusIdStr != "" {
+			if target, ok := known[tweet.RetweetedStatusIdStr]; ok {
+				add(InteractionTypeRetweet, target.UserId, target.Id)
+			}
+			// mentions, reply and quote of a retweet are the ones of the retweeted tweet
+			continue
+		}
+		if tweet.InReplyToStatusIdStr != "" {
+			add(InteractionTypeReply, parseId(tweet.InReplyToUserIdStr), parseId(tweet.InReplyToStatusIdStr))
+		}
+		if target, ok := known[tweet.QuotedStatusIdStr]; ok && tweet.QuotedStatusIdStr != "" {
+			add(InteractionTypeQuote, target.UserId, target.Id)
+		}
+		mentioned := make(map[int64]bool)
+		for _, mention := range tweet.Entities.UserMentions {
+			userId := parseId(mention.IdStr)
+			if mentioned[userId] {
+				continue
+			}
+			mentioned[userId] = true
+			add(InteractionTypeMention, userId, 0)
+		}
+	}
+	return interactions
+}
+
+func parseId(idStr string) int64 {
+	id, _ := strconv.ParseInt(idStr, 10, 64)
+	return id
+}
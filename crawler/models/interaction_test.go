@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestExtractInteractions(t *testing.T) {
+	page := `{
+"1": {"id_str": "1", "user_id_str": "100", "created_at": "Mon Jan 04 10:00:00 +0000 2021", "full_text": "original"},
+"2": {"id_str": "2", "user_id_str": "200", "created_at": "Mon Jan 04 11:00:00 +0000 2021", "full_text": "RT @a: original",
+	"retweeted_status_id_str": "1", "entities": {"user_mentions": [{"id_str": "100", "screen_name": "a", "indices": [3, 5]}]}},
+"3": {"id_str": "3", "user_id_str": "200", "created_at": "Mon Jan 04 12:00:00 +0000 2021", "full_text": "@a @b @a reply",
+	"in_reply_to_status_id_str": "1", "in_reply_to_user_id_str": "100",
+	"entities": {"user_mentions": [{"id_str": "100", "indices": [0, 2]}, {"id_str": "300", "indices": [3, 5]}, {"id_str": "100", "indices": [6, 8]}]}},
+"4": {"id_str": "4", "user_id_str": "200", "created_at": "Mon Jan 04 13:00:00 +0000 2021", "full_text": "quote", "quoted_status_id_str": "1"},
+"5": {"id_str": "5", "user_id_str": "200", "created_at": "Mon Jan 04 14:00:00 +0000 2021", "full_text": "RT of unknown", "retweeted_status_id_str": "9"}
+}`
+	known := make(map[string]*Tweet)
+	assert.NoError(t, json.Unmarshal([]byte(page), &known))
+	tweets := []*Tweet{known["1"], known["2"], known["3"], known["4"], known["5"]}
+
+	interactions := ExtractInteractions(tweets, known)
+
+	at := func(hour int) time.Time {
+		return time.Date(2021, 1, 4, hour, 0, 0, 0, time.UTC)
+	}
+	expected := []*Interaction{
+		{UserId: 200, TargetUserId: 100, Type: InteractionTypeRetweet, TweetId: 2, TargetTweetId: 1, CreatedAt: at(11)},
+		{UserId: 200, TargetUserId: 100, Type: InteractionTypeReply, TweetId: 3, TargetTweetId: 1, CreatedAt: at(12)},
+		{UserId: 200, TargetUserId: 100, Type: InteractionTypeMention, TweetId: 3, CreatedAt: at(12)},
+		{UserId: 200, TargetUserId: 300, Type: InteractionTypeMention, TweetId: 3, CreatedAt: at(12)},
+		{UserId: 200, TargetUserId: 100, Type: InteractionTypeQuote, TweetId: 4, TargetTweetId: 1, CreatedAt: at(13)},
+	}
+	if !assert.Len(t, interactions, len(expected)) {
+		return
+	}
+	for i := range expected {
+		assert.Equal(t, expected[i].Type, interactions[i].Type)
+		assert.Equal(t, expected[i].UserId, interactions[i].UserId)
+		assert.Equal(t, expected[i].TargetUserId, interactions[i].TargetUserId)
+		assert.Equal(t, expected[i].TweetId, interactions[i].TweetId)
+		assert.Equal(t, expected[i].TargetTweetId, interactions[i].TargetTweetId)
+		assert.True(t, expected[i].CreatedAt.Equal(interactions[i].CreatedAt))
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// List is a twitter list. Members and subscribers of the list are downloaded separately,
+// each relation has got its own cursor and crawl status.
+type List struct {
+	Id                       int64       `db:"id" json:"id"`
+	IdStr                    string      `db:"id_str" json:"id_str"`
+	Name                     string      `db:"name" json:"name"`
+	Slug                     string      `db:"slug" json:"slug"`
+	Description              string      `db:"description" json:"description"`
+	Mode                     string      `db:"mode" json:"mode"`
+	MemberCount              int64       `db:"member_count" json:"member_count"`
+	SubscriberCount          int64       `db:"subscriber_count" json:"subscriber_count"`
+	CreatedAt                string      `db:"created_at" json:"created_at"`
+	OwnerId                  int64       `db:"owner_id" json:"owner_id"`
+	Owner                    *User       `db:"-" json:"user"`
+	MembersNextCursorStr     string      `db:"members_next_cursor_str" json:"members_next_cursor_str"`
+	MembersCrawlStatus       CrawlStatus `db:"members_crawl_status" json:"members_crawl_status"`
+	SubscribersNextCursorStr string      `db:"subscribers_next_cursor_str" json:"subscribers_next_cursor_str"`
+	SubscribersCrawlStatus   CrawlStatus `db:"subscribers_crawl_status" json:"subscribers_crawl_status"`
+	DateLastChange           time.Time   `db:"date_last_change" json:"date_last_change"`
+}
+
+// ListRelation is the relation of a user to a list.
+type ListRelation string
+
+const (
+	ListRelationMember     ListRelation = "member"
+	ListRelationSubscriber ListRelation = "subscriber"
+)
+
+type ListMembership struct {
+	ListId   int64        `db:"list_id" json:"list_id"`
+	UserId   int64        `db:"user_id" json:"user_id"`
+	Relation ListRelation `db:"relation" json:"relation"`
+}
+
+// CrawlState returns the cursor and the crawl status of the relation.
+func (l *List) CrawlState(relation ListRelation) (string, CrawlStatus) {
+	if relation == ListRelationSubscriber {
+		return l.SubscribersNextCursorStr, l.SubscribersCrawlStatus
+	}
+	return l.MembersNextCursorStr, l.MembersCrawlStatus
+}
+
+func (l *List) SetCrawlState(relation ListRelation, cursor string, status CrawlStatus) {
+	if relation == ListRelationSubscriber {
+		l.SubscribersNextCursorStr = cursor
+		l.SubscribersCrawlStatus = status
+		return
+	}
+	l.MembersNextCursorStr = cursor
+	l.MembersCrawlStatus = status
+}
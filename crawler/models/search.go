@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// SearchState is the progress of a search crawl. Date slices of the search are crawled from the newest one,
+// SliceUntil is the end of the slice being crawled and Cursor is the position in it.
+type SearchState struct {
+	Key            string    `db:"search_key" json:"search_key"`
+	Cursor         string    `db:"cursor" json:"cursor"`
+	SliceUntil     time.Time `db:"slice_until" json:"slice_until"`
+	Done           bool      `db:"done" json:"done"`
+	DateLastChange time.Time `db:"date_last_change" json:"date_last_change"`
+}
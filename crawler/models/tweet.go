@@ -1,12 +1,47 @@
 package models
 
+import (
+	"encoding/json"
+	"strconv"
+)
+
 type Tweet struct {
-	CreatedAt            string  `json:"created_at"`
-	FullText             string  `json:"full_text"`
-	IdStr                string  `json:"id_str"`
-	Lang                 string  `json:"lang"`
-	ReplyCount           float64 `json:"reply_count"`
-	RetweetCount         float64 `json:"retweet_count"`
-	RetweetedStatusIdStr string  `json:"retweeted_status_id_str"`
-	UserIdStr            string  `json:"user_id_str"`
+	Id                   int64    `db:"id" json:"-"`
+	UserId               int64    `db:"user_id" json:"-"`
+	CreatedAt            string   `db:"created_at" json:"created_at"`
+	FullText             string   `db:"full_text" json:"full_text"`
+	IdStr                string   `db:"id_str" json:"id_str"`
+	Lang                 string   `db:"lang" json:"lang"`
+	ReplyCount           int64    `db:"reply_count" json:"reply_count"`
+	RetweetCount         int64    `db:"retweet_count" json:"retweet_count"`
+	RetweetedStatusIdStr string   `db:"retweeted_status_id_str" json:"retweeted_status_id_str"`
+	UserIdStr            string   `db:"user_id_str" json:"user_id_str"`
+	InReplyToStatusIdStr string   `db:"-" json:"in_reply_to_status_id_str"`
+	InReplyToUserIdStr   string   `db:"-" json:"in_reply_to_user_id_str"`
+	QuotedStatusIdStr    string   `db:"-" json:"quoted_status_id_str"`
+	Entities             Entities `db:"-" json:"entities"`
+	ExtendedEntities     Entities `db:"-" json:"extended_entities"`
+	// Raw is the json the tweet was decoded from, the tweet is encoded back to it so no field is lost
+	Raw string `db:"raw" json:"-"`
+}
+
+// tweetFields is Tweet without its json methods.
+type tweetFields Tweet
+
+func (t *Tweet) UnmarshalJSON(data []byte) error {
+	err := json.Unmarshal(data, (*tweetFields)(t))
+	if err != nil {
+		return err
+	}
+	t.Id, _ = strconv.ParseInt(t.IdStr, 10, 64)
+	t.UserId, _ = strconv.ParseInt(t.UserIdStr, 10, 64)
+	t.Raw = string(data)
+	return nil
+}
+
+func (t Tweet) MarshalJSON() ([]byte, error) {
+	if t.Raw != "" {
+		return []byte(t.Raw), nil
+	}
+	return json.Marshal(tweetFields(t))
 }
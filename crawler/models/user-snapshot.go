@@ -0,0 +1,85 @@
+package models
+
+import "time"
+
+// UserSnapshot is a version of the profile of a user observed by the crawler. ChangedFields are columns of users
+// which differ from the previous version, they are empty for the first observed one.
+type UserSnapshot struct {
+	UserId         int64     `db:"user_id" json:"user_id"`
+	ObservedAt     time.Time `db:"observed_at" json:"observed_at"`
+	ScreenName     string    `db:"screen_name" json:"screen_name"`
+	Name           string    `db:"name" json:"name"`
+	FollowersCount int64     `db:"followers_count" json:"followers_count"`
+	FriendsCount   int64     `db:"friends_count" json:"friends_count"`
+	Verified       bool      `db:"verified" json:"verified"`
+	Protected      *bool     `db:"protected" json:"protected"`
+	Location       *string   `db:"location" json:"location"`
+	Description    string    `db:"description" json:"description"`
+	Url            *string   `db:"url" json:"url"`
+	ChangedFields  []string  `db:"changed_fields" json:"changed_fields"`
+}
+
+func NewUserSnapshot(user *User, observedAt time.Time, changedFields []string) *UserSnapshot {
+	return &UserSnapshot{
+		UserId:         user.Id,
+		ObservedAt:     observedAt,
+		ScreenName:     user.ScreenName,
+		Name:           user.Name,
+		FollowersCount: user.FollowersCount,
+		FriendsCount:   user.FriendsCount,
+		Verified:       user.Verified,
+		Protected:      user.Protected,
+		Location:       user.Location,
+		Description:    user.Description,
+		Url:            user.Url,
+		ChangedFields:  changedFields,
+	}
+}
+
+// ProfileChanges returns columns of users with profile fields which differ in the new version of the profile.
+// Crawl state of the user and counters of tweets, likes and lists aren't a part of the profile.
+func ProfileChanges(old, new *User) []string {
+	var changes []string
+	if old.ScreenName != new.ScreenName {
+		changes = append(changes, "screen_name")
+	}
+	if old.Name != new.Name {
+		changes = append(changes, "name")
+	}
+	if old.FollowersCount != new.FollowersCount {
+		changes = append(changes, "followers_count")
+	}
+	if old.FriendsCount != new.FriendsCount {
+		changes = append(changes, "friends_count")
+	}
+	if old.Verified != new.Verified {
+		changes = append(changes, "verified")
+	}
+	if !equalBools(old.Protected, new.Protected) {
+		changes = append(changes, "protected")
+	}
+	if !equalStrings(old.Location, new.Location) {
+		changes = append(changes, "location")
+	}
+	if old.Description != new.Description {
+		changes = append(changes, "description")
+	}
+	if !equalStrings(old.Url, new.Url) {
+		changes = append(changes, "url")
+	}
+	return changes
+}
+
+func equalBools(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalStrings(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
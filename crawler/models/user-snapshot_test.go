@@ -0,0 +1,33 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestProfileChanges(t *testing.T) {
+	protected := false
+	location := "Berlin"
+	old := &User{Id: 1, ScreenName: "gopher", Name: "Gopher", FollowersCount: 10, Protected: &protected, Location: &location}
+
+	same := *old
+	same.NextCursorStr = "100"
+	same.CrawlStatus = CrawlStatusDone
+	assert.Empty(t, ProfileChanges(old, &same), "crawl state isn't a part of the profile")
+
+	sameLocation := "Berlin"
+	same.Location = &sameLocation
+	assert.Empty(t, ProfileChanges(old, &same), "pointers are compared by values")
+
+	changed := *old
+	changed.ScreenName = "gopher2"
+	changed.FollowersCount = 11
+	changed.Location = nil
+	changed.Description = "Go programmer"
+	assert.Equal(t, []string{"screen_name", "followers_count", "location", "description"}, ProfileChanges(old, &changed))
+
+	counters := *old
+	counters.StatusesCount = 100
+	counters.ListedCount = 2
+	assert.Empty(t, ProfileChanges(old, &counters), "counters of tweets and lists aren't tracked")
+}
@@ -1,26 +1,88 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
+// User is a twitter profile with the state of crawling it. AdditionalData is the user as returned by twitter,
+// it's nil for users saved before it was kept.
 type User struct {
-	Id                     int64     `db:"id" json:"id"`
-	IdStr                  string    `db:"id_str" json:"id_str"`
-	ScreenName             string    `db:"screen_name" json:"screen_name"`
-	Name                   string    `db:"name" json:"name"`
-	CreatedAt              string    `db:"created_at" json:"created_at"`
-	FollowersCount         int64     `db:"followers_count" json:"followers_count"`
-	FriendsCount           int64     `db:"friends_count" json:"friends_count"`
-	Verified               bool      `db:"verified" json:"verified"`
-	AdditionalData         *string   `db:"additional_data,omitempty" json:"-"`
-	NextCursor             int64     `db:"next_cursor" db:"next_cursor"`
-	NextCursorStr          string    `db:"next_cursor_str" json:"next_cursor_str"`
-	AreFollowersDownloaded bool      `db:"are_followers_downloaded" json:"-"`
-	DateLastChange         time.Time `db:"date_last_change" json:"-"`
-	Protected              *bool     `db:"protected" json:"protected"`
-	Location               *string   `db:"location" json:"location"`
-	Description            string    `db:"-" json:"description"`
+	Id                   int64        `db:"id" json:"id"`
+	IdStr                string       `db:"id_str" json:"id_str"`
+	ScreenName           string       `db:"screen_name" json:"screen_name"`
+	Name                 string       `db:"name" json:"name"`
+	CreatedAt            string       `db:"created_at" json:"created_at"`
+	FollowersCount       int64        `db:"followers_count" json:"followers_count"`
+	FriendsCount         int64        `db:"friends_count" json:"friends_count"`
+	Verified             bool         `db:"verified" json:"verified"`
+	AdditionalData       *string      `db:"additional_data" json:"additional_data,omitempty"`
+	NextCursor           int64        `db:"next_cursor" json:"next_cursor"`
+	NextCursorStr        string       `db:"next_cursor_str" json:"next_cursor_str"`
+	CrawlStatus          CrawlStatus  `db:"crawl_status" json:"crawl_status"`
+	FriendsNextCursor    int64        `db:"friends_next_cursor" json:"friends_next_cursor"`
+	FriendsNextCursorStr string       `db:"friends_next_cursor_str" json:"friends_next_cursor_str"`
+	FriendsCrawlStatus   CrawlStatus  `db:"friends_crawl_status" json:"friends_crawl_status"`
+	TweetsCursor         string       `db:"tweets_cursor" json:"tweets_cursor"`
+	TweetsSinceId        int64        `db:"tweets_since_id" json:"tweets_since_id"`
+	DateLastChange       time.Time    `db:"date_last_change" json:"date_last_change"`
+	Protected            *bool        `db:"protected" json:"protected"`
+	Location             *string      `db:"location" json:"location"`
+	Description          string       `db:"description" json:"description"`
+	Url                  *string      `db:"url" json:"url"`
+	ExpandedUrl          string       `db:"expanded_url" json:"expanded_url"`
+	StatusesCount        int64        `db:"statuses_count" json:"statuses_count"`
+	FavouritesCount      int64        `db:"favourites_count" json:"favourites_count"`
+	ListedCount          int64        `db:"listed_count" json:"listed_count"`
+	ProfileImageUrlHttps string       `db:"profile_image_url_https" json:"profile_image_url_https"`
+	DefaultProfile       bool         `db:"default_profile" json:"default_profile"`
+	DefaultProfileImage  bool         `db:"default_profile_image" json:"default_profile_image"`
+	Entities             UserEntities `db:"-" json:"entities"`
+}
+
+// UserEntities are urls in the profile url and description of a user, the profile url is t.co shortened.
+type UserEntities struct {
+	Url         UserEntity `json:"url"`
+	Description UserEntity `json:"description"`
+}
+
+type UserEntity struct {
+	Urls []*Url `json:"urls"`
+}
+
+// userFields is User without its json methods.
+type userFields User
+
+// UnmarshalJSON keeps the json the user was decoded from in AdditionalData, unless it's in the json already,
+// e.g. when the user is sent to the master by a remote worker.
+func (u *User) UnmarshalJSON(data []byte) error {
+	err := json.Unmarshal(data, (*userFields)(u))
+	if err != nil {
+		return err
+	}
+	if u.ExpandedUrl == "" && len(u.Entities.Url.Urls) > 0 {
+		u.ExpandedUrl = u.Entities.Url.Urls[0].ExpandedUrl
+	}
+	if u.AdditionalData == nil {
+		raw := string(data)
+		u.AdditionalData = &raw
+	}
+	return nil
+}
+
+// CrawlStatus is the state of downloading followers (or friends) of a user. Users in terminal states aren't queued again.
+type CrawlStatus string
+
+const (
+	CrawlStatusPending   CrawlStatus = "pending"
+	CrawlStatusDone      CrawlStatus = "done"
+	CrawlStatusProtected CrawlStatus = "protected"
+	CrawlStatusNotFound  CrawlStatus = "not_found"
+	CrawlStatusSuspended CrawlStatus = "suspended"
+)
+
+func (s CrawlStatus) IsTerminal() bool {
+	return s == CrawlStatusDone || s == CrawlStatusProtected || s == CrawlStatusNotFound || s == CrawlStatusSuspended
 }
 
 func minInt(ints ...int) int {
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -56,3 +57,27 @@ func TestBatchUsersArray(t *testing.T) {
 		}
 	}
 }
+
+func TestUser_UnmarshalJSON(t *testing.T) {
+	raw := `{"id":12,"id_str":"12","screen_name":"jack","description":"just setting up my twttr","url":"https://t.co/abc",
+"statuses_count":29000,"favourites_count":35000,"listed_count":28000,"default_profile":false,"default_profile_image":false,
+"profile_image_url_https":"https://pbs.twimg.com/profile_images/1/jack_normal.jpg",
+"entities":{"url":{"urls":[{"url":"https://t.co/abc","expanded_url":"http://jack.com","indices":[0,23]}]},"description":{"urls":[]}}}`
+	user := &User{}
+	assert.NoError(t, json.Unmarshal([]byte(raw), user))
+	assert.Equal(t, "just setting up my twttr", user.Description)
+	assert.Equal(t, int64(29000), user.StatusesCount)
+	assert.Equal(t, int64(35000), user.FavouritesCount)
+	assert.Equal(t, int64(28000), user.ListedCount)
+	assert.Equal(t, "http://jack.com", user.ExpandedUrl)
+	if assert.NotNil(t, user.AdditionalData) {
+		assert.Equal(t, raw, *user.AdditionalData)
+	}
+
+	// a user sent by a remote worker keeps the json it was downloaded as
+	encoded, err := json.Marshal(user)
+	assert.NoError(t, err)
+	decoded := &User{}
+	assert.NoError(t, json.Unmarshal(encoded, decoded))
+	assert.Equal(t, user, decoded)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
 	"github.com/scarecrow6977/twitter-crawler/crawler/graph"
 	"github.com/scarecrow6977/twitter-crawler/crawler/models"
@@ -46,11 +47,11 @@ func main() {
 			log.Printf("Skipping %d user (userId=%d)", idx, userId)
 			continue
 		}
-		user, err := pgStor.GetUserById(userId)
+		user, err := pgStor.GetUserById(context.Background(), userId)
 		if err != nil {
 			log.Fatalf("get user from db, userId=%d, err=%v", userId, err)
 		}
-		followers, err := pgStor.GetFollowers(user.Id)
+		followers, err := pgStor.GetFollowers(context.Background(), user.Id)
 		if err != nil {
 			log.Fatalf("get followers from db, userId=%d, err=%v", user.Id, err)
 		}
@@ -73,8 +74,23 @@ func main() {
 			importedCount += len(followersBatch)
 			log.Printf("%d of %d imported", importedCount, len(followers))
 		}
+		interactions, err := pgStor.GetInteractions(context.Background(), user.Id)
+		if err != nil {
+			log.Fatalf("get interactions from db, userId=%d, err=%v", user.Id, err)
+		}
+		for from := 0; from < len(interactions); from += batchSize {
+			to := from + batchSize
+			if to > len(interactions) {
+				to = len(interactions)
+			}
+			err = imp.ImportInteractions(interactions[from:to])
+			if err != nil {
+				log.Fatalf("Can't import interactions to neo4j, err=%v", err)
+			}
+		}
+		log.Printf("%d interactions imported", len(interactions))
 		log.Println("done")
 
 	}
-	log.Println("Users with their followers successfully imported to neo4j")
+	log.Println("Users with their followers and interactions successfully imported to neo4j")
 }
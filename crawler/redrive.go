@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage/backend"
+)
+
+// Re-drive: returns tasks from the dead-letter table (crawl_tasks_dead) to the task queue,
+// with -list only shows them.
+func main() {
+	var configPath string
+	var taskType string
+	var limit int64
+	var list bool
+	flag.StringVar(&configPath, "config", "config.yaml", "path to the config file")
+	flag.StringVar(&taskType, "type", "", "type of tasks to re-drive, e.g. download_followers, all types by default")
+	flag.Int64Var(&limit, "limit", 1000, "max number of tasks to re-drive")
+	flag.BoolVar(&list, "list", false, "list dead tasks instead of re-driving them")
+	flag.Parse()
+
+	conf.Init(configPath)
+	config, err := conf.LoadConfig()
+	if err != nil {
+		fmt.Printf("can't load config, err='%v'", err)
+		return
+	}
+	log.SetVerbosityLevel(2)
+
+	stor, err := backend.NewStorage(config)
+	if err != nil {
+		log.LogError("can't connect to storage, err='%v'", err)
+		return
+	}
+	defer stor.Close()
+	ctx := context.Background()
+
+	if list {
+		tasks, err := stor.GetDeadCrawlTasks(ctx, taskType, limit)
+		if err != nil {
+			log.LogError("can't get dead tasks, err='%v'", err)
+			return
+		}
+		for _, task := range tasks {
+			fmt.Printf("%d\t%s\t%s\tattempts=%d\t%s\t%s\t%s\n", task.TaskId, task.Type, task.Key, task.Attempts,
+				task.FailedAt.Format("2006-01-02 15:04:05"), task.ErrorClass, task.LastError)
+		}
+		return
+	}
+
+	redriven, err := stor.RedriveDeadCrawlTasks(ctx, taskType, limit)
+	if err != nil {
+		log.LogError("can't re-drive dead tasks, err='%v'", err)
+		return
+	}
+	log.LogInfo("%d dead tasks are returned to the queue", redriven)
+}
@@ -0,0 +1,34 @@
+package backend
+
+import (
+	"fmt"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	pg_storage "github.com/scarecrow6977/twitter-crawler/crawler/storage/pg-storage"
+	sqlite_storage "github.com/scarecrow6977/twitter-crawler/crawler/storage/sqlite-storage"
+)
+
+const (
+	StoragePostgres = "postgres"
+	StorageSQLite   = "sqlite"
+)
+
+// NewStorage opens the storage of the kind set in config, postgres is used by default.
+func NewStorage(config *conf.MasterConfig) (storage.Backend, error) {
+	switch config.Storage {
+	case "", StoragePostgres:
+		pgStorage, err := pg_storage.NewPgStorage(config.PostgresAccess)
+		if err != nil {
+			return nil, err
+		}
+		return pgStorage, nil
+	case StorageSQLite:
+		sqliteStorage, err := sqlite_storage.NewSQLiteStorage(config.SQLite)
+		if err != nil {
+			return nil, err
+		}
+		return sqliteStorage, nil
+	default:
+		return nil, fmt.Errorf("unknown storage '%s'", config.Storage)
+	}
+}
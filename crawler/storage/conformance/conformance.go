@@ -0,0 +1,646 @@
+package conformance
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Conformance suite checks the semantics every storage backend has to keep, so tasks and the master
+// tested with one backend behave the same with the others. A backend runs it from its own tests:
+//
+//	conformance.Run(t, func(t *testing.T) conformance.Storage { return NewMemoryStorage() })
+
+// Storage is a backend checked by the suite.
+type Storage interface {
+	storage.Storage
+	storage.FollowersReader
+	GetInteractions(ctx context.Context, userId int64) ([]*models.Interaction, error)
+}
+
+// Run runs the suite, every test gets an empty storage from newStorage.
+func Run(t *testing.T, newStorage func(t *testing.T) Storage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s Storage)
+	}{
+		{"NewUsers", testNewUsers},
+		{"UpdateUsers", testUpdateUsers},
+		{"UserState", testUserState},
+		{"Followers", testFollowers},
+		{"CommitFollowersPage", testCommitFollowersPage},
+		{"UnknownUserIds", testUnknownUserIds},
+		{"NotDownloadedUsers", testNotDownloadedUsers},
+		{"Tweets", testTweets},
+		{"Interactions", testInteractions},
+		{"SearchState", testSearchState},
+		{"Lists", testLists},
+		{"TaskQueue", testTaskQueue},
+		{"TaskLease", testTaskLease},
+		{"DeadTasks", testDeadTasks},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newStorage(t))
+		})
+	}
+}
+
+func newUser(id int64) *models.User {
+	return &models.User{Id: id, IdStr: strconv.FormatInt(id, 10), ScreenName: "user" + strconv.FormatInt(id, 10),
+		Name: "User " + strconv.FormatInt(id, 10), FollowersCount: id * 10}
+}
+
+func sortedIds(ids []int64) []int64 {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+func userIds(users []*models.User) []int64 {
+	ids := make([]int64, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	return ids
+}
+
+func testNewUsers(t *testing.T, s Storage) {
+	ctx := context.Background()
+	// the second version of a user in the same batch wins
+	updated := newUser(2)
+	updated.Name = "Renamed"
+	err := s.AddNewUsers(ctx, []*models.User{newUser(1), newUser(2), updated})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	user, err := s.GetUserById(ctx, 2)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "user2", user.ScreenName)
+	assert.Equal(t, "Renamed", user.Name)
+	assert.Equal(t, int64(20), user.FollowersCount)
+	// new users are saved with the initial crawl state
+	assert.Equal(t, int64(-1), user.NextCursor)
+	assert.Equal(t, "-1", user.NextCursorStr)
+	assert.Equal(t, models.CrawlStatusPending, user.CrawlStatus)
+	assert.Equal(t, int64(-1), user.FriendsNextCursor)
+	assert.Equal(t, "-1", user.FriendsNextCursorStr)
+	assert.Equal(t, models.CrawlStatusPending, user.FriendsCrawlStatus)
+	assert.Equal(t, "", user.TweetsCursor)
+	assert.Nil(t, user.AdditionalData)
+
+	user, err = s.GetUserByScreenName(ctx, "user1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), user.Id)
+	}
+	_, err = s.GetUserById(ctx, 3)
+	assert.Equal(t, sql.ErrNoRows, errors.Cause(err))
+	_, err = s.GetUserByScreenName(ctx, "user3")
+	assert.Equal(t, sql.ErrNoRows, errors.Cause(err))
+
+	snapshots, err := s.GetUserSnapshots(ctx, 2)
+	if assert.NoError(t, err) && assert.Len(t, snapshots, 1) {
+		assert.Equal(t, "Renamed", snapshots[0].Name)
+		assert.Empty(t, snapshots[0].ChangedFields)
+	}
+}
+
+func testUpdateUsers(t *testing.T, s Storage) {
+	ctx := context.Background()
+	raw := `{"id":1}`
+	user := newUser(1)
+	user.AdditionalData = &raw
+	err := s.AddNewUsers(ctx, []*models.User{user})
+	if !assert.NoError(t, err) {
+		return
+	}
+	user.NextCursor = 5
+	user.NextCursorStr = "5"
+	user.CrawlStatus = models.CrawlStatusDone
+	err = s.UpdateUserState(ctx, user)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// a profile without raw data doesn't drop the saved one, a profile without changes isn't a new version
+	updated := newUser(1)
+	updated.Name = "Renamed"
+	updated.Description = "about"
+	err = s.AddNewUsers(ctx, []*models.User{updated})
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = s.AddNewUsers(ctx, []*models.User{updated})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	saved, err := s.GetUserById(ctx, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Renamed", saved.Name)
+	assert.Equal(t, "about", saved.Description)
+	if assert.NotNil(t, saved.AdditionalData) {
+		assert.JSONEq(t, raw, *saved.AdditionalData)
+	}
+	// the crawl state is kept
+	assert.Equal(t, "5", saved.NextCursorStr)
+	assert.Equal(t, models.CrawlStatusDone, saved.CrawlStatus)
+
+	snapshots, err := s.GetUserSnapshots(ctx, 1)
+	if assert.NoError(t, err) && assert.Len(t, snapshots, 2) {
+		assert.Equal(t, "User 1", snapshots[0].Name)
+		assert.Equal(t, "Renamed", snapshots[1].Name)
+		assert.ElementsMatch(t, []string{"name", "description"}, snapshots[1].ChangedFields)
+	}
+	snapshots, err = s.GetUserSnapshots(ctx, 2)
+	if assert.NoError(t, err) {
+		assert.Empty(t, snapshots)
+	}
+}
+
+func testUserState(t *testing.T, s Storage) {
+	ctx := context.Background()
+	err := s.AddNewUsers(ctx, []*models.User{newUser(1)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	user, err := s.GetUserById(ctx, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	user.NextCursor = 7
+	user.NextCursorStr = "7"
+	user.CrawlStatus = models.CrawlStatusDone
+	user.FriendsNextCursor = 9
+	user.FriendsNextCursorStr = "9"
+	user.FriendsCrawlStatus = models.CrawlStatusProtected
+	user.TweetsCursor = "cursor"
+	user.TweetsSinceId = 11
+
+	// every update saves only its own part of the state
+	err = s.UpdateUserFriendsState(ctx, user)
+	if !assert.NoError(t, err) {
+		return
+	}
+	saved, err := s.GetUserById(ctx, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "9", saved.FriendsNextCursorStr)
+	assert.Equal(t, models.CrawlStatusProtected, saved.FriendsCrawlStatus)
+	assert.Equal(t, "-1", saved.NextCursorStr)
+	assert.Equal(t, "", saved.TweetsCursor)
+
+	err = s.UpdateUserTweetsState(ctx, user)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = s.UpdateUserState(ctx, user)
+	if !assert.NoError(t, err) {
+		return
+	}
+	saved, err = s.GetUserById(ctx, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(7), saved.NextCursor)
+	assert.Equal(t, "7", saved.NextCursorStr)
+	assert.Equal(t, models.CrawlStatusDone, saved.CrawlStatus)
+	assert.Equal(t, "cursor", saved.TweetsCursor)
+	assert.Equal(t, int64(11), saved.TweetsSinceId)
+
+	// updates of unknown users are ignored
+	err = s.UpdateUserState(ctx, newUser(2))
+	assert.NoError(t, err)
+	_, err = s.GetUserById(ctx, 2)
+	assert.Equal(t, sql.ErrNoRows, errors.Cause(err))
+}
+
+func testFollowers(t *testing.T, s Storage) {
+	ctx := context.Background()
+	err := s.AddNewUsers(ctx, []*models.User{newUser(1), newUser(2), newUser(3)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = s.AddNewFollowers(ctx, []*models.Follower{{UserId: 1, FollowerId: 2}, {UserId: 1, FollowerId: 4}, {UserId: 2, FollowerId: 1}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	// saved edges are skipped
+	err = s.AddNewFollowers(ctx, []*models.Follower{{UserId: 1, FollowerId: 2}, {UserId: 1, FollowerId: 3}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	followerIds, err := s.GetFollowerIds(ctx, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{2, 3, 4}, sortedIds(followerIds))
+	}
+	// only saved profiles of followers are returned
+	followers, err := s.GetFollowers(ctx, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{2, 3}, sortedIds(userIds(followers)))
+	}
+	followerIds, err = s.GetFollowerIds(ctx, 5)
+	if assert.NoError(t, err) {
+		assert.Empty(t, followerIds)
+	}
+}
+
+func testCommitFollowersPage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	err := s.AddNewUsers(ctx, []*models.User{newUser(1)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	user, err := s.GetUserById(ctx, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	user.NextCursor = 100
+	user.NextCursorStr = "100"
+	err = s.CommitFollowersPage(ctx, &models.FollowersPage{
+		User:      user,
+		Users:     []*models.User{newUser(2), newUser(3)},
+		Followers: []*models.Follower{{UserId: 1, FollowerId: 2}, {UserId: 1, FollowerId: 3}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	user.FriendsNextCursorStr = "200"
+	user.FriendsNextCursor = 200
+	user.FriendsCrawlStatus = models.CrawlStatusDone
+	err = s.CommitFollowersPage(ctx, &models.FollowersPage{
+		User:      user,
+		Friends:   true,
+		Followers: []*models.Follower{{UserId: 4, FollowerId: 1}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	saved, err := s.GetUserById(ctx, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "100", saved.NextCursorStr)
+	assert.Equal(t, models.CrawlStatusPending, saved.CrawlStatus)
+	assert.Equal(t, "200", saved.FriendsNextCursorStr)
+	assert.Equal(t, models.CrawlStatusDone, saved.FriendsCrawlStatus)
+	followers, err := s.GetFollowers(ctx, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{2, 3}, sortedIds(userIds(followers)))
+	}
+	followerIds, err := s.GetFollowerIds(ctx, 4)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{1}, followerIds)
+	}
+}
+
+func testUnknownUserIds(t *testing.T, s Storage) {
+	ctx := context.Background()
+	err := s.AddNewUsers(ctx, []*models.User{newUser(1), newUser(3)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = s.AddNewFollowers(ctx, []*models.Follower{{UserId: 1, FollowerId: 2}, {UserId: 1, FollowerId: 3},
+		{UserId: 5, FollowerId: 1}, {UserId: 3, FollowerId: 4}, {UserId: 3, FollowerId: 2}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	ids, err := s.GetUnknownUserIds(ctx, 0, 10)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{2, 4, 5}, ids)
+	}
+	ids, err = s.GetUnknownUserIds(ctx, 2, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{4}, ids)
+	}
+}
+
+func testNotDownloadedUsers(t *testing.T, s Storage) {
+	ctx := context.Background()
+	err := s.AddNewUsers(ctx, []*models.User{newUser(1), newUser(2), newUser(3), newUser(4)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	done := newUser(2)
+	done.CrawlStatus = models.CrawlStatusDone
+	err = s.UpdateUserState(ctx, done)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = s.EnqueueCrawlTasks(ctx, []*models.CrawlTask{
+		{Type: models.TaskTypeDownloadFollowers, Key: "user3", Payload: "{}"},
+		{Type: models.TaskTypeDownloadFriends, Key: "user4", Payload: "{}"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// users queued for downloading are skipped
+	users, err := s.GetUsersWithNotDownloadedFollowers(ctx, 10)
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, []int64{1, 4}, userIds(users))
+	}
+	users, err = s.GetUsersWithNotDownloadedFriends(ctx, 10)
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, []int64{1, 2, 3}, userIds(users))
+	}
+	users, err = s.GetUsersWithNotDownloadedFollowersSorted(ctx, 2, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{3, 4}, userIds(users))
+	}
+	users, err = s.GetUsersWithDownloadedFollowers(ctx, 10)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{2}, userIds(users))
+	}
+	users, err = s.GetUsersWithDownloadedFollowersSorted(ctx, 10, 1)
+	if assert.NoError(t, err) {
+		assert.Empty(t, users)
+	}
+}
+
+func testTweets(t *testing.T, s Storage) {
+	ctx := context.Background()
+	err := s.AddNewTweets(ctx, []*models.Tweet{
+		{Id: 10, IdStr: "10", UserId: 1, FullText: "first"},
+		{Id: 12, IdStr: "12", UserId: 1, FullText: "second"},
+		{Id: 11, IdStr: "11", UserId: 2, FullText: "other"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	// saved tweets are skipped
+	err = s.AddNewTweets(ctx, []*models.Tweet{{Id: 12, IdStr: "12", UserId: 1, FullText: "changed"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	lastTweetId, err := s.GetLastTweetId(ctx, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(12), lastTweetId)
+	}
+	lastTweetId, err = s.GetLastTweetId(ctx, 3)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(0), lastTweetId)
+	}
+}
+
+func testInteractions(t *testing.T, s Storage) {
+	ctx := context.Background()
+	createdAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	interactions := []*models.Interaction{
+		{UserId: 1, TargetUserId: 2, Type: models.InteractionTypeReply, TweetId: 10, TargetTweetId: 5, CreatedAt: createdAt},
+		{UserId: 1, TargetUserId: 3, Type: models.InteractionTypeMention, TweetId: 10, CreatedAt: createdAt},
+		{UserId: 2, TargetUserId: 1, Type: models.InteractionTypeRetweet, TweetId: 11, TargetTweetId: 10, CreatedAt: createdAt},
+	}
+	err := s.AddNewInteractions(ctx, interactions)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = s.AddNewInteractions(ctx, interactions[:1])
+	if !assert.NoError(t, err) {
+		return
+	}
+	saved, err := s.GetInteractions(ctx, 1)
+	if assert.NoError(t, err) && assert.Len(t, saved, 2) {
+		targets := make([]int64, 0, len(saved))
+		for _, interaction := range saved {
+			targets = append(targets, interaction.TargetUserId)
+			assert.True(t, createdAt.Equal(interaction.CreatedAt))
+		}
+		assert.Equal(t, []int64{2, 3}, sortedIds(targets))
+	}
+}
+
+func testSearchState(t *testing.T, s Storage) {
+	ctx := context.Background()
+	state, err := s.GetSearchState(ctx, "search")
+	if !assert.NoError(t, err) || !assert.Nil(t, state) {
+		return
+	}
+	sliceUntil := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	err = s.UpdateSearchState(ctx, &models.SearchState{Key: "search", Cursor: "a", SliceUntil: sliceUntil})
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = s.UpdateSearchState(ctx, &models.SearchState{Key: "search", Cursor: "b", SliceUntil: sliceUntil, Done: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	state, err = s.GetSearchState(ctx, "search")
+	if assert.NoError(t, err) && assert.NotNil(t, state) {
+		assert.Equal(t, "b", state.Cursor)
+		assert.True(t, state.Done)
+		assert.True(t, sliceUntil.Equal(state.SliceUntil))
+	}
+}
+
+func testLists(t *testing.T, s Storage) {
+	ctx := context.Background()
+	list, err := s.GetListById(ctx, 1)
+	if !assert.NoError(t, err) || !assert.Nil(t, list) {
+		return
+	}
+	list = &models.List{Id: 1, IdStr: "1", Name: "list", Slug: "list", OwnerId: 2,
+		MembersNextCursorStr: "-1", MembersCrawlStatus: models.CrawlStatusPending,
+		SubscribersNextCursorStr: "-1", SubscribersCrawlStatus: models.CrawlStatusPending}
+	err = s.AddNewLists(ctx, []*models.List{list})
+	if !assert.NoError(t, err) {
+		return
+	}
+	list.MembersNextCursorStr = "5"
+	list.MembersCrawlStatus = models.CrawlStatusDone
+	err = s.UpdateListState(ctx, list, models.ListRelationMember)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// metadata is updated, the crawl state is kept
+	err = s.AddNewLists(ctx, []*models.List{{Id: 1, IdStr: "1", Name: "renamed", Slug: "list", OwnerId: 2,
+		MembersNextCursorStr: "-1", MembersCrawlStatus: models.CrawlStatusPending,
+		SubscribersNextCursorStr: "-1", SubscribersCrawlStatus: models.CrawlStatusPending}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	saved, err := s.GetListById(ctx, 1)
+	if assert.NoError(t, err) && assert.NotNil(t, saved) {
+		assert.Equal(t, "renamed", saved.Name)
+		assert.Equal(t, "5", saved.MembersNextCursorStr)
+		assert.Equal(t, models.CrawlStatusDone, saved.MembersCrawlStatus)
+		assert.Equal(t, "-1", saved.SubscribersNextCursorStr)
+	}
+	memberships := []*models.ListMembership{{ListId: 1, UserId: 3, Relation: models.ListRelationMember}}
+	assert.NoError(t, s.AddListMemberships(ctx, memberships))
+	assert.NoError(t, s.AddListMemberships(ctx, memberships))
+}
+
+func testTaskQueue(t *testing.T, s Storage) {
+	ctx := context.Background()
+	enqueued, err := s.EnqueueCrawlTasks(ctx, []*models.CrawlTask{
+		{Type: models.TaskTypeDownloadFollowers, Key: "a", Payload: "{}", Priority: 0},
+		{Type: models.TaskTypeDownloadFollowers, Key: "b", Payload: "{}", Priority: 5},
+		{Type: models.TaskTypeDownloadFriends, Key: "a", Payload: "{}", Priority: 0},
+		{Type: models.TaskTypeDownloadFollowers, Key: "a", Payload: "{}", Priority: 9},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	// the same work isn't queued twice
+	assert.Equal(t, int64(3), enqueued)
+	pending, err := s.CountPendingCrawlTasks(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(3), pending)
+	}
+
+	tasks, err := s.ClaimCrawlTasks(ctx, "worker", 2, time.Minute)
+	if !assert.NoError(t, err) || !assert.Len(t, tasks, 2) {
+		return
+	}
+	// tasks with higher priority are claimed first, then the oldest ones
+	assert.Equal(t, "b", tasks[0].Key)
+	assert.Equal(t, models.TaskTypeDownloadFollowers, tasks[1].Type)
+	assert.Equal(t, "a", tasks[1].Key)
+	for _, task := range tasks {
+		assert.Equal(t, models.CrawlTaskLeased, task.State)
+		assert.Equal(t, 1, task.Attempts)
+		if assert.NotNil(t, task.LeaseOwner) {
+			assert.Equal(t, "worker", *task.LeaseOwner)
+		}
+	}
+	pending, err = s.CountPendingCrawlTasks(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), pending)
+	}
+
+	assert.NoError(t, s.CompleteCrawlTask(ctx, tasks[0].Id, "worker"))
+	// done work can be queued again
+	enqueued, err = s.EnqueueCrawlTasks(ctx, []*models.CrawlTask{{Type: models.TaskTypeDownloadFollowers, Key: "b", Payload: "{}"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), enqueued)
+	}
+
+	// a failed task waits for retryAt
+	assert.NoError(t, s.FailCrawlTask(ctx, tasks[1].Id, "worker", "boom", time.Now().Add(time.Hour)))
+	assert.Equal(t, storage.ErrLeaseLost, s.ReleaseCrawlTask(ctx, tasks[1].Id, "worker"))
+	claimed, err := s.ClaimCrawlTasks(ctx, "worker", 10, time.Minute)
+	if assert.NoError(t, err) && assert.Len(t, claimed, 2) {
+		for _, task := range claimed {
+			assert.NotEqual(t, tasks[1].Id, task.Id)
+		}
+	}
+}
+
+func testTaskLease(t *testing.T, s Storage) {
+	ctx := context.Background()
+	_, err := s.EnqueueCrawlTasks(ctx, []*models.CrawlTask{{Type: models.TaskTypeDownloadFollowers, Key: "a", Payload: "{}"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	// a lease expired right away
+	tasks, err := s.ClaimCrawlTasks(ctx, "first", 1, -time.Minute)
+	if !assert.NoError(t, err) || !assert.Len(t, tasks, 1) {
+		return
+	}
+	id := tasks[0].Id
+	pending, err := s.CountPendingCrawlTasks(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), pending)
+	}
+	tasks, err = s.ClaimCrawlTasks(ctx, "second", 1, time.Minute)
+	if !assert.NoError(t, err) || !assert.Len(t, tasks, 1) {
+		return
+	}
+	assert.Equal(t, id, tasks[0].Id)
+	assert.Equal(t, 2, tasks[0].Attempts)
+
+	// the first owner has lost the task
+	for _, err := range []error{
+		s.ExtendCrawlTaskLease(ctx, id, "first", time.Minute),
+		s.CompleteCrawlTask(ctx, id, "first"),
+		s.FailCrawlTask(ctx, id, "first", "boom", time.Now()),
+		s.ReleaseCrawlTask(ctx, id, "first"),
+		s.DeadLetterCrawlTask(ctx, id, "first", "error", "boom"),
+	} {
+		assert.Equal(t, storage.ErrLeaseLost, err)
+	}
+
+	assert.NoError(t, s.ExtendCrawlTaskLease(ctx, id, "second", time.Minute))
+	// a released task is claimed again without counting the attempt
+	assert.NoError(t, s.ReleaseCrawlTask(ctx, id, "second"))
+	assert.Equal(t, storage.ErrLeaseLost, s.CompleteCrawlTask(ctx, id, "second"))
+	tasks, err = s.ClaimCrawlTasks(ctx, "third", 1, time.Minute)
+	if assert.NoError(t, err) && assert.Len(t, tasks, 1) {
+		assert.Equal(t, 2, tasks[0].Attempts)
+	}
+	assert.NoError(t, s.CompleteCrawlTask(ctx, id, "third"))
+	assert.Equal(t, storage.ErrLeaseLost, s.CompleteCrawlTask(ctx, id, "third"))
+}
+
+func testDeadTasks(t *testing.T, s Storage) {
+	ctx := context.Background()
+	_, err := s.EnqueueCrawlTasks(ctx, []*models.CrawlTask{
+		{Type: models.TaskTypeDownloadFollowers, Key: "a", Payload: "{}"},
+		{Type: models.TaskTypeDownloadFriends, Key: "b", Payload: "{}"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	tasks, err := s.ClaimCrawlTasks(ctx, "worker", 2, time.Minute)
+	if !assert.NoError(t, err) || !assert.Len(t, tasks, 2) {
+		return
+	}
+	for _, task := range tasks {
+		assert.NoError(t, s.DeadLetterCrawlTask(ctx, task.Id, "worker", "permanent", "boom "+task.Key))
+	}
+
+	// dead tasks aren't claimed and block queueing of the same work
+	pending, err := s.CountPendingCrawlTasks(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(0), pending)
+	}
+	enqueued, err := s.EnqueueCrawlTasks(ctx, []*models.CrawlTask{{Type: models.TaskTypeDownloadFollowers, Key: "a", Payload: "{}"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(0), enqueued)
+	}
+
+	dead, err := s.GetDeadCrawlTasks(ctx, "", 10)
+	if assert.NoError(t, err) && assert.Len(t, dead, 2) {
+		assert.Equal(t, tasks[0].Id, dead[0].TaskId)
+		assert.Equal(t, "permanent", dead[0].ErrorClass)
+		assert.Equal(t, "boom a", dead[0].LastError)
+		assert.Equal(t, 1, dead[0].Attempts)
+	}
+	dead, err = s.GetDeadCrawlTasks(ctx, models.TaskTypeDownloadFriends, 10)
+	if assert.NoError(t, err) && assert.Len(t, dead, 1) {
+		assert.Equal(t, "b", dead[0].Key)
+	}
+
+	redriven, err := s.RedriveDeadCrawlTasks(ctx, models.TaskTypeDownloadFriends, 10)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), redriven)
+	}
+	dead, err = s.GetDeadCrawlTasks(ctx, "", 10)
+	if assert.NoError(t, err) && assert.Len(t, dead, 1) {
+		assert.Equal(t, "a", dead[0].Key)
+	}
+	claimed, err := s.ClaimCrawlTasks(ctx, "worker", 10, time.Minute)
+	if assert.NoError(t, err) && assert.Len(t, claimed, 1) {
+		assert.Equal(t, "b", claimed[0].Key)
+		assert.Equal(t, 1, claimed[0].Attempts)
+		assert.Nil(t, claimed[0].LastError)
+	}
+}
@@ -0,0 +1,508 @@
+package memory_storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps everything in memory with the semantics of PgStorage, e.g. for tests of tasks and
+// the master or for short crawls which don't need to be resumed. It's safe for concurrent use, saved
+// and returned models are copies, so callers can't change the storage by changing them.
+type MemoryStorage struct {
+	lock sync.Mutex
+
+	users        map[int64]*models.User
+	snapshots    map[int64][]*models.UserSnapshot
+	followers    map[int64][]int64
+	edges        map[models.Follower]bool
+	tweets       map[int64]*models.Tweet
+	interactions map[interactionKey]*models.Interaction
+	searches     map[string]*models.SearchState
+	lists        map[int64]*models.List
+	memberships  map[models.ListMembership]bool
+	tasks        []*models.CrawlTask
+	deadTasks    []*models.DeadCrawlTask
+	lastTaskId   int64
+	lastDeadId   int64
+}
+
+// interactionKey is the primary key of interactions.
+type interactionKey struct {
+	TweetId      int64
+	Type         models.InteractionType
+	TargetUserId int64
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		users:        make(map[int64]*models.User),
+		snapshots:    make(map[int64][]*models.UserSnapshot),
+		followers:    make(map[int64][]int64),
+		edges:        make(map[models.Follower]bool),
+		tweets:       make(map[int64]*models.Tweet),
+		interactions: make(map[interactionKey]*models.Interaction),
+		searches:     make(map[string]*models.SearchState),
+		lists:        make(map[int64]*models.List),
+		memberships:  make(map[models.ListMembership]bool),
+	}
+}
+
+func (s *MemoryStorage) AddNewFollowers(ctx context.Context, followers []*models.Follower) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.addFollowers(followers)
+	return nil
+}
+
+func (s *MemoryStorage) addFollowers(followers []*models.Follower) {
+	for _, follower := range followers {
+		if s.edges[*follower] {
+			continue
+		}
+		s.edges[*follower] = true
+		s.followers[follower.UserId] = append(s.followers[follower.UserId], follower.FollowerId)
+	}
+}
+
+// AddNewUsers saves new users with the initial crawl state and updates profiles of saved ones, keeping
+// their crawl state. Every new version of a profile is saved to the history of the user.
+func (s *MemoryStorage) AddNewUsers(ctx context.Context, users []*models.User) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.addUsers(users)
+	return nil
+}
+
+func (s *MemoryStorage) addUsers(users []*models.User) {
+	byId := make(map[int64]*models.User, len(users))
+	ids := make([]int64, 0, len(users))
+	for _, user := range users {
+		if _, ok := byId[user.Id]; !ok {
+			ids = append(ids, user.Id)
+		}
+		byId[user.Id] = user
+	}
+	now := time.Now()
+	for _, id := range ids {
+		user := byId[id]
+		user.DateLastChange = now
+		old, ok := s.users[user.Id]
+		if !ok {
+			saved := *user
+			saved.NextCursor = -1
+			saved.NextCursorStr = "-1"
+			saved.CrawlStatus = models.CrawlStatusPending
+			saved.FriendsNextCursor = -1
+			saved.FriendsNextCursorStr = "-1"
+			saved.FriendsCrawlStatus = models.CrawlStatusPending
+			saved.TweetsCursor = ""
+			saved.TweetsSinceId = 0
+			saved.Entities = models.UserEntities{}
+			s.users[user.Id] = &saved
+			s.snapshots[user.Id] = append(s.snapshots[user.Id], models.NewUserSnapshot(&saved, now, []string{}))
+			continue
+		}
+		if user.AdditionalData == nil {
+			user.AdditionalData = old.AdditionalData
+		}
+		changes := models.ProfileChanges(old, user)
+		saved := *old
+		saved.ScreenName = user.ScreenName
+		saved.Name = user.Name
+		saved.FollowersCount = user.FollowersCount
+		saved.FriendsCount = user.FriendsCount
+		saved.Verified = user.Verified
+		saved.Protected = user.Protected
+		saved.Location = user.Location
+		saved.Description = user.Description
+		saved.Url = user.Url
+		saved.ExpandedUrl = user.ExpandedUrl
+		saved.StatusesCount = user.StatusesCount
+		saved.FavouritesCount = user.FavouritesCount
+		saved.ListedCount = user.ListedCount
+		saved.ProfileImageUrlHttps = user.ProfileImageUrlHttps
+		saved.DefaultProfile = user.DefaultProfile
+		saved.DefaultProfileImage = user.DefaultProfileImage
+		saved.AdditionalData = user.AdditionalData
+		saved.DateLastChange = now
+		s.users[user.Id] = &saved
+		if len(changes) > 0 {
+			s.snapshots[user.Id] = append(s.snapshots[user.Id], models.NewUserSnapshot(&saved, now, changes))
+		}
+	}
+}
+
+func (s *MemoryStorage) GetUserSnapshots(ctx context.Context, userId int64) ([]*models.UserSnapshot, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	snapshots := make([]*models.UserSnapshot, 0, len(s.snapshots[userId]))
+	for _, snapshot := range s.snapshots[userId] {
+		copied := *snapshot
+		snapshots = append(snapshots, &copied)
+	}
+	return snapshots, nil
+}
+
+func (s *MemoryStorage) UpdateUserState(ctx context.Context, user *models.User) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.updateUserState(user)
+	return nil
+}
+
+func (s *MemoryStorage) updateUserState(user *models.User) {
+	user.DateLastChange = time.Now()
+	saved, ok := s.users[user.Id]
+	if !ok {
+		return
+	}
+	saved.NextCursor = user.NextCursor
+	saved.NextCursorStr = user.NextCursorStr
+	saved.CrawlStatus = user.CrawlStatus
+	saved.DateLastChange = user.DateLastChange
+	saved.Protected = user.Protected
+	saved.Location = user.Location
+}
+
+func (s *MemoryStorage) UpdateUserFriendsState(ctx context.Context, user *models.User) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.updateUserFriendsState(user)
+	return nil
+}
+
+func (s *MemoryStorage) updateUserFriendsState(user *models.User) {
+	user.DateLastChange = time.Now()
+	saved, ok := s.users[user.Id]
+	if !ok {
+		return
+	}
+	saved.FriendsNextCursor = user.FriendsNextCursor
+	saved.FriendsNextCursorStr = user.FriendsNextCursorStr
+	saved.FriendsCrawlStatus = user.FriendsCrawlStatus
+	saved.DateLastChange = user.DateLastChange
+}
+
+func (s *MemoryStorage) UpdateUserTweetsState(ctx context.Context, user *models.User) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	user.DateLastChange = time.Now()
+	saved, ok := s.users[user.Id]
+	if !ok {
+		return nil
+	}
+	saved.TweetsCursor = user.TweetsCursor
+	saved.TweetsSinceId = user.TweetsSinceId
+	saved.DateLastChange = user.DateLastChange
+	return nil
+}
+
+// CommitFollowersPage saves users, edges and the state of the user of the page under one lock,
+// so nobody sees a part of the page.
+func (s *MemoryStorage) CommitFollowersPage(ctx context.Context, page *models.FollowersPage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.addUsers(page.Users)
+	s.addFollowers(page.Followers)
+	if page.Friends {
+		s.updateUserFriendsState(page.User)
+	} else {
+		s.updateUserState(page.User)
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetUserById(ctx context.Context, id int64) (*models.User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (s *MemoryStorage) GetUserByScreenName(ctx context.Context, screenName string) (*models.User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, user := range s.users {
+		if user.ScreenName == screenName {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// selectUsers returns copies of users matching the filter in order of ids, skipping offset of them.
+func (s *MemoryStorage) selectUsers(n, offset int64, filter func(user *models.User) bool) []*models.User {
+	ids := make([]int64, 0, len(s.users))
+	for id := range s.users {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	users := make([]*models.User, 0)
+	for _, id := range ids {
+		if int64(len(users)) == n {
+			break
+		}
+		user := s.users[id]
+		if !filter(user) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		copied := *user
+		users = append(users, &copied)
+	}
+	return users
+}
+
+// hasActiveTask returns true if a task of one of the types with the key isn't done yet.
+func (s *MemoryStorage) hasActiveTask(key string, taskTypes ...string) bool {
+	for _, task := range s.tasks {
+		if task.Key != key || task.State == models.CrawlTaskDone {
+			continue
+		}
+		for _, taskType := range taskTypes {
+			if task.Type == taskType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *MemoryStorage) GetUsersWithNotDownloadedFollowers(ctx context.Context, n int64) ([]*models.User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// users already queued for downloading are skipped, see EnqueueCrawlTasks
+	return s.selectUsers(n, 0, func(user *models.User) bool {
+		return user.CrawlStatus == models.CrawlStatusPending &&
+			!s.hasActiveTask(user.ScreenName, models.TaskTypeDownloadFollowers, models.TaskTypeDownloadFollowerIds)
+	}), nil
+}
+
+func (s *MemoryStorage) GetUsersWithNotDownloadedFriends(ctx context.Context, n int64) ([]*models.User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.selectUsers(n, 0, func(user *models.User) bool {
+		return user.FriendsCrawlStatus == models.CrawlStatusPending && !s.hasActiveTask(user.ScreenName, models.TaskTypeDownloadFriends)
+	}), nil
+}
+
+func (s *MemoryStorage) GetUsersWithDownloadedFollowers(ctx context.Context, n int64) ([]*models.User, error) {
+	return s.GetUsersWithDownloadedFollowersSorted(ctx, n, 0)
+}
+
+func (s *MemoryStorage) GetUsersWithNotDownloadedFollowersSorted(ctx context.Context, n, offset int64) ([]*models.User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.selectUsers(n, offset, func(user *models.User) bool {
+		return user.CrawlStatus == models.CrawlStatusPending
+	}), nil
+}
+
+func (s *MemoryStorage) GetUsersWithDownloadedFollowersSorted(ctx context.Context, n, offset int64) ([]*models.User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.selectUsers(n, offset, func(user *models.User) bool {
+		return user.CrawlStatus == models.CrawlStatusDone
+	}), nil
+}
+
+func (s *MemoryStorage) GetUnknownUserIds(ctx context.Context, afterId, n int64) ([]int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	unknown := make(map[int64]bool)
+	for edge := range s.edges {
+		// friends of crawled users are on the user_id side of edges
+		for _, id := range []int64{edge.UserId, edge.FollowerId} {
+			if _, ok := s.users[id]; !ok && id > afterId {
+				unknown[id] = true
+			}
+		}
+	}
+	userIds := make([]int64, 0, len(unknown))
+	for id := range unknown {
+		userIds = append(userIds, id)
+	}
+	sort.Slice(userIds, func(i, j int) bool {
+		return userIds[i] < userIds[j]
+	})
+	if int64(len(userIds)) > n {
+		userIds = userIds[:n]
+	}
+	return userIds, nil
+}
+
+func (s *MemoryStorage) GetFollowers(ctx context.Context, userId int64) ([]*models.User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	followers := make([]*models.User, 0)
+	for _, followerId := range s.followers[userId] {
+		if user, ok := s.users[followerId]; ok {
+			copied := *user
+			followers = append(followers, &copied)
+		}
+	}
+	return followers, nil
+}
+
+func (s *MemoryStorage) GetFollowerIds(ctx context.Context, userId int64) ([]int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	followerIds := make([]int64, len(s.followers[userId]))
+	copy(followerIds, s.followers[userId])
+	return followerIds, nil
+}
+
+func (s *MemoryStorage) AddNewTweets(ctx context.Context, tweets []*models.Tweet) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, tweet := range tweets {
+		if _, ok := s.tweets[tweet.Id]; ok {
+			continue
+		}
+		if tweet.Raw == "" {
+			raw, err := json.Marshal(tweet)
+			if err != nil {
+				return err
+			}
+			tweet.Raw = string(raw)
+		}
+		copied := *tweet
+		s.tweets[tweet.Id] = &copied
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetLastTweetId(ctx context.Context, userId int64) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var lastTweetId int64
+	for _, tweet := range s.tweets {
+		if tweet.UserId == userId && tweet.Id > lastTweetId {
+			lastTweetId = tweet.Id
+		}
+	}
+	return lastTweetId, nil
+}
+
+func (s *MemoryStorage) AddNewInteractions(ctx context.Context, interactions []*models.Interaction) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, interaction := range interactions {
+		key := interactionKey{TweetId: interaction.TweetId, Type: interaction.Type, TargetUserId: interaction.TargetUserId}
+		if _, ok := s.interactions[key]; !ok {
+			copied := *interaction
+			s.interactions[key] = &copied
+		}
+	}
+	return nil
+}
+
+// GetInteractions returns interactions of the user with other users.
+func (s *MemoryStorage) GetInteractions(ctx context.Context, userId int64) ([]*models.Interaction, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	interactions := make([]*models.Interaction, 0)
+	for _, interaction := range s.interactions {
+		if interaction.UserId == userId {
+			copied := *interaction
+			interactions = append(interactions, &copied)
+		}
+	}
+	return interactions, nil
+}
+
+func (s *MemoryStorage) GetSearchState(ctx context.Context, key string) (*models.SearchState, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	state, ok := s.searches[key]
+	if !ok {
+		return nil, nil
+	}
+	copied := *state
+	return &copied, nil
+}
+
+func (s *MemoryStorage) UpdateSearchState(ctx context.Context, state *models.SearchState) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	state.DateLastChange = time.Now()
+	copied := *state
+	s.searches[state.Key] = &copied
+	return nil
+}
+
+func (s *MemoryStorage) AddNewLists(ctx context.Context, lists []*models.List) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, list := range lists {
+		list.DateLastChange = time.Now()
+		saved, ok := s.lists[list.Id]
+		if !ok {
+			copied := *list
+			copied.Owner = nil
+			s.lists[list.Id] = &copied
+			continue
+		}
+		saved.Name = list.Name
+		saved.Slug = list.Slug
+		saved.Description = list.Description
+		saved.Mode = list.Mode
+		saved.MemberCount = list.MemberCount
+		saved.SubscriberCount = list.SubscriberCount
+		saved.DateLastChange = list.DateLastChange
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetListById(ctx context.Context, id int64) (*models.List, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	list, ok := s.lists[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *list
+	return &copied, nil
+}
+
+func (s *MemoryStorage) UpdateListState(ctx context.Context, list *models.List, relation models.ListRelation) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	list.DateLastChange = time.Now()
+	saved, ok := s.lists[list.Id]
+	if !ok {
+		return nil
+	}
+	cursor, status := list.CrawlState(relation)
+	saved.SetCrawlState(relation, cursor, status)
+	saved.DateLastChange = list.DateLastChange
+	return nil
+}
+
+func (s *MemoryStorage) AddListMemberships(ctx context.Context, memberships []*models.ListMembership) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, membership := range memberships {
+		s.memberships[*membership] = true
+	}
+	return nil
+}
+
+var _ storage.Storage = (*MemoryStorage)(nil)
+var _ storage.FollowersReader = (*MemoryStorage)(nil)
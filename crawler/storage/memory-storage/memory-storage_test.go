@@ -0,0 +1,79 @@
+package memory_storage
+
+import (
+	"context"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage/conformance"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) conformance.Storage {
+		return NewMemoryStorage()
+	})
+}
+
+func TestMemoryStorage_ReturnsCopies(t *testing.T) {
+	s := NewMemoryStorage()
+	ctx := context.Background()
+	user := &models.User{Id: 1, IdStr: "1", ScreenName: "first"}
+	err := s.AddNewUsers(ctx, []*models.User{user})
+	if !assert.NoError(t, err) {
+		return
+	}
+	user.ScreenName = "changed"
+	saved, err := s.GetUserById(ctx, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "first", saved.ScreenName)
+	saved.ScreenName = "changed"
+	saved, err = s.GetUserById(ctx, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "first", saved.ScreenName)
+	}
+}
+
+func TestMemoryStorage_ConcurrentClaims(t *testing.T) {
+	s := NewMemoryStorage()
+	ctx := context.Background()
+	tasks := make([]*models.CrawlTask, 0, 100)
+	for i := 0; i < 100; i++ {
+		tasks = append(tasks, &models.CrawlTask{Type: models.TaskTypeHydrateUsers, Key: strconv.Itoa(i)})
+	}
+	_, err := s.EnqueueCrawlTasks(ctx, tasks)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var lock sync.Mutex
+	claimed := make(map[int64]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				tasks, err := s.ClaimCrawlTasks(ctx, "worker", 3, time.Minute)
+				if err != nil || len(tasks) == 0 {
+					return
+				}
+				lock.Lock()
+				for _, task := range tasks {
+					claimed[task.Id]++
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// every task is given to one claim only
+	assert.Len(t, claimed, 100)
+	for id, count := range claimed {
+		assert.Equal(t, 1, count, "task %d", id)
+	}
+}
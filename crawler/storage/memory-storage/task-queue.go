@@ -0,0 +1,232 @@
+package memory_storage
+
+import (
+	"context"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"sort"
+	"time"
+)
+
+// The task queue keeps the semantics of crawl_tasks table of PgStorage, see pg-storage/task-queue.go.
+
+func (s *MemoryStorage) EnqueueCrawlTasks(ctx context.Context, tasks []*models.CrawlTask) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var enqueued int64
+	for _, task := range tasks {
+		if s.hasActiveTask(task.Key, task.Type) {
+			continue
+		}
+		now := time.Now()
+		s.lastTaskId++
+		s.tasks = append(s.tasks, &models.CrawlTask{
+			Id:          s.lastTaskId,
+			Type:        task.Type,
+			Key:         task.Key,
+			Payload:     task.Payload,
+			State:       models.CrawlTaskPending,
+			Priority:    task.Priority,
+			AvailableAt: now,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+		enqueued++
+	}
+	return enqueued, nil
+}
+
+// ClaimCrawlTasks leases up to n available pending tasks (or tasks with expired lease) to owner.
+func (s *MemoryStorage) ClaimCrawlTasks(ctx context.Context, owner string, n int64, leaseDuration time.Duration) ([]*models.CrawlTask, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	available := make([]*models.CrawlTask, 0)
+	for _, task := range s.tasks {
+		if isAvailable(task, now) {
+			available = append(available, task)
+		}
+	}
+	sort.SliceStable(available, func(i, j int) bool {
+		// tasks are kept in order of ids
+		return available[i].Priority > available[j].Priority
+	})
+	if int64(len(available)) > n {
+		available = available[:n]
+	}
+	tasks := make([]*models.CrawlTask, 0, len(available))
+	for _, task := range available {
+		leaseOwner := owner
+		leaseExpiresAt := now.Add(leaseDuration)
+		task.State = models.CrawlTaskLeased
+		task.LeaseOwner = &leaseOwner
+		task.LeaseExpiresAt = &leaseExpiresAt
+		task.Attempts++
+		task.UpdatedAt = now
+		tasks = append(tasks, copyTask(task))
+	}
+	return tasks, nil
+}
+
+func (s *MemoryStorage) ExtendCrawlTaskLease(ctx context.Context, id int64, owner string, leaseDuration time.Duration) error {
+	return s.updateLeased(id, owner, func(task *models.CrawlTask, now time.Time) {
+		leaseExpiresAt := now.Add(leaseDuration)
+		task.LeaseExpiresAt = &leaseExpiresAt
+	})
+}
+
+func (s *MemoryStorage) CompleteCrawlTask(ctx context.Context, id int64, owner string) error {
+	return s.updateLeased(id, owner, func(task *models.CrawlTask, now time.Time) {
+		task.State = models.CrawlTaskDone
+		task.LeaseOwner = nil
+		task.LeaseExpiresAt = nil
+	})
+}
+
+// FailCrawlTask returns the task to the queue, remembering the error it failed with.
+// The task can't be claimed again until retryAt.
+func (s *MemoryStorage) FailCrawlTask(ctx context.Context, id int64, owner string, lastError string, retryAt time.Time) error {
+	return s.updateLeased(id, owner, func(task *models.CrawlTask, now time.Time) {
+		task.State = models.CrawlTaskPending
+		task.LeaseOwner = nil
+		task.LeaseExpiresAt = nil
+		task.LastError = &lastError
+		task.AvailableAt = retryAt
+	})
+}
+
+// DeadLetterCrawlTask moves the task to dead state and records it to the dead tasks.
+// Dead tasks aren't claimed and block queueing of the same work until they are re-driven.
+func (s *MemoryStorage) DeadLetterCrawlTask(ctx context.Context, id int64, owner string, errorClass string, lastError string) error {
+	return s.updateLeased(id, owner, func(task *models.CrawlTask, now time.Time) {
+		task.State = models.CrawlTaskDead
+		task.LeaseOwner = nil
+		task.LeaseExpiresAt = nil
+		task.LastError = &lastError
+		s.lastDeadId++
+		s.deadTasks = append(s.deadTasks, &models.DeadCrawlTask{
+			Id:         s.lastDeadId,
+			TaskId:     task.Id,
+			Type:       task.Type,
+			Key:        task.Key,
+			Attempts:   task.Attempts,
+			ErrorClass: errorClass,
+			LastError:  lastError,
+			FailedAt:   now,
+		})
+	})
+}
+
+// GetDeadCrawlTasks returns up to n oldest dead tasks of the given type, or of any type if taskType is empty.
+func (s *MemoryStorage) GetDeadCrawlTasks(ctx context.Context, taskType string, n int64) ([]*models.DeadCrawlTask, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	tasks := make([]*models.DeadCrawlTask, 0)
+	for _, dead := range s.deadTasks {
+		if int64(len(tasks)) == n {
+			break
+		}
+		if taskType == "" || dead.Type == taskType {
+			copied := *dead
+			tasks = append(tasks, &copied)
+		}
+	}
+	return tasks, nil
+}
+
+// RedriveDeadCrawlTasks returns up to n oldest dead tasks of the given type (or of any type if taskType is empty)
+// to the queue with reset attempts counter.
+func (s *MemoryStorage) RedriveDeadCrawlTasks(ctx context.Context, taskType string, n int64) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	redriven := make(map[int64]bool)
+	deadTasks := make([]*models.DeadCrawlTask, 0, len(s.deadTasks))
+	for _, dead := range s.deadTasks {
+		if int64(len(redriven)) < n && (taskType == "" || dead.Type == taskType) {
+			redriven[dead.TaskId] = true
+			continue
+		}
+		deadTasks = append(deadTasks, dead)
+	}
+	s.deadTasks = deadTasks
+
+	var count int64
+	now := time.Now()
+	for _, task := range s.tasks {
+		if !redriven[task.Id] || task.State != models.CrawlTaskDead {
+			continue
+		}
+		task.State = models.CrawlTaskPending
+		task.Attempts = 0
+		task.LastError = nil
+		task.AvailableAt = now
+		task.UpdatedAt = now
+		count++
+	}
+	return count, nil
+}
+
+// ReleaseCrawlTask returns the task to the queue without counting the attempt, e.g. when the worker is stopped.
+func (s *MemoryStorage) ReleaseCrawlTask(ctx context.Context, id int64, owner string) error {
+	return s.updateLeased(id, owner, func(task *models.CrawlTask, now time.Time) {
+		task.State = models.CrawlTaskPending
+		task.LeaseOwner = nil
+		task.LeaseExpiresAt = nil
+		task.Attempts--
+	})
+}
+
+func (s *MemoryStorage) CountPendingCrawlTasks(ctx context.Context) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	var count int64
+	for _, task := range s.tasks {
+		if isAvailable(task, now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// updateLeased updates a leased task, returning storage.ErrLeaseLost if the task isn't leased to owner anymore.
+func (s *MemoryStorage) updateLeased(id int64, owner string, update func(task *models.CrawlTask, now time.Time)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, task := range s.tasks {
+		if task.Id != id {
+			continue
+		}
+		if task.State != models.CrawlTaskLeased || task.LeaseOwner == nil || *task.LeaseOwner != owner {
+			return storage.ErrLeaseLost
+		}
+		now := time.Now()
+		update(task, now)
+		task.UpdatedAt = now
+		return nil
+	}
+	return storage.ErrLeaseLost
+}
+
+// isAvailable returns true if the task can be claimed.
+func isAvailable(task *models.CrawlTask, now time.Time) bool {
+	return (task.State == models.CrawlTaskPending && !task.AvailableAt.After(now)) ||
+		(task.State == models.CrawlTaskLeased && task.LeaseExpiresAt.Before(now))
+}
+
+func copyTask(task *models.CrawlTask) *models.CrawlTask {
+	copied := *task
+	if task.LeaseOwner != nil {
+		leaseOwner := *task.LeaseOwner
+		copied.LeaseOwner = &leaseOwner
+	}
+	if task.LeaseExpiresAt != nil {
+		leaseExpiresAt := *task.LeaseExpiresAt
+		copied.LeaseExpiresAt = &leaseExpiresAt
+	}
+	if task.LastError != nil {
+		lastError := *task.LastError
+		copied.LastError = &lastError
+	}
+	return &copied
+}
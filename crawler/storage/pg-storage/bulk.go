@@ -0,0 +1,150 @@
+package pg_storage
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+)
+
+// Bulk writes copy rows to a temp table with COPY and move them to their table with a single insert,
+// so conflicts with saved rows are skipped as they are by row by row inserts.
+
+// bulkCopyMinRows is the size of a batch from which rows are saved with COPY. COPY costs a temp table
+// per transaction, so smaller batches are inserted row by row, see BenchmarkAddNewFollowers.
+const bulkCopyMinRows = 1000
+
+var userCopyColumns = []string{"id", "id_str", "screen_name", "name", "created_at", "followers_count", "friends_count",
+	"verified", "date_last_change", "protected", "location", "description", "url", "expanded_url", "statuses_count",
+	"favourites_count", "listed_count", "profile_image_url_https", "default_profile", "default_profile_image", "additional_data"}
+
+var userSnapshotCopyColumns = []string{"user_id", "observed_at", "screen_name", "name", "followers_count", "friends_count",
+	"verified", "protected", "location", "description", "url", "changed_fields"}
+
+func copyFollowersTx(ctx context.Context, tx *sqlx.Tx, followers []*models.Follower) error {
+	err := createTempTableTx(ctx, tx, "followers_import", "followers")
+	if err != nil {
+		return err
+	}
+	rows := make([][]interface{}, 0, len(followers))
+	for _, follower := range followers {
+		rows = append(rows, []interface{}{follower.UserId, follower.FollowerId})
+	}
+	err = copyRowsTx(ctx, tx, "followers_import", []string{"user_id", "follower_id"}, rows)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+INSERT INTO followers (user_id, follower_id) SELECT user_id, follower_id FROM followers_import
+ON CONFLICT ON CONSTRAINT connection DO NOTHING`)
+	return err
+}
+
+// copyUsersTx inserts new users and updates saved ones, which should be locked by the transaction.
+// It returns ids of inserted users.
+func copyUsersTx(ctx context.Context, tx *sqlx.Tx, newUsers, savedUsers []*models.User) (map[int64]bool, error) {
+	err := createTempTableTx(ctx, tx, "users_import", "users")
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]interface{}, 0, len(newUsers)+len(savedUsers))
+	savedIds := make([]int64, 0, len(savedUsers))
+	for _, user := range savedUsers {
+		rows = append(rows, userCopyValues(user))
+		savedIds = append(savedIds, user.Id)
+	}
+	for _, user := range newUsers {
+		rows = append(rows, userCopyValues(user))
+	}
+	err = copyRowsTx(ctx, tx, "users_import", userCopyColumns, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+UPDATE users u SET (screen_name, name, followers_count, friends_count, verified, protected, location, description, url, expanded_url,
+                    statuses_count, favourites_count, listed_count, profile_image_url_https, default_profile, default_profile_image,
+                    additional_data, date_last_change) =
+(i.screen_name, i.name, i.followers_count, i.friends_count, i.verified, i.protected, i.location, i.description, i.url, i.expanded_url,
+ i.statuses_count, i.favourites_count, i.listed_count, i.profile_image_url_https, i.default_profile, i.default_profile_image,
+ i.additional_data, i.date_last_change)
+FROM users_import i WHERE u.id = i.id AND i.id = ANY($1)`, pq.Array(savedIds))
+	if err != nil {
+		return nil, err
+	}
+	insertedIds := make([]int64, 0, len(newUsers))
+	err = tx.SelectContext(ctx, &insertedIds, `
+INSERT INTO users (id, id_str, screen_name, name, created_at, followers_count, friends_count, verified, date_last_change, protected, location,
+                   description, url, expanded_url, statuses_count, favourites_count, listed_count, profile_image_url_https,
+                   default_profile, default_profile_image, additional_data)
+SELECT id, id_str, screen_name, name, created_at, followers_count, friends_count, verified, date_last_change, protected, location,
+       description, url, expanded_url, statuses_count, favourites_count, listed_count, profile_image_url_https,
+       default_profile, default_profile_image, additional_data
+FROM users_import WHERE id <> ALL($1)
+ON CONFLICT ON CONSTRAINT users_pkey DO NOTHING RETURNING id`, pq.Array(savedIds))
+	if err != nil {
+		return nil, err
+	}
+	inserted := make(map[int64]bool, len(insertedIds))
+	for _, id := range insertedIds {
+		inserted[id] = true
+	}
+	return inserted, nil
+}
+
+func copyUserSnapshotsTx(ctx context.Context, tx *sqlx.Tx, snapshots []*models.UserSnapshot) error {
+	rows := make([][]interface{}, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		changedFields := snapshot.ChangedFields
+		if changedFields == nil {
+			changedFields = []string{}
+		}
+		rows = append(rows, []interface{}{snapshot.UserId, snapshot.ObservedAt, snapshot.ScreenName, snapshot.Name,
+			snapshot.FollowersCount, snapshot.FriendsCount, snapshot.Verified, snapshot.Protected, snapshot.Location,
+			snapshot.Description, snapshot.Url, pq.Array(changedFields)})
+	}
+	return copyRowsTx(ctx, tx, "user_snapshots", userSnapshotCopyColumns, rows)
+}
+
+// userCopyValues returns values of userCopyColumns of the user.
+func userCopyValues(user *models.User) []interface{} {
+	return []interface{}{user.Id, user.IdStr, user.ScreenName, user.Name, user.CreatedAt, user.FollowersCount,
+		user.FriendsCount, user.Verified, user.DateLastChange, user.Protected, user.Location, user.Description, user.Url,
+		user.ExpandedUrl, user.StatusesCount, user.FavouritesCount, user.ListedCount, user.ProfileImageUrlHttps,
+		user.DefaultProfile, user.DefaultProfileImage, user.AdditionalData}
+}
+
+// createTempTableTx creates an empty temp table like the table, dropped on commit. A temp table left
+// by a previous bulk write of the transaction is dropped first.
+func createTempTableTx(ctx context.Context, tx *sqlx.Tx, name string, like string) error {
+	_, err := tx.ExecContext(ctx, "DROP TABLE IF EXISTS pg_temp."+name)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "CREATE TEMP TABLE "+name+" (LIKE "+like+" INCLUDING DEFAULTS) ON COMMIT DROP")
+	return err
+}
+
+// copyRowsTx copies rows to the table with COPY FROM STDIN.
+func copyRowsTx(ctx context.Context, tx *sqlx.Tx, table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, row := range rows {
+		_, err = stmt.ExecContext(ctx, row...)
+		if err != nil {
+			return err
+		}
+	}
+	// an exec without arguments finishes the copy
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return stmt.Close()
+}
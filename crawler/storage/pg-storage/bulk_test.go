@@ -0,0 +1,88 @@
+package pg_storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"strconv"
+	"testing"
+)
+
+// Benchmarks compare row by row inserts with COPY on the database from ../../config.yaml, they're skipped
+// if there is none. Rows written by them have got ids from benchmarkFirstId and are deleted afterwards.
+
+const benchmarkFirstId = int64(9000000000000000000)
+
+var benchmarkBatchSizes = []int{200, 1000, 5000, 50000}
+
+func benchmarkStorage(b *testing.B) *PgStorage {
+	conf.Init("../../config.yaml")
+	config, err := conf.LoadConfig()
+	if err != nil {
+		b.Skipf("can't load config, err='%v'", err)
+	}
+	s, err := NewPgStorage(config.PostgresAccess)
+	if err != nil {
+		b.Skipf("can't create pg storage, err='%v'", err)
+	}
+	b.Cleanup(func() {
+		ctx := context.Background()
+		s.pgConn.ExecContext(ctx, "DELETE FROM followers WHERE user_id >= $1", benchmarkFirstId)
+		s.pgConn.ExecContext(ctx, "DELETE FROM user_snapshots WHERE user_id >= $1", benchmarkFirstId)
+		s.pgConn.ExecContext(ctx, "DELETE FROM users WHERE id >= $1", benchmarkFirstId)
+	})
+	return s
+}
+
+func BenchmarkAddNewFollowers(b *testing.B) {
+	s := benchmarkStorage(b)
+	ctx := context.Background()
+	for _, size := range benchmarkBatchSizes {
+		for _, bulk := range []bool{false, true} {
+			b.Run(fmt.Sprintf("size=%d/copy=%t", size, bulk), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					// a new user every iteration, so no edge is skipped as already saved
+					userId := benchmarkFirstId + int64(i)
+					followers := make([]*models.Follower, 0, size)
+					for j := 0; j < size; j++ {
+						followers = append(followers, &models.Follower{UserId: userId, FollowerId: int64(j + 1)})
+					}
+					err := s.addFollowers(ctx, followers, bulk)
+					if err != nil {
+						b.Fatalf("can't save followers, err='%v'", err)
+					}
+					b.StopTimer()
+					s.pgConn.ExecContext(ctx, "DELETE FROM followers WHERE user_id = $1", userId)
+					b.StartTimer()
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkAddNewUsers(b *testing.B) {
+	s := benchmarkStorage(b)
+	ctx := context.Background()
+	for _, size := range benchmarkBatchSizes {
+		for _, bulk := range []bool{false, true} {
+			b.Run(fmt.Sprintf("size=%d/copy=%t", size, bulk), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					users := make([]*models.User, 0, size)
+					for j := 0; j < size; j++ {
+						id := benchmarkFirstId + int64(j)
+						users = append(users, &models.User{Id: id, IdStr: strconv.FormatInt(id, 10), ScreenName: fmt.Sprintf("bench%d", j)})
+					}
+					err := s.addUsers(ctx, users, bulk)
+					if err != nil {
+						b.Fatalf("can't save users, err='%v'", err)
+					}
+					b.StopTimer()
+					s.pgConn.ExecContext(ctx, "DELETE FROM user_snapshots WHERE user_id >= $1", benchmarkFirstId)
+					s.pgConn.ExecContext(ctx, "DELETE FROM users WHERE id >= $1", benchmarkFirstId)
+					b.StartTimer()
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package pg_storage
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migrations are files NNNN_name.up.sql and NNNN_name.down.sql, NNNN is the version of the schema
+// the migration brings. Applied versions are saved to schema_migrations.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationsLockKey is the key of the advisory lock taken while migrating, so processes don't migrate concurrently.
+const migrationsLockKey = 6977001
+
+// ErrSchemaOutdated is returned by NewPgStorage if the database schema isn't the one this binary works with.
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration brings the schema from the previous version to Version with Up, Down reverts it.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration with the time it was applied at, AppliedAt is nil if it isn't applied.
+type MigrationStatus struct {
+	*Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the migrations embedded in the binary in the order they're applied.
+func Migrations() ([]*Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("bad migration file name '%s'", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		data, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrations '%s' and '%s' have the same version", migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d '%s' should have got both up and down files", migration.Version, migration.Name)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations of the database. Every migration is applied in its own transaction.
+type Migrator struct {
+	pgConn     *sqlx.DB
+	migrations []*Migration
+}
+
+func NewMigrator(config conf.PostgresAccessConfig) (*Migrator, error) {
+	pgConn, err := connect(config)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		pgConn.Close()
+		return nil, err
+	}
+	return &Migrator{
+		pgConn:     pgConn,
+		migrations: migrations,
+	}, nil
+}
+
+func (m *Migrator) Close() error {
+	return m.pgConn.Close()
+}
+
+// Status returns all migrations with the time they were applied at.
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	applied, err := appliedMigrations(ctx, m.pgConn)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := &MigrationStatus{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies at most steps not applied migrations, all of them if steps is 0, and returns the applied ones.
+func (m *Migrator) Up(ctx context.Context, steps int) ([]*Migration, error) {
+	_, err := m.pgConn.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    BIGINT PRIMARY KEY,
+    name       TEXT        NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`)
+	if err != nil {
+		return nil, errors.Wrap(err, "create schema_migrations")
+	}
+	done := make([]*Migration, 0)
+	for _, migration := range m.migrations {
+		if steps > 0 && len(done) == steps {
+			break
+		}
+		applied, err := m.apply(ctx, migration, true)
+		if err != nil {
+			return done, errors.Wrapf(err, "apply migration %d '%s'", migration.Version, migration.Name)
+		}
+		if applied {
+			done = append(done, migration)
+		}
+	}
+	return done, nil
+}
+
+// Down reverts at most steps applied migrations, the latest first, and returns the reverted ones.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	done := make([]*Migration, 0, steps)
+	applied, err := appliedMigrations(ctx, m.pgConn)
+	if err != nil || len(applied) == 0 {
+		return done, err
+	}
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		reverted, err := m.apply(ctx, migration, false)
+		if err != nil {
+			return done, errors.Wrapf(err, "revert migration %d '%s'", migration.Version, migration.Name)
+		}
+		if reverted {
+			done = append(done, migration)
+		}
+	}
+	return done, nil
+}
+
+// apply applies the migration if up is set and it isn't applied, or reverts it if up isn't set and it's applied.
+// It returns false if there was nothing to do.
+func (m *Migrator) apply(ctx context.Context, migration *Migration, up bool) (bool, error) {
+	tx, err := m.pgConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	_, txErr = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationsLockKey)
+	if txErr != nil {
+		return false, txErr
+	}
+	var applied bool
+	txErr = tx.GetContext(ctx, &applied, `
+SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version=$1)`, migration.Version)
+	if txErr != nil {
+		return false, txErr
+	}
+	if applied == up {
+		txErr = tx.Rollback()
+		return false, txErr
+	}
+	if up {
+		_, txErr = tx.ExecContext(ctx, migration.Up)
+		if txErr == nil {
+			_, txErr = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+		}
+	} else {
+		_, txErr = tx.ExecContext(ctx, migration.Down)
+		if txErr == nil {
+			_, txErr = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version=$1", migration.Version)
+		}
+	}
+	if txErr != nil {
+		return false, txErr
+	}
+	txErr = tx.Commit()
+	return txErr == nil, txErr
+}
+
+// appliedMigrations returns versions of applied migrations with the time they were applied at,
+// none are applied if there is no schema_migrations yet.
+func appliedMigrations(ctx context.Context, pgConn *sqlx.DB) (map[int64]time.Time, error) {
+	var exists bool
+	err := pgConn.GetContext(ctx, &exists, "SELECT to_regclass('schema_migrations') IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]time.Time)
+	if !exists {
+		return applied, nil
+	}
+	rows, err := pgConn.QueryxContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// checkSchema returns ErrSchemaOutdated if some of the migrations aren't applied or the database has got
+// migrations unknown to this binary.
+func checkSchema(ctx context.Context, pgConn *sqlx.DB) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(ctx, pgConn)
+	if err != nil {
+		return errors.Wrap(err, "can't get applied migrations")
+	}
+	return compareSchema(migrations, applied)
+}
+
+func compareSchema(migrations []*Migration, applied map[int64]time.Time) error {
+	pending := 0
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return errors.Wrapf(ErrSchemaOutdated, "%d of %d migrations aren't applied, run migrate up", pending, len(migrations))
+	}
+	if len(applied) > len(migrations) {
+		return errors.Wrapf(ErrSchemaOutdated, "database has got %d migrations unknown to this binary, it should be updated",
+			len(applied)-len(migrations))
+	}
+	return nil
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS followers;
+DROP TABLE IF EXISTS users;
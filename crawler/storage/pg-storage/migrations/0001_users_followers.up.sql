@@ -0,0 +1,29 @@
+-- users and followers as they were before migrations, tables of databases created by hand are kept as they are
+CREATE TABLE IF NOT EXISTS users
+(
+    id                       BIGINT PRIMARY KEY,
+    id_str                   TEXT        NOT NULL,
+    screen_name              TEXT        NOT NULL,
+    name                     TEXT        NOT NULL,
+    created_at               TEXT        NOT NULL,
+    followers_count          BIGINT      NOT NULL,
+    friends_count            BIGINT      NOT NULL,
+    verified                 BOOLEAN     NOT NULL,
+    additional_data          TEXT,
+    next_cursor              BIGINT      NOT NULL DEFAULT -1,
+    next_cursor_str          TEXT        NOT NULL DEFAULT '-1',
+    are_followers_downloaded BOOLEAN     NOT NULL DEFAULT FALSE,
+    date_last_change         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    protected                BOOLEAN,
+    location                 TEXT
+);
+
+CREATE INDEX IF NOT EXISTS users_screen_name ON users (screen_name);
+
+-- an edge from follower_id to user_id, AddNewFollowers skips saved edges by the connection constraint
+CREATE TABLE IF NOT EXISTS followers
+(
+    user_id     BIGINT NOT NULL,
+    follower_id BIGINT NOT NULL,
+    CONSTRAINT connection PRIMARY KEY (user_id, follower_id)
+);
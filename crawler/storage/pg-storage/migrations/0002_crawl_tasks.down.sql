@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS crawl_tasks_dead;
+DROP TABLE IF EXISTS crawl_tasks;
@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS crawl_tasks
+(
+    id               BIGSERIAL PRIMARY KEY,
+    task_type        TEXT        NOT NULL,
+    task_key         TEXT        NOT NULL,
+    payload          JSONB       NOT NULL,
+    state            TEXT        NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'leased', 'done', 'dead')),
+    priority         INTEGER     NOT NULL DEFAULT 0,
+    attempts         INTEGER     NOT NULL DEFAULT 0,
+    lease_owner      TEXT,
+    lease_expires_at TIMESTAMPTZ,
+    last_error       TEXT,
+    available_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- the same work can be queued again only after the previous task for it is done, dead tasks block it until re-driven
+CREATE UNIQUE INDEX IF NOT EXISTS crawl_tasks_active_key ON crawl_tasks (task_type, task_key) WHERE state <> 'done';
+CREATE INDEX IF NOT EXISTS crawl_tasks_pending ON crawl_tasks (priority DESC, id) WHERE state = 'pending';
+CREATE INDEX IF NOT EXISTS crawl_tasks_leased ON crawl_tasks (lease_expires_at) WHERE state = 'leased';
+
+-- tasks which failed more times than their retry policy allows, see redrive.go
+CREATE TABLE IF NOT EXISTS crawl_tasks_dead
+(
+    id          BIGSERIAL PRIMARY KEY,
+    task_id     BIGINT      NOT NULL REFERENCES crawl_tasks (id),
+    task_type   TEXT        NOT NULL,
+    task_key    TEXT        NOT NULL,
+    attempts    INTEGER     NOT NULL,
+    error_class TEXT        NOT NULL,
+    last_error  TEXT        NOT NULL,
+    failed_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS crawl_tasks_dead_type ON crawl_tasks_dead (task_type, id);
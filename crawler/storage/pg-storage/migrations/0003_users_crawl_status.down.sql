@@ -0,0 +1,9 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS are_followers_downloaded BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users SET are_followers_downloaded = TRUE WHERE crawl_status = 'done';
+
+DROP INDEX IF EXISTS users_crawl_status_pending;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS crawl_status;
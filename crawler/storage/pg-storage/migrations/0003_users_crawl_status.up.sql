@@ -0,0 +1,21 @@
+-- crawl_status replaces are_followers_downloaded, users in states other than 'pending' aren't queued again
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS crawl_status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (crawl_status IN ('pending', 'done', 'protected', 'not_found', 'suspended'));
+
+DO
+$$
+    BEGIN
+        IF EXISTS(SELECT 1
+                  FROM information_schema.columns
+                  WHERE table_name = 'users'
+                    AND column_name = 'are_followers_downloaded') THEN
+            UPDATE users SET crawl_status = 'done' WHERE are_followers_downloaded;
+            -- followers of protected users were requested again and again
+            UPDATE users SET crawl_status = 'protected' WHERE NOT are_followers_downloaded AND protected;
+            ALTER TABLE users DROP COLUMN are_followers_downloaded;
+        END IF;
+    END
+$$;
+
+CREATE INDEX IF NOT EXISTS users_crawl_status_pending ON users (id) WHERE crawl_status = 'pending';
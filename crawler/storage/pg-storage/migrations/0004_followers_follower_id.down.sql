@@ -0,0 +1 @@
+DROP INDEX IF EXISTS followers_follower_id;
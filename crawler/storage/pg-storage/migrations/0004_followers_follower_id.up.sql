@@ -0,0 +1,2 @@
+-- followers/ids crawl saves edges before profiles of followers, they are looked up by follower_id to be hydrated
+CREATE INDEX IF NOT EXISTS followers_follower_id ON followers (follower_id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS users_friends_crawl_status_pending;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS friends_next_cursor,
+    DROP COLUMN IF EXISTS friends_next_cursor_str,
+    DROP COLUMN IF EXISTS friends_crawl_status;
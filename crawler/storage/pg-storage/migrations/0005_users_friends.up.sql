@@ -0,0 +1,9 @@
+-- friends (outgoing follows) are downloaded by download_friends tasks with their own cursor and status,
+-- their edges are saved to followers with user_id being the friend
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS friends_next_cursor     BIGINT NOT NULL DEFAULT -1,
+    ADD COLUMN IF NOT EXISTS friends_next_cursor_str TEXT   NOT NULL DEFAULT '-1',
+    ADD COLUMN IF NOT EXISTS friends_crawl_status    TEXT   NOT NULL DEFAULT 'pending'
+        CHECK (friends_crawl_status IN ('pending', 'done', 'protected', 'not_found', 'suspended'));
+
+CREATE INDEX IF NOT EXISTS users_friends_crawl_status_pending ON users (id) WHERE friends_crawl_status = 'pending';
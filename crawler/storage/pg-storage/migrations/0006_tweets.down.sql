@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS tweets_cursor,
+    DROP COLUMN IF EXISTS tweets_since_id;
+
+DROP TABLE IF EXISTS tweets;
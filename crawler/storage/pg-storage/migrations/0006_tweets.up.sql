@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS tweets
+(
+    id                      BIGINT PRIMARY KEY,
+    user_id                 BIGINT NOT NULL,
+    created_at              TEXT   NOT NULL,
+    full_text               TEXT   NOT NULL,
+    lang                    TEXT   NOT NULL,
+    reply_count             BIGINT NOT NULL,
+    retweet_count           BIGINT NOT NULL,
+    retweeted_status_id_str TEXT   NOT NULL,
+    -- the tweet as returned by twitter
+    raw                     JSONB  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS tweets_user_id ON tweets (user_id, id);
+
+-- tweets_cursor is the position of an unfinished timeline crawl, the next crawl stops at tweets_since_id
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS tweets_cursor   TEXT   NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tweets_since_id BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,15 @@
+-- edges from authors of tweets to users they retweeted, replied to, quoted or mentioned
+CREATE TABLE IF NOT EXISTS interactions
+(
+    user_id         BIGINT      NOT NULL,
+    target_user_id  BIGINT      NOT NULL,
+    type            TEXT        NOT NULL CHECK (type IN ('retweet', 'reply', 'quote', 'mention')),
+    tweet_id        BIGINT      NOT NULL,
+    -- 0 for mentions
+    target_tweet_id BIGINT      NOT NULL DEFAULT 0,
+    created_at      TIMESTAMPTZ NOT NULL,
+    CONSTRAINT interactions_pkey PRIMARY KEY (tweet_id, type, target_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS interactions_user_id ON interactions (user_id);
+CREATE INDEX IF NOT EXISTS interactions_target_user_id ON interactions (target_user_id);
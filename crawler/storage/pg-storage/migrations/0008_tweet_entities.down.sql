@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS tweet_media;
+DROP TABLE IF EXISTS tweet_mentions;
+DROP TABLE IF EXISTS tweet_urls;
+DROP TABLE IF EXISTS tweet_hashtags;
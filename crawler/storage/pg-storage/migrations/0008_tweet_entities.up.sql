@@ -0,0 +1,76 @@
+-- entities of tweets parsed by twitter, start_index and end_index are their positions in tweet text
+CREATE TABLE IF NOT EXISTS tweet_hashtags
+(
+    tweet_id    BIGINT  NOT NULL,
+    -- lower cased
+    tag         TEXT    NOT NULL,
+    start_index INTEGER NOT NULL,
+    end_index   INTEGER NOT NULL,
+    CONSTRAINT tweet_hashtags_pkey PRIMARY KEY (tweet_id, start_index)
+);
+
+CREATE INDEX IF NOT EXISTS tweet_hashtags_tag ON tweet_hashtags (tag);
+
+CREATE TABLE IF NOT EXISTS tweet_urls
+(
+    tweet_id     BIGINT  NOT NULL,
+    url          TEXT    NOT NULL,
+    expanded_url TEXT    NOT NULL,
+    -- lower cased host of expanded_url without www.
+    domain       TEXT    NOT NULL,
+    start_index  INTEGER NOT NULL,
+    end_index    INTEGER NOT NULL,
+    CONSTRAINT tweet_urls_pkey PRIMARY KEY (tweet_id, start_index)
+);
+
+CREATE INDEX IF NOT EXISTS tweet_urls_domain ON tweet_urls (domain);
+
+CREATE TABLE IF NOT EXISTS tweet_mentions
+(
+    tweet_id    BIGINT  NOT NULL,
+    user_id     BIGINT  NOT NULL,
+    screen_name TEXT    NOT NULL,
+    start_index INTEGER NOT NULL,
+    end_index   INTEGER NOT NULL,
+    CONSTRAINT tweet_mentions_pkey PRIMARY KEY (tweet_id, start_index)
+);
+
+CREATE INDEX IF NOT EXISTS tweet_mentions_user_id ON tweet_mentions (user_id);
+
+CREATE TABLE IF NOT EXISTS tweet_media
+(
+    tweet_id  BIGINT NOT NULL,
+    media_id  BIGINT NOT NULL,
+    -- photo, video or animated_gif
+    type      TEXT   NOT NULL,
+    media_url TEXT   NOT NULL,
+    alt_text  TEXT   NOT NULL,
+    CONSTRAINT tweet_media_pkey PRIMARY KEY (tweet_id, media_id)
+);
+
+-- entities of tweets saved before the tables were created
+INSERT INTO tweet_hashtags (tweet_id, tag, start_index, end_index)
+SELECT t.id, lower(h ->> 'text'), (h -> 'indices' ->> 0)::INTEGER, (h -> 'indices' ->> 1)::INTEGER
+FROM tweets t, jsonb_array_elements(COALESCE(t.raw -> 'entities' -> 'hashtags', '[]')) h
+ON CONFLICT ON CONSTRAINT tweet_hashtags_pkey DO NOTHING;
+
+INSERT INTO tweet_urls (tweet_id, url, expanded_url, domain, start_index, end_index)
+SELECT t.id,
+       u ->> 'url',
+       u ->> 'expanded_url',
+       regexp_replace(lower(COALESCE(substring(u ->> 'expanded_url' FROM '^[a-zA-Z]+://([^/:?#]+)'), '')), '^www\.', ''),
+       (u -> 'indices' ->> 0)::INTEGER,
+       (u -> 'indices' ->> 1)::INTEGER
+FROM tweets t, jsonb_array_elements(COALESCE(t.raw -> 'entities' -> 'urls', '[]')) u
+ON CONFLICT ON CONSTRAINT tweet_urls_pkey DO NOTHING;
+
+INSERT INTO tweet_mentions (tweet_id, user_id, screen_name, start_index, end_index)
+SELECT t.id, (m ->> 'id_str')::BIGINT, COALESCE(m ->> 'screen_name', ''), (m -> 'indices' ->> 0)::INTEGER, (m -> 'indices' ->> 1)::INTEGER
+FROM tweets t, jsonb_array_elements(COALESCE(t.raw -> 'entities' -> 'user_mentions', '[]')) m
+ON CONFLICT ON CONSTRAINT tweet_mentions_pkey DO NOTHING;
+
+INSERT INTO tweet_media (tweet_id, media_id, type, media_url, alt_text)
+SELECT t.id, (m ->> 'id_str')::BIGINT, m ->> 'type', COALESCE(m ->> 'media_url_https', ''), COALESCE(m ->> 'ext_alt_text', '')
+FROM tweets t,
+     jsonb_array_elements(COALESCE(t.raw -> 'extended_entities' -> 'media', t.raw -> 'entities' -> 'media', '[]')) m
+ON CONFLICT ON CONSTRAINT tweet_media_pkey DO NOTHING;
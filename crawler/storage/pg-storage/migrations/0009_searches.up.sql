@@ -0,0 +1,9 @@
+-- progress of search crawls, see SearchTweetsTask
+CREATE TABLE IF NOT EXISTS searches
+(
+    search_key       TEXT PRIMARY KEY,
+    cursor           TEXT        NOT NULL,
+    slice_until      TIMESTAMPTZ NOT NULL,
+    done             BOOLEAN     NOT NULL DEFAULT FALSE,
+    date_last_change TIMESTAMPTZ NOT NULL DEFAULT now()
+);
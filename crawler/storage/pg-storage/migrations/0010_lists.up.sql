@@ -0,0 +1,31 @@
+-- twitter lists, members and subscribers of a list are crawled separately with their own cursors
+CREATE TABLE IF NOT EXISTS lists
+(
+    id                          BIGINT PRIMARY KEY,
+    id_str                      TEXT        NOT NULL,
+    name                        TEXT        NOT NULL,
+    slug                        TEXT        NOT NULL,
+    description                 TEXT        NOT NULL,
+    mode                        TEXT        NOT NULL,
+    member_count                BIGINT      NOT NULL,
+    subscriber_count            BIGINT      NOT NULL,
+    created_at                  TEXT        NOT NULL,
+    owner_id                    BIGINT      NOT NULL,
+    members_next_cursor_str     TEXT        NOT NULL DEFAULT '-1',
+    members_crawl_status        TEXT        NOT NULL DEFAULT 'pending'
+        CHECK (members_crawl_status IN ('pending', 'done', 'protected', 'not_found', 'suspended')),
+    subscribers_next_cursor_str TEXT        NOT NULL DEFAULT '-1',
+    subscribers_crawl_status    TEXT        NOT NULL DEFAULT 'pending'
+        CHECK (subscribers_crawl_status IN ('pending', 'done', 'protected', 'not_found', 'suspended')),
+    date_last_change            TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS list_memberships
+(
+    list_id  BIGINT NOT NULL,
+    user_id  BIGINT NOT NULL,
+    relation TEXT   NOT NULL CHECK (relation IN ('member', 'subscriber')),
+    CONSTRAINT list_memberships_pkey PRIMARY KEY (list_id, relation, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS list_memberships_user_id ON list_memberships (user_id);
@@ -0,0 +1,24 @@
+-- every observed version of user profiles, users keeps the latest one
+CREATE TABLE IF NOT EXISTS user_snapshots
+(
+    id              BIGSERIAL PRIMARY KEY,
+    user_id         BIGINT      NOT NULL,
+    observed_at     TIMESTAMPTZ NOT NULL,
+    screen_name     TEXT        NOT NULL,
+    name            TEXT        NOT NULL,
+    followers_count BIGINT      NOT NULL,
+    friends_count   BIGINT      NOT NULL,
+    verified        BOOLEAN     NOT NULL,
+    protected       BOOLEAN,
+    location        TEXT,
+    -- columns of users changed since the previous version, empty for the first one
+    changed_fields  TEXT[]      NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS user_snapshots_user_id ON user_snapshots (user_id, observed_at);
+
+-- the first versions of users saved before snapshots
+INSERT INTO user_snapshots (user_id, observed_at, screen_name, name, followers_count, friends_count, verified, protected, location)
+SELECT u.id, u.date_last_change, u.screen_name, u.name, u.followers_count, u.friends_count, u.verified, u.protected, u.location
+FROM users u
+WHERE NOT EXISTS (SELECT 1 FROM user_snapshots s WHERE s.user_id = u.id);
@@ -0,0 +1,17 @@
+ALTER TABLE user_snapshots
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS url;
+
+DROP INDEX IF EXISTS users_not_hydrated;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS url,
+    DROP COLUMN IF EXISTS expanded_url,
+    DROP COLUMN IF EXISTS statuses_count,
+    DROP COLUMN IF EXISTS favourites_count,
+    DROP COLUMN IF EXISTS listed_count,
+    DROP COLUMN IF EXISTS profile_image_url_https,
+    DROP COLUMN IF EXISTS default_profile,
+    DROP COLUMN IF EXISTS default_profile_image,
+    ALTER COLUMN additional_data TYPE TEXT;
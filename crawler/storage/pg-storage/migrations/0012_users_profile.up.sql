@@ -0,0 +1,23 @@
+-- the full profile of users, additional_data is the user as returned by twitter,
+-- users saved before it was kept are re-hydrated by backfill-users.go
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS description             TEXT    NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS url                     TEXT,
+    ADD COLUMN IF NOT EXISTS expanded_url            TEXT    NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS statuses_count          BIGINT  NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS favourites_count        BIGINT  NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS listed_count            BIGINT  NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS profile_image_url_https TEXT    NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS default_profile         BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS default_profile_image   BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS additional_data         JSONB;
+
+-- additional_data has never been filled
+ALTER TABLE users
+    ALTER COLUMN additional_data TYPE JSONB USING additional_data::JSONB;
+
+CREATE INDEX IF NOT EXISTS users_not_hydrated ON users (id) WHERE additional_data IS NULL;
+
+ALTER TABLE user_snapshots
+    ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS url         TEXT;
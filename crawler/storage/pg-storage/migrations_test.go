@@ -0,0 +1,39 @@
+package pg_storage
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEmpty(t, migrations)
+	for i, migration := range migrations {
+		assert.Equal(t, int64(i+1), migration.Version)
+		assert.NotEmpty(t, migration.Up, "migration %d", migration.Version)
+		assert.NotEmpty(t, migration.Down, "migration %d", migration.Version)
+	}
+	assert.Equal(t, "users_followers", migrations[0].Name)
+	assert.Contains(t, migrations[0].Up, "CONSTRAINT connection")
+}
+
+func TestCompareSchema(t *testing.T) {
+	migrations := []*Migration{{Version: 1}, {Version: 2}, {Version: 3}}
+	now := time.Now()
+
+	assert.NoError(t, compareSchema(migrations, map[int64]time.Time{1: now, 2: now, 3: now}))
+
+	err := compareSchema(migrations, map[int64]time.Time{})
+	assert.True(t, errors.Is(err, ErrSchemaOutdated), "nothing is applied to a new database")
+
+	err = compareSchema(migrations, map[int64]time.Time{1: now, 3: now})
+	assert.True(t, errors.Is(err, ErrSchemaOutdated))
+
+	err = compareSchema(migrations, map[int64]time.Time{1: now, 2: now, 3: now, 4: now})
+	assert.True(t, errors.Is(err, ErrSchemaOutdated), "database migrated by a newer binary")
+}
@@ -1,12 +1,17 @@
 package pg_storage
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
 	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
 	"github.com/scarecrow6977/twitter-crawler/crawler/models"
 	"net/url"
+	"sort"
 	"time"
 )
 
@@ -14,7 +19,27 @@ type PgStorage struct {
 	pgConn *sqlx.DB
 }
 
+// NewPgStorage connects to the database and checks that its schema is up to date, see Migrator.
 func NewPgStorage(config conf.PostgresAccessConfig) (*PgStorage, error) {
+	pgConn, err := connect(config)
+	if err != nil {
+		return nil, err
+	}
+	err = checkSchema(context.Background(), pgConn)
+	if err != nil {
+		pgConn.Close()
+		return nil, err
+	}
+	return &PgStorage{
+		pgConn: pgConn,
+	}, nil
+}
+
+func (s *PgStorage) Close() error {
+	return s.pgConn.Close()
+}
+
+func connect(config conf.PostgresAccessConfig) (*sqlx.DB, error) {
 	var userInfo *url.Userinfo
 	if config.Password != nil {
 		userInfo = url.UserPassword(config.User, *config.Password)
@@ -34,29 +59,28 @@ func NewPgStorage(config conf.PostgresAccessConfig) (*PgStorage, error) {
 	q := connUrl.Query()
 	q.Add("sslmode", "disable")
 	connUrl.RawQuery = q.Encode()
-	pgConn, err := sqlx.Open("postgres", connUrl.String())
-	if err != nil {
-		return nil, err
-	}
-	return &PgStorage{
-		pgConn: pgConn,
-	}, nil
+	return sqlx.Open("postgres", connUrl.String())
 }
 
-func (s *PgStorage) SaveFollower(userId, followerId int64) error {
+func (s *PgStorage) SaveFollower(ctx context.Context, userId, followerId int64) error {
 	follower := &models.Follower{
 		UserId:     userId,
 		FollowerId: followerId,
 	}
-	_, err := s.pgConn.NamedExec("INSERT INTO followers (user_id, follower_id) VALUES (:user_id, :follower_id)", follower)
+	_, err := s.pgConn.NamedExecContext(ctx, "INSERT INTO followers (user_id, follower_id) VALUES (:user_id, :follower_id)", follower)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *PgStorage) AddNewFollowers(followers []*models.Follower) error {
-	tx, err := s.pgConn.Beginx()
+// AddNewFollowers saves edges which aren't saved yet, batches of bulkCopyMinRows edges and more are saved with COPY.
+func (s *PgStorage) AddNewFollowers(ctx context.Context, followers []*models.Follower) error {
+	return s.addFollowers(ctx, followers, len(followers) >= bulkCopyMinRows)
+}
+
+func (s *PgStorage) addFollowers(ctx context.Context, followers []*models.Follower, bulk bool) error {
+	tx, err := s.pgConn.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -66,30 +90,233 @@ func (s *PgStorage) AddNewFollowers(followers []*models.Follower) error {
 			tx.Rollback()
 		}
 	}()
-	stmt, txErr := tx.Preparex(`INSERT INTO followers (user_id, follower_id) VALUES ($1, $2) ON CONFLICT ON CONSTRAINT connection DO NOTHING`) // pq.CopyIn("followers", "user_id", "follower_id")
+	txErr = addFollowersTx(ctx, tx, followers, bulk)
 	if txErr != nil {
 		return txErr
 	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+// addFollowersTx saves edges which aren't saved yet, with COPY if bulk is set.
+func addFollowersTx(ctx context.Context, tx *sqlx.Tx, followers []*models.Follower, bulk bool) error {
+	if bulk {
+		return copyFollowersTx(ctx, tx, followers)
+	}
+	stmt, err := tx.PreparexContext(ctx, `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2) ON CONFLICT ON CONSTRAINT connection DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
 	for _, follower := range followers {
-		_, txErr = stmt.Exec(follower.UserId, follower.FollowerId)
-		if txErr != nil {
-			return txErr
+		_, err = stmt.ExecContext(ctx, follower.UserId, follower.FollowerId)
+		if err != nil {
+			return err
 		}
 	}
-	_, txErr = stmt.Exec()
+	return nil
+}
+
+// AddNewUsers saves new users and updates profiles of saved ones, keeping their crawl state. Every new version
+// of a profile is saved to user_snapshots. Batches of bulkCopyMinRows users and more are saved with COPY.
+func (s *PgStorage) AddNewUsers(ctx context.Context, users []*models.User) error {
+	return s.addUsers(ctx, users, len(users) >= bulkCopyMinRows)
+}
+
+func (s *PgStorage) addUsers(ctx context.Context, users []*models.User, bulk bool) error {
+	tx, err := s.pgConn.BeginTxx(ctx, nil)
 	if err != nil {
-		return txErr
+		return err
 	}
-	txErr = stmt.Close()
-	if err != nil {
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	txErr = addUsersTx(ctx, tx, users, bulk)
+	if txErr != nil {
 		return txErr
 	}
 	txErr = tx.Commit()
 	return txErr
 }
 
-func (s *PgStorage) AddNewUsers(users []*models.User) error {
-	tx, err := s.pgConn.Beginx()
+// addUsersTx saves the users and their new versions with COPY if bulk is set.
+func addUsersTx(ctx context.Context, tx *sqlx.Tx, users []*models.User, bulk bool) error {
+	byId := make(map[int64]*models.User, len(users))
+	ids := make([]int64, 0, len(users))
+	for _, user := range users {
+		if _, ok := byId[user.Id]; !ok {
+			ids = append(ids, user.Id)
+		}
+		byId[user.Id] = user
+	}
+	// rows are locked in order of ids, so concurrent saves of the same users don't deadlock
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	saved := make([]*models.User, 0, len(ids))
+	err := tx.SelectContext(ctx, &saved, "SELECT * FROM users WHERE id = ANY($1) ORDER BY id FOR UPDATE", pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	savedById := make(map[int64]*models.User, len(saved))
+	for _, user := range saved {
+		savedById[user.Id] = user
+	}
+
+	now := time.Now()
+	newUsers := make([]*models.User, 0, len(ids)-len(saved))
+	savedUsers := make([]*models.User, 0, len(saved))
+	snapshots := make([]*models.UserSnapshot, 0)
+	for _, id := range ids {
+		user := byId[id]
+		user.DateLastChange = now
+		old, ok := savedById[id]
+		if !ok {
+			newUsers = append(newUsers, user)
+			continue
+		}
+		if user.AdditionalData == nil {
+			user.AdditionalData = old.AdditionalData
+		}
+		// counters which aren't a part of the history are updated even if the profile is the same
+		savedUsers = append(savedUsers, user)
+		changes := models.ProfileChanges(old, user)
+		if len(changes) > 0 {
+			snapshots = append(snapshots, models.NewUserSnapshot(user, now, changes))
+		}
+	}
+
+	var inserted map[int64]bool
+	if bulk {
+		inserted, err = copyUsersTx(ctx, tx, newUsers, savedUsers)
+	} else {
+		inserted, err = insertUsersTx(ctx, tx, newUsers, savedUsers)
+	}
+	if err != nil {
+		return err
+	}
+	// users which have just been saved by another transaction aren't inserted, their versions are saved by that one
+	for _, user := range newUsers {
+		if inserted[user.Id] {
+			snapshots = append(snapshots, models.NewUserSnapshot(user, now, nil))
+		}
+	}
+	if bulk {
+		return copyUserSnapshotsTx(ctx, tx, snapshots)
+	}
+	for _, snapshot := range snapshots {
+		err = addUserSnapshotTx(ctx, tx, snapshot)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertUsersTx inserts new users and updates saved ones row by row, it returns ids of inserted users.
+func insertUsersTx(ctx context.Context, tx *sqlx.Tx, newUsers, savedUsers []*models.User) (map[int64]bool, error) {
+	for _, user := range savedUsers {
+		_, err := tx.NamedExecContext(ctx, `
+UPDATE users SET (screen_name, name, followers_count, friends_count, verified, protected, location, description, url, expanded_url, 
+                  statuses_count, favourites_count, listed_count, profile_image_url_https, default_profile, default_profile_image, 
+                  additional_data, date_last_change) = 
+(:screen_name, :name, :followers_count, :friends_count, :verified, :protected, :location, :description, :url, :expanded_url, 
+ :statuses_count, :favourites_count, :listed_count, :profile_image_url_https, :default_profile, :default_profile_image, 
+ :additional_data, :date_last_change) WHERE id=:id`, user)
+		if err != nil {
+			return nil, err
+		}
+	}
+	inserted := make(map[int64]bool, len(newUsers))
+	for _, user := range newUsers {
+		result, err := tx.NamedExecContext(ctx, `
+INSERT INTO users (id, id_str, screen_name, name, created_at, followers_count, friends_count, verified, date_last_change, protected, location, 
+                   description, url, expanded_url, statuses_count, favourites_count, listed_count, profile_image_url_https, 
+                   default_profile, default_profile_image, additional_data) 
+VALUES (:id, :id_str, :screen_name, :name, :created_at, :followers_count, :friends_count, :verified, :date_last_change, :protected, :location, 
+        :description, :url, :expanded_url, :statuses_count, :favourites_count, :listed_count, :profile_image_url_https, 
+        :default_profile, :default_profile_image, :additional_data) 
+ON CONFLICT ON CONSTRAINT users_pkey DO NOTHING`, user)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		inserted[user.Id] = rows > 0
+	}
+	return inserted, nil
+}
+
+func addUserSnapshotTx(ctx context.Context, tx *sqlx.Tx, snapshot *models.UserSnapshot) error {
+	changedFields := snapshot.ChangedFields
+	if changedFields == nil {
+		changedFields = []string{}
+	}
+	_, err := tx.ExecContext(ctx, `
+INSERT INTO user_snapshots (user_id, observed_at, screen_name, name, followers_count, friends_count, verified, protected, location, 
+                            description, url, changed_fields) 
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		snapshot.UserId, snapshot.ObservedAt, snapshot.ScreenName, snapshot.Name, snapshot.FollowersCount,
+		snapshot.FriendsCount, snapshot.Verified, snapshot.Protected, snapshot.Location, snapshot.Description, snapshot.Url,
+		pq.Array(changedFields))
+	return err
+}
+
+// GetUserSnapshots returns observed versions of the profile of the user, oldest first.
+func (s *PgStorage) GetUserSnapshots(ctx context.Context, userId int64) ([]*models.UserSnapshot, error) {
+	rows, err := s.pgConn.QueryxContext(ctx, `
+SELECT user_id, observed_at, screen_name, name, followers_count, friends_count, verified, protected, location, description, url, 
+       changed_fields 
+FROM user_snapshots WHERE user_id=$1 ORDER BY observed_at, id`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	snapshots := make([]*models.UserSnapshot, 0)
+	for rows.Next() {
+		snapshot := &models.UserSnapshot{}
+		var changedFields pq.StringArray
+		err = rows.Scan(&snapshot.UserId, &snapshot.ObservedAt, &snapshot.ScreenName, &snapshot.Name, &snapshot.FollowersCount,
+			&snapshot.FriendsCount, &snapshot.Verified, &snapshot.Protected, &snapshot.Location, &snapshot.Description,
+			&snapshot.Url, &changedFields)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.ChangedFields = changedFields
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+const updateUserStateQuery = `UPDATE users SET (next_cursor, next_cursor_str, crawl_status, date_last_change, protected, location) = 
+(:next_cursor, :next_cursor_str, :crawl_status, :date_last_change, :protected, :location) WHERE id=:id
+`
+
+const updateUserFriendsStateQuery = `UPDATE users SET (friends_next_cursor, friends_next_cursor_str, friends_crawl_status, date_last_change) = 
+(:friends_next_cursor, :friends_next_cursor_str, :friends_crawl_status, :date_last_change) WHERE id=:id
+`
+
+func (s *PgStorage) UpdateUserState(ctx context.Context, user *models.User) error {
+	user.DateLastChange = time.Now()
+	_, err := s.pgConn.NamedExecContext(ctx, updateUserStateQuery, user)
+	return err
+}
+
+func (s *PgStorage) UpdateUserFriendsState(ctx context.Context, user *models.User) error {
+	user.DateLastChange = time.Now()
+	_, err := s.pgConn.NamedExecContext(ctx, updateUserFriendsStateQuery, user)
+	return err
+}
+
+// CommitFollowersPage saves users, edges and the state of the user of the page in one transaction.
+func (s *PgStorage) CommitFollowersPage(ctx context.Context, page *models.FollowersPage) error {
+	tx, err := s.pgConn.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -99,108 +326,439 @@ func (s *PgStorage) AddNewUsers(users []*models.User) error {
 			tx.Rollback()
 		}
 	}()
-	stmt, txErr := tx.PrepareNamed(
-		`
-INSERT INTO users (id, id_str, screen_name, name, created_at, followers_count, friends_count, verified, date_last_change, protected, location) 
-VALUES (:id, :id_str, :screen_name, :name, :created_at, :followers_count, :friends_count, :verified, :date_last_change, :protected, :location) 
-ON CONFLICT ON CONSTRAINT users_pkey DO NOTHING`)
-	if txErr != nil {
-		return txErr
-	}
-	for _, user := range users {
-		user.DateLastChange = time.Now()
-		_, txErr = stmt.Exec(user)
+	if len(page.Users) > 0 {
+		txErr = addUsersTx(ctx, tx, page.Users, len(page.Users) >= bulkCopyMinRows)
 		if txErr != nil {
 			return txErr
 		}
 	}
-	//_, txErr = stmt.Exec()
-	//if err != nil {
-	//	return txErr
-	//}
-	txErr = stmt.Close()
-	if err != nil {
+	txErr = addFollowersTx(ctx, tx, page.Followers, len(page.Followers) >= bulkCopyMinRows)
+	if txErr != nil {
+		return txErr
+	}
+	query := updateUserStateQuery
+	if page.Friends {
+		query = updateUserFriendsStateQuery
+	}
+	page.User.DateLastChange = time.Now()
+	_, txErr = tx.NamedExecContext(ctx, query, page.User)
+	if txErr != nil {
 		return txErr
 	}
 	txErr = tx.Commit()
 	return txErr
 }
 
-func (s *PgStorage) UpdateUserState(user *models.User) error {
+func (s *PgStorage) UpdateUserTweetsState(ctx context.Context, user *models.User) error {
 	user.DateLastChange = time.Now()
-	_, err := s.pgConn.NamedExec(
-		`UPDATE users SET (next_cursor, next_cursor_str, are_followers_downloaded, date_last_change, protected, location) = 
-(:next_cursor, :next_cursor_str, :are_followers_downloaded, :date_last_change, :protected, :location) WHERE id=:id
+	_, err := s.pgConn.NamedExecContext(ctx,
+		`UPDATE users SET (tweets_cursor, tweets_since_id, date_last_change) = 
+(:tweets_cursor, :tweets_since_id, :date_last_change) WHERE id=:id
 `, user)
 	return err
 }
 
-func (s *PgStorage) GetUserById(id int64) (*models.User, error) {
+func (s *PgStorage) GetUserById(ctx context.Context, id int64) (*models.User, error) {
 	user := &models.User{}
-	err := s.pgConn.Get(user, "SELECT * FROM users WHERE users.id=$1 LIMIT 1", id)
+	err := s.pgConn.GetContext(ctx, user, "SELECT * FROM users WHERE users.id=$1 LIMIT 1", id)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-func (s *PgStorage) GetUserByScreenName(screenName string) (*models.User, error) {
+func (s *PgStorage) GetUserByScreenName(ctx context.Context, screenName string) (*models.User, error) {
 	user := &models.User{}
-	err := s.pgConn.Get(user, "SELECT * FROM users WHERE users.screen_name=$1 LIMIT 1", screenName)
+	err := s.pgConn.GetContext(ctx, user, "SELECT * FROM users WHERE users.screen_name=$1 LIMIT 1", screenName)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-func (s *PgStorage) GetUsersWithNotDownloadedFollowers(n int64) ([]*models.User, error) {
+func (s *PgStorage) GetUsersWithNotDownloadedFollowers(ctx context.Context, n int64) ([]*models.User, error) {
+	users := make([]*models.User, 0, n)
+	// users already queued for downloading are skipped, see EnqueueCrawlTasks
+	err := s.pgConn.SelectContext(ctx, &users, `
+SELECT * FROM users WHERE users.crawl_status=$3 AND NOT EXISTS (
+    SELECT 1 FROM crawl_tasks t WHERE t.task_type IN ($2, $4) AND t.task_key=users.screen_name AND t.state <> 'done'
+) LIMIT $1`, n, models.TaskTypeDownloadFollowers, models.CrawlStatusPending, models.TaskTypeDownloadFollowerIds)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *PgStorage) GetUsersWithNotDownloadedFriends(ctx context.Context, n int64) ([]*models.User, error) {
 	users := make([]*models.User, 0, n)
-	err := s.pgConn.Select(&users, "SELECT * FROM users WHERE users.are_followers_downloaded=false LIMIT $1", n)
+	err := s.pgConn.SelectContext(ctx, &users, `
+SELECT * FROM users WHERE users.friends_crawl_status=$3 AND NOT EXISTS (
+    SELECT 1 FROM crawl_tasks t WHERE t.task_type=$2 AND t.task_key=users.screen_name AND t.state <> 'done'
+) LIMIT $1`, n, models.TaskTypeDownloadFriends, models.CrawlStatusPending)
 	if err != nil {
 		return nil, err
 	}
 	return users, nil
 }
 
-func (s *PgStorage) GetUsersWithNotDownloadedFollowersSorted(n, offset int64) ([]*models.User, error) {
+func (s *PgStorage) GetUsersWithNotDownloadedFollowersSorted(ctx context.Context, n, offset int64) ([]*models.User, error) {
 	users := make([]*models.User, 0, n)
-	err := s.pgConn.Select(&users, "SELECT * FROM users WHERE users.are_followers_downloaded=false ORDER BY users.id LIMIT $1 OFFSET $2 ", n, offset)
+	err := s.pgConn.SelectContext(ctx, &users, "SELECT * FROM users WHERE users.crawl_status=$3 ORDER BY users.id LIMIT $1 OFFSET $2 ", n, offset, models.CrawlStatusPending)
 	if err != nil {
 		return nil, err
 	}
 	return users, nil
 }
 
-func (s *PgStorage) GetUsersWithDownloadedFollowers(n int64) ([]*models.User, error) {
+func (s *PgStorage) GetUsersWithDownloadedFollowers(ctx context.Context, n int64) ([]*models.User, error) {
 	users := make([]*models.User, 0, n)
-	err := s.pgConn.Select(&users, "SELECT * FROM users WHERE users.are_followers_downloaded=true LIMIT $1", n)
+	err := s.pgConn.SelectContext(ctx, &users, "SELECT * FROM users WHERE users.crawl_status=$2 LIMIT $1", n, models.CrawlStatusDone)
 	if err != nil {
 		return nil, err
 	}
 	return users, nil
 }
 
-func (s *PgStorage) GetUsersWithDownloadedFollowersSorted(n, offset int64) ([]*models.User, error) {
+func (s *PgStorage) GetUsersWithDownloadedFollowersSorted(ctx context.Context, n, offset int64) ([]*models.User, error) {
 	users := make([]*models.User, 0, n)
-	err := s.pgConn.Select(&users, "SELECT * FROM users WHERE users.are_followers_downloaded=true ORDER BY users.id LIMIT $1 OFFSET $2", n, offset)
+	err := s.pgConn.SelectContext(ctx, &users, "SELECT * FROM users WHERE users.crawl_status=$3 ORDER BY users.id LIMIT $1 OFFSET $2", n, offset, models.CrawlStatusDone)
 	if err != nil {
 		return nil, err
 	}
 	return users, nil
 }
 
-func (s *PgStorage) GetFollowers(userId int64) ([]*models.User, error) {
+func (s *PgStorage) GetUnknownUserIds(ctx context.Context, afterId, n int64) ([]int64, error) {
+	userIds := make([]int64, 0, n)
+	// friends of crawled users are on the user_id side of edges
+	err := s.pgConn.SelectContext(ctx, &userIds, `
+SELECT ids.id FROM (
+    SELECT f.follower_id AS id FROM followers f WHERE f.follower_id > $1
+    UNION
+    SELECT f.user_id AS id FROM followers f WHERE f.user_id > $1
+) ids
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id=ids.id)
+ORDER BY ids.id LIMIT $2`, afterId, n)
+	if err != nil {
+		return nil, err
+	}
+	return userIds, nil
+}
+
+// GetNotHydratedUserIds returns ids of saved users without additional data, ascending from afterId.
+// Users not found by hydration are skipped.
+func (s *PgStorage) GetNotHydratedUserIds(ctx context.Context, afterId, n int64) ([]int64, error) {
+	userIds := make([]int64, 0, n)
+	err := s.pgConn.SelectContext(ctx, &userIds, `
+SELECT id FROM users WHERE additional_data IS NULL AND crawl_status <> 'not_found' AND id > $1
+ORDER BY id LIMIT $2`, afterId, n)
+	if err != nil {
+		return nil, err
+	}
+	return userIds, nil
+}
+
+func (s *PgStorage) AddNewTweets(ctx context.Context, tweets []*models.Tweet) error {
+	tx, err := s.pgConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	stmt, txErr := tx.PrepareNamedContext(ctx,
+		`
+INSERT INTO tweets (id, user_id, created_at, full_text, lang, reply_count, retweet_count, retweeted_status_id_str, raw) 
+VALUES (:id, :user_id, :created_at, :full_text, :lang, :reply_count, :retweet_count, :retweeted_status_id_str, :raw) 
+ON CONFLICT ON CONSTRAINT tweets_pkey DO NOTHING`)
+	if txErr != nil {
+		return txErr
+	}
+	for _, tweet := range tweets {
+		if tweet.Raw == "" {
+			raw, err := json.Marshal(tweet)
+			if err != nil {
+				txErr = err
+				return txErr
+			}
+			tweet.Raw = string(raw)
+		}
+		_, txErr = stmt.ExecContext(ctx, tweet)
+		if txErr != nil {
+			return txErr
+		}
+		txErr = addTweetEntitiesTx(ctx, tx, tweet)
+		if txErr != nil {
+			return txErr
+		}
+	}
+	txErr = stmt.Close()
+	if txErr != nil {
+		return txErr
+	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+// addTweetEntitiesTx saves hashtags, urls, mentions and media of the tweet to their tables.
+func addTweetEntitiesTx(ctx context.Context, tx *sqlx.Tx, tweet *models.Tweet) error {
+	for _, hashtag := range tweet.Hashtags() {
+		_, err := tx.NamedExecContext(ctx, `
+INSERT INTO tweet_hashtags (tweet_id, tag, start_index, end_index) VALUES (:tweet_id, :tag, :start_index, :end_index)
+ON CONFLICT ON CONSTRAINT tweet_hashtags_pkey DO NOTHING`, hashtag)
+		if err != nil {
+			return err
+		}
+	}
+	for _, u := range tweet.Urls() {
+		_, err := tx.NamedExecContext(ctx, `
+INSERT INTO tweet_urls (tweet_id, url, expanded_url, domain, start_index, end_index) 
+VALUES (:tweet_id, :url, :expanded_url, :domain, :start_index, :end_index)
+ON CONFLICT ON CONSTRAINT tweet_urls_pkey DO NOTHING`, u)
+		if err != nil {
+			return err
+		}
+	}
+	for _, mention := range tweet.Mentions() {
+		_, err := tx.NamedExecContext(ctx, `
+INSERT INTO tweet_mentions (tweet_id, user_id, screen_name, start_index, end_index) 
+VALUES (:tweet_id, :user_id, :screen_name, :start_index, :end_index)
+ON CONFLICT ON CONSTRAINT tweet_mentions_pkey DO NOTHING`, mention)
+		if err != nil {
+			return err
+		}
+	}
+	for _, media := range tweet.Media() {
+		_, err := tx.NamedExecContext(ctx, `
+INSERT INTO tweet_media (tweet_id, media_id, type, media_url, alt_text) 
+VALUES (:tweet_id, :media_id, :type, :media_url, :alt_text)
+ON CONFLICT ON CONSTRAINT tweet_media_pkey DO NOTHING`, media)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PgStorage) GetLastTweetId(ctx context.Context, userId int64) (int64, error) {
+	var lastTweetId int64
+	err := s.pgConn.GetContext(ctx, &lastTweetId, "SELECT COALESCE(MAX(id), 0) FROM tweets WHERE user_id=$1", userId)
+	if err != nil {
+		return 0, err
+	}
+	return lastTweetId, nil
+}
+
+// GetTweets returns saved tweets decoded from their raw json, ascending from afterId.
+func (s *PgStorage) GetTweets(ctx context.Context, afterId, n int64) ([]*models.Tweet, error) {
+	raws := make([]string, 0, n)
+	err := s.pgConn.SelectContext(ctx, &raws, "SELECT raw FROM tweets WHERE id > $1 ORDER BY id LIMIT $2", afterId, n)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTweets(raws)
+}
+
+// GetTweetsByIds returns saved tweets with the given ids decoded from their raw json.
+func (s *PgStorage) GetTweetsByIds(ctx context.Context, ids []int64) ([]*models.Tweet, error) {
+	if len(ids) == 0 {
+		return []*models.Tweet{}, nil
+	}
+	raws := make([]string, 0, len(ids))
+	err := s.pgConn.SelectContext(ctx, &raws, "SELECT raw FROM tweets WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	return decodeTweets(raws)
+}
+
+func decodeTweets(raws []string) ([]*models.Tweet, error) {
+	tweets := make([]*models.Tweet, 0, len(raws))
+	for _, raw := range raws {
+		tweet := &models.Tweet{}
+		err := json.Unmarshal([]byte(raw), tweet)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode raw tweet")
+		}
+		tweets = append(tweets, tweet)
+	}
+	return tweets, nil
+}
+
+func (s *PgStorage) AddNewInteractions(ctx context.Context, interactions []*models.Interaction) error {
+	tx, err := s.pgConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	stmt, txErr := tx.PrepareNamedContext(ctx,
+		`
+INSERT INTO interactions (user_id, target_user_id, type, tweet_id, target_tweet_id, created_at) 
+VALUES (:user_id, :target_user_id, :type, :tweet_id, :target_tweet_id, :created_at) 
+ON CONFLICT ON CONSTRAINT interactions_pkey DO NOTHING`)
+	if txErr != nil {
+		return txErr
+	}
+	for _, interaction := range interactions {
+		_, txErr = stmt.ExecContext(ctx, interaction)
+		if txErr != nil {
+			return txErr
+		}
+	}
+	txErr = stmt.Close()
+	if txErr != nil {
+		return txErr
+	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+// GetInteractions returns interactions of the user with other users.
+func (s *PgStorage) GetInteractions(ctx context.Context, userId int64) ([]*models.Interaction, error) {
+	interactions := make([]*models.Interaction, 0)
+	err := s.pgConn.SelectContext(ctx, &interactions, "SELECT * FROM interactions WHERE user_id=$1", userId)
+	if err != nil {
+		return nil, err
+	}
+	return interactions, nil
+}
+
+func (s *PgStorage) GetSearchState(ctx context.Context, key string) (*models.SearchState, error) {
+	state := &models.SearchState{}
+	err := s.pgConn.GetContext(ctx, state, "SELECT * FROM searches WHERE search_key=$1", key)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (s *PgStorage) UpdateSearchState(ctx context.Context, state *models.SearchState) error {
+	state.DateLastChange = time.Now()
+	_, err := s.pgConn.NamedExecContext(ctx, `
+INSERT INTO searches (search_key, cursor, slice_until, done, date_last_change) 
+VALUES (:search_key, :cursor, :slice_until, :done, :date_last_change)
+ON CONFLICT (search_key) DO UPDATE 
+SET (cursor, slice_until, done, date_last_change) = (:cursor, :slice_until, :done, :date_last_change)`, state)
+	return err
+}
+
+func (s *PgStorage) AddNewLists(ctx context.Context, lists []*models.List) error {
+	tx, err := s.pgConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	stmt, txErr := tx.PrepareNamedContext(ctx,
+		`
+INSERT INTO lists (id, id_str, name, slug, description, mode, member_count, subscriber_count, created_at, owner_id, 
+                   members_next_cursor_str, members_crawl_status, subscribers_next_cursor_str, subscribers_crawl_status, date_last_change) 
+VALUES (:id, :id_str, :name, :slug, :description, :mode, :member_count, :subscriber_count, :created_at, :owner_id, 
+        :members_next_cursor_str, :members_crawl_status, :subscribers_next_cursor_str, :subscribers_crawl_status, :date_last_change) 
+ON CONFLICT ON CONSTRAINT lists_pkey DO UPDATE 
+SET (name, slug, description, mode, member_count, subscriber_count, date_last_change) = 
+(:name, :slug, :description, :mode, :member_count, :subscriber_count, :date_last_change)`)
+	if txErr != nil {
+		return txErr
+	}
+	for _, list := range lists {
+		list.DateLastChange = time.Now()
+		_, txErr = stmt.ExecContext(ctx, list)
+		if txErr != nil {
+			return txErr
+		}
+	}
+	txErr = stmt.Close()
+	if txErr != nil {
+		return txErr
+	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+func (s *PgStorage) GetListById(ctx context.Context, id int64) (*models.List, error) {
+	list := &models.List{}
+	err := s.pgConn.GetContext(ctx, list, "SELECT * FROM lists WHERE id=$1", id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *PgStorage) UpdateListState(ctx context.Context, list *models.List, relation models.ListRelation) error {
+	list.DateLastChange = time.Now()
+	query := `UPDATE lists SET (members_next_cursor_str, members_crawl_status, date_last_change) = 
+(:members_next_cursor_str, :members_crawl_status, :date_last_change) WHERE id=:id`
+	if relation == models.ListRelationSubscriber {
+		query = `UPDATE lists SET (subscribers_next_cursor_str, subscribers_crawl_status, date_last_change) = 
+(:subscribers_next_cursor_str, :subscribers_crawl_status, :date_last_change) WHERE id=:id`
+	}
+	_, err := s.pgConn.NamedExecContext(ctx, query, list)
+	return err
+}
+
+func (s *PgStorage) AddListMemberships(ctx context.Context, memberships []*models.ListMembership) error {
+	tx, err := s.pgConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	stmt, txErr := tx.PrepareNamedContext(ctx,
+		`
+INSERT INTO list_memberships (list_id, user_id, relation) VALUES (:list_id, :user_id, :relation) 
+ON CONFLICT ON CONSTRAINT list_memberships_pkey DO NOTHING`)
+	if txErr != nil {
+		return txErr
+	}
+	for _, membership := range memberships {
+		_, txErr = stmt.ExecContext(ctx, membership)
+		if txErr != nil {
+			return txErr
+		}
+	}
+	txErr = stmt.Close()
+	if txErr != nil {
+		return txErr
+	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+func (s *PgStorage) GetFollowers(ctx context.Context, userId int64) ([]*models.User, error) {
 	followers := make([]*models.User, 0)
-	err := s.pgConn.Select(&followers, "SELECT u.* FROM users u JOIN followers f ON u.id=f.follower_id WHERE f.user_id=$1", userId)
+	err := s.pgConn.SelectContext(ctx, &followers, "SELECT u.* FROM users u JOIN followers f ON u.id=f.follower_id WHERE f.user_id=$1", userId)
 	if err != nil {
 		return nil, err
 	}
 	return followers, nil
 }
 
-func (s *PgStorage) GetFollowerIds(userId int64) ([]int64, error) {
+func (s *PgStorage) GetFollowerIds(ctx context.Context, userId int64) ([]int64, error) {
 	followerIds := make([]int64, 0)
-	err := s.pgConn.Select(&followerIds, "SELECT follower_id FROM followers WHERE user_id=$1", userId)
+	err := s.pgConn.SelectContext(ctx, &followerIds, "SELECT follower_id FROM followers WHERE user_id=$1", userId)
 	if err != nil {
 		return nil, err
 	}
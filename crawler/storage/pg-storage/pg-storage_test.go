@@ -1,7 +1,11 @@
 package pg_storage
 
 import (
+	"context"
 	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage/conformance"
+	"os"
 	"testing"
 )
 
@@ -70,11 +74,11 @@ func TestPgStorage_GetUserById(t *testing.T) {
 		t.Errorf("can't create pg storage, err='%v'", err)
 		return
 	}
-	_, err = s.GetUserById(1)
+	_, err = s.GetUserById(context.Background(), 1)
 	if err != nil {
 		t.Errorf("can't get user with id=1, err='%v'", err)
 	}
-	_, err = s.GetUserById(4)
+	_, err = s.GetUserById(context.Background(), 4)
 	if err == nil {
 		t.Errorf("user with id=4 shouldn't exist, err='%v'", err)
 	}
@@ -92,11 +96,11 @@ func TestPgStorage_GetUserByScreenName(t *testing.T) {
 		t.Errorf("can't create pg storage, err='%v'", err)
 		return
 	}
-	_, err = s.GetUserByScreenName("first")
+	_, err = s.GetUserByScreenName(context.Background(), "first")
 	if err != nil {
 		t.Errorf("can't get user with screen_name='first', err='%v'", err)
 	}
-	_, err = s.GetUserByScreenName("not_exists")
+	_, err = s.GetUserByScreenName(context.Background(), "not_exists")
 	if err == nil {
 		t.Errorf("user with screen_name='not_exists' shouldn't exist, err='%v'", err)
 	}
@@ -106,7 +110,7 @@ func TestPgStorage_GetUserByScreenName(t *testing.T) {
 //	user := &models.User{Id: 1, IdStr: "1", ScreenName: "first", Name: "asdasd"}
 //	user.NextCursor = 100000
 //	user.NextCursorStr = "100000"
-//	user.AreFollowersDownloaded = true
+//	user.CrawlStatus = models.CrawlStatusDone
 //	user.DateLastChange = time.Now()
 //
 //	conf.Init("../../config.yaml")
@@ -140,13 +144,53 @@ func TestPgStorage_GetUsersWithNotDownloadedFollowers(t *testing.T) {
 		return
 	}
 	var usersAmount int64 = 100
-	users, err := s.GetUsersWithNotDownloadedFollowers(usersAmount, 0)
+	users, err := s.GetUsersWithNotDownloadedFollowers(context.Background(), usersAmount)
 	if err != nil {
 		t.Fatalf("can't get users with not downloaded followers, err='%v'", err)
 	}
 	for _, user := range users {
-		if user.AreFollowersDownloaded {
-			t.Errorf("user %s has got downloaded followers flag set, userData='%v'", user.ScreenName, user)
+		if user.CrawlStatus != models.CrawlStatusPending {
+			t.Errorf("user %s has got crawl status %s, userData='%v'", user.ScreenName, user.CrawlStatus, user)
 		}
 	}
 }
+
+// TestPgStorage_Conformance runs the storage conformance suite on the database from the config pointed to by
+// TWITTER_CRAWLER_TEST_CONFIG. All tables of the database are truncated, so it must be a disposable one.
+func TestPgStorage_Conformance(t *testing.T) {
+	configPath := os.Getenv("TWITTER_CRAWLER_TEST_CONFIG")
+	if configPath == "" {
+		t.Skip("TWITTER_CRAWLER_TEST_CONFIG isn't set")
+	}
+	conf.Init(configPath)
+	config, err := conf.LoadConfig()
+	if err != nil {
+		t.Fatalf("can't load config, err='%v'", err)
+	}
+	migrator, err := NewMigrator(config.PostgresAccess)
+	if err != nil {
+		t.Fatalf("can't connect to storage, err='%v'", err)
+	}
+	defer migrator.Close()
+	_, err = migrator.Up(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("can't migrate storage, err='%v'", err)
+	}
+
+	conformance.Run(t, func(t *testing.T) conformance.Storage {
+		s, err := NewPgStorage(config.PostgresAccess)
+		if err != nil {
+			t.Fatalf("can't create pg storage, err='%v'", err)
+		}
+		_, err = s.pgConn.Exec(`
+TRUNCATE users, user_snapshots, followers, tweets, tweet_hashtags, tweet_urls, tweet_mentions, tweet_media, interactions,
+         searches, lists, list_memberships, crawl_tasks, crawl_tasks_dead RESTART IDENTITY`)
+		if err != nil {
+			t.Fatalf("can't truncate tables, err='%v'", err)
+		}
+		t.Cleanup(func() {
+			s.pgConn.Close()
+		})
+		return s
+	})
+}
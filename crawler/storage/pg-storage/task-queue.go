@@ -0,0 +1,171 @@
+package pg_storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"time"
+)
+
+// Queries of this file work with crawl_tasks table, see migrations/0002_crawl_tasks.up.sql.
+
+func (s *PgStorage) EnqueueCrawlTasks(ctx context.Context, tasks []*models.CrawlTask) (int64, error) {
+	tx, err := s.pgConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	stmt, txErr := tx.PrepareNamedContext(ctx, `
+INSERT INTO crawl_tasks (task_type, task_key, payload, priority)
+VALUES (:task_type, :task_key, :payload, :priority)
+ON CONFLICT (task_type, task_key) WHERE state <> 'done' DO NOTHING`)
+	if txErr != nil {
+		return 0, txErr
+	}
+	var enqueued, affected int64
+	var res sql.Result
+	for _, task := range tasks {
+		res, txErr = stmt.ExecContext(ctx, task)
+		if txErr != nil {
+			return 0, txErr
+		}
+		affected, txErr = res.RowsAffected()
+		if txErr != nil {
+			return 0, txErr
+		}
+		enqueued += affected
+	}
+	txErr = stmt.Close()
+	if txErr != nil {
+		return 0, txErr
+	}
+	txErr = tx.Commit()
+	if txErr != nil {
+		return 0, txErr
+	}
+	return enqueued, nil
+}
+
+// ClaimCrawlTasks leases up to n available pending tasks (or tasks with expired lease) to owner.
+// Tasks locked by concurrent claims are skipped, so every task is given to one owner only.
+func (s *PgStorage) ClaimCrawlTasks(ctx context.Context, owner string, n int64, leaseDuration time.Duration) ([]*models.CrawlTask, error) {
+	tasks := make([]*models.CrawlTask, 0, n)
+	err := s.pgConn.SelectContext(ctx, &tasks, `
+UPDATE crawl_tasks SET (state, lease_owner, lease_expires_at, attempts, updated_at) =
+('leased', $1, now() + $2 * interval '1 second', attempts + 1, now())
+WHERE id IN (
+    SELECT id FROM crawl_tasks
+    WHERE (state = 'pending' AND available_at <= now()) OR (state = 'leased' AND lease_expires_at < now())
+    ORDER BY priority DESC, id
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *`, owner, leaseDuration.Seconds(), n)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (s *PgStorage) ExtendCrawlTaskLease(ctx context.Context, id int64, owner string, leaseDuration time.Duration) error {
+	return s.execLeased(ctx, `
+UPDATE crawl_tasks SET (lease_expires_at, updated_at) = (now() + $3 * interval '1 second', now())
+WHERE id=$1 AND lease_owner=$2 AND state='leased'`, id, owner, leaseDuration.Seconds())
+}
+
+func (s *PgStorage) CompleteCrawlTask(ctx context.Context, id int64, owner string) error {
+	return s.execLeased(ctx, `
+UPDATE crawl_tasks SET (state, lease_owner, lease_expires_at, updated_at) = ('done', NULL, NULL, now())
+WHERE id=$1 AND lease_owner=$2 AND state='leased'`, id, owner)
+}
+
+// FailCrawlTask returns the task to the queue, remembering the error it failed with.
+// The task can't be claimed again until retryAt.
+func (s *PgStorage) FailCrawlTask(ctx context.Context, id int64, owner string, lastError string, retryAt time.Time) error {
+	return s.execLeased(ctx, `
+UPDATE crawl_tasks SET (state, lease_owner, lease_expires_at, last_error, available_at, updated_at) =
+('pending', NULL, NULL, $3, $4, now())
+WHERE id=$1 AND lease_owner=$2 AND state='leased'`, id, owner, lastError, retryAt)
+}
+
+// DeadLetterCrawlTask moves the task to dead state and records it to crawl_tasks_dead table.
+// Dead tasks aren't claimed and block queueing of the same work until they are re-driven.
+func (s *PgStorage) DeadLetterCrawlTask(ctx context.Context, id int64, owner string, errorClass string, lastError string) error {
+	return s.execLeased(ctx, `
+WITH dead AS (
+    UPDATE crawl_tasks SET (state, lease_owner, lease_expires_at, last_error, updated_at) = ('dead', NULL, NULL, $4, now())
+    WHERE id=$1 AND lease_owner=$2 AND state='leased'
+    RETURNING id, task_type, task_key, attempts
+)
+INSERT INTO crawl_tasks_dead (task_id, task_type, task_key, attempts, error_class, last_error)
+SELECT id, task_type, task_key, attempts, $3, $4 FROM dead`, id, owner, errorClass, lastError)
+}
+
+// GetDeadCrawlTasks returns up to n oldest dead tasks of the given type, or of any type if taskType is empty.
+func (s *PgStorage) GetDeadCrawlTasks(ctx context.Context, taskType string, n int64) ([]*models.DeadCrawlTask, error) {
+	tasks := make([]*models.DeadCrawlTask, 0, n)
+	err := s.pgConn.SelectContext(ctx, &tasks, `
+SELECT * FROM crawl_tasks_dead WHERE ($1 = '' OR task_type = $1) ORDER BY id LIMIT $2`, taskType, n)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// RedriveDeadCrawlTasks returns up to n oldest dead tasks of the given type (or of any type if taskType is empty)
+// to the queue with reset attempts counter.
+func (s *PgStorage) RedriveDeadCrawlTasks(ctx context.Context, taskType string, n int64) (int64, error) {
+	res, err := s.pgConn.ExecContext(ctx, `
+WITH redriven AS (
+    DELETE FROM crawl_tasks_dead WHERE id IN (
+        SELECT id FROM crawl_tasks_dead WHERE ($1 = '' OR task_type = $1) ORDER BY id LIMIT $2
+    )
+    RETURNING task_id
+)
+UPDATE crawl_tasks SET (state, attempts, last_error, available_at, updated_at) = ('pending', 0, NULL, now(), now())
+WHERE id IN (SELECT task_id FROM redriven) AND state = 'dead'`, taskType, n)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ReleaseCrawlTask returns the task to the queue without counting the attempt, e.g. when the worker is stopped.
+func (s *PgStorage) ReleaseCrawlTask(ctx context.Context, id int64, owner string) error {
+	return s.execLeased(ctx, `
+UPDATE crawl_tasks SET (state, lease_owner, lease_expires_at, attempts, updated_at) = ('pending', NULL, NULL, attempts - 1, now())
+WHERE id=$1 AND lease_owner=$2 AND state='leased'`, id, owner)
+}
+
+func (s *PgStorage) CountPendingCrawlTasks(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.pgConn.GetContext(ctx, &count, `
+SELECT count(*) FROM crawl_tasks
+WHERE (state = 'pending' AND available_at <= now()) OR (state = 'leased' AND lease_expires_at < now())`)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// execLeased runs an update of a leased task, returning storage.ErrLeaseLost if the task isn't leased to owner anymore.
+func (s *PgStorage) execLeased(ctx context.Context, query string, args ...interface{}) error {
+	res, err := s.pgConn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrLeaseLost
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package remote_storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	errorCodeNotFound  = "not_found"
+	errorCodeLeaseLost = "lease_lost"
+)
+
+// TokenHeader carries the token shared by the master and its workers, see master_token in config.
+const TokenHeader = "X-Master-Token"
+
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// Client calls the master service, requests and responses are json encoded.
+type Client struct {
+	baseUrl    string
+	token      string
+	httpClient *http.Client
+}
+
+func NewClient(baseUrl string, token string) *Client {
+	return &Client{
+		baseUrl: strings.TrimRight(baseUrl, "/"),
+		token:   token,
+		httpClient: &http.Client{
+			Timeout: time.Minute,
+		},
+	}
+}
+
+// Call posts args to the given path of the master service and decodes the response to result, if it's not nil.
+// Errors known to both sides, like sql.ErrNoRows, are restored from the response.
+func (c *Client) Call(ctx context.Context, path string, args interface{}, result interface{}) error {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return errors.Wrap(err, "encode request")
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseUrl+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TokenHeader, c.token)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to master failed, err='%v'", err)
+	}
+	defer resp.Body.Close()
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "read response")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		errResp := &errorResponse{}
+		if json.Unmarshal(respBytes, errResp) != nil {
+			return fmt.Errorf("bad response status code from master, got %d (%s)", resp.StatusCode, resp.Status)
+		}
+		switch errResp.Code {
+		case errorCodeNotFound:
+			return sql.ErrNoRows
+		case errorCodeLeaseLost:
+			return storage.ErrLeaseLost
+		default:
+			return fmt.Errorf("master: %s", errResp.Error)
+		}
+	}
+	if result == nil {
+		return nil
+	}
+	err = json.Unmarshal(respBytes, result)
+	if err != nil {
+		return errors.Wrap(err, "decode response")
+	}
+	return nil
+}
@@ -0,0 +1,516 @@
+package remote_storage
+
+import (
+	"context"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StoragePathPrefix is the path of the master service the storage handler is mounted at.
+const StoragePathPrefix = "/storage/"
+
+// RemoteStorage is used by remote workers, it forwards every call to the storage of the master,
+// so the master stays the only process writing to the storage.
+type RemoteStorage struct {
+	client *Client
+}
+
+func NewRemoteStorage(client *Client) *RemoteStorage {
+	return &RemoteStorage{
+		client: client,
+	}
+}
+
+type pageArgs struct {
+	N      int64 `json:"n"`
+	Offset int64 `json:"offset"`
+}
+
+type idsArgs struct {
+	AfterId int64 `json:"after_id"`
+	N       int64 `json:"n"`
+}
+
+type listStateArgs struct {
+	List     *models.List        `json:"list"`
+	Relation models.ListRelation `json:"relation"`
+}
+
+type claimArgs struct {
+	Owner         string        `json:"owner"`
+	N             int64         `json:"n"`
+	LeaseDuration time.Duration `json:"lease_duration"`
+}
+
+type leaseArgs struct {
+	Id            int64         `json:"id"`
+	Owner         string        `json:"owner"`
+	LeaseDuration time.Duration `json:"lease_duration,omitempty"`
+	LastError     string        `json:"last_error,omitempty"`
+	ErrorClass    string        `json:"error_class,omitempty"`
+	RetryAt       time.Time     `json:"retry_at,omitempty"`
+}
+
+type deadTasksArgs struct {
+	TaskType string `json:"task_type"`
+	N        int64  `json:"n"`
+}
+
+func (s *RemoteStorage) call(ctx context.Context, method string, args interface{}, result interface{}) error {
+	return s.client.Call(ctx, StoragePathPrefix+method, args, result)
+}
+
+func (s *RemoteStorage) getUsers(ctx context.Context, method string, args interface{}) ([]*models.User, error) {
+	users := make([]*models.User, 0)
+	err := s.call(ctx, method, args, &users)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *RemoteStorage) AddNewFollowers(ctx context.Context, followers []*models.Follower) error {
+	return s.call(ctx, "AddNewFollowers", followers, nil)
+}
+
+func (s *RemoteStorage) AddNewUsers(ctx context.Context, users []*models.User) error {
+	return s.call(ctx, "AddNewUsers", users, nil)
+}
+
+func (s *RemoteStorage) UpdateUserState(ctx context.Context, user *models.User) error {
+	return s.call(ctx, "UpdateUserState", user, nil)
+}
+
+func (s *RemoteStorage) CommitFollowersPage(ctx context.Context, page *models.FollowersPage) error {
+	return s.call(ctx, "CommitFollowersPage", page, nil)
+}
+
+func (s *RemoteStorage) UpdateUserFriendsState(ctx context.Context, user *models.User) error {
+	return s.call(ctx, "UpdateUserFriendsState", user, nil)
+}
+
+func (s *RemoteStorage) UpdateUserTweetsState(ctx context.Context, user *models.User) error {
+	return s.call(ctx, "UpdateUserTweetsState", user, nil)
+}
+
+func (s *RemoteStorage) AddNewTweets(ctx context.Context, tweets []*models.Tweet) error {
+	return s.call(ctx, "AddNewTweets", tweets, nil)
+}
+
+func (s *RemoteStorage) GetLastTweetId(ctx context.Context, userId int64) (int64, error) {
+	var lastTweetId int64
+	err := s.call(ctx, "GetLastTweetId", userId, &lastTweetId)
+	return lastTweetId, err
+}
+
+func (s *RemoteStorage) AddNewInteractions(ctx context.Context, interactions []*models.Interaction) error {
+	return s.call(ctx, "AddNewInteractions", interactions, nil)
+}
+
+func (s *RemoteStorage) GetSearchState(ctx context.Context, key string) (*models.SearchState, error) {
+	var state *models.SearchState
+	err := s.call(ctx, "GetSearchState", key, &state)
+	return state, err
+}
+
+func (s *RemoteStorage) UpdateSearchState(ctx context.Context, state *models.SearchState) error {
+	return s.call(ctx, "UpdateSearchState", state, nil)
+}
+
+func (s *RemoteStorage) AddNewLists(ctx context.Context, lists []*models.List) error {
+	return s.call(ctx, "AddNewLists", lists, nil)
+}
+
+func (s *RemoteStorage) GetListById(ctx context.Context, id int64) (*models.List, error) {
+	var list *models.List
+	err := s.call(ctx, "GetListById", id, &list)
+	return list, err
+}
+
+func (s *RemoteStorage) UpdateListState(ctx context.Context, list *models.List, relation models.ListRelation) error {
+	return s.call(ctx, "UpdateListState", &listStateArgs{List: list, Relation: relation}, nil)
+}
+
+func (s *RemoteStorage) AddListMemberships(ctx context.Context, memberships []*models.ListMembership) error {
+	return s.call(ctx, "AddListMemberships", memberships, nil)
+}
+
+func (s *RemoteStorage) GetUserSnapshots(ctx context.Context, userId int64) ([]*models.UserSnapshot, error) {
+	snapshots := make([]*models.UserSnapshot, 0)
+	err := s.call(ctx, "GetUserSnapshots", userId, &snapshots)
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func (s *RemoteStorage) GetUserById(ctx context.Context, id int64) (*models.User, error) {
+	user := &models.User{}
+	err := s.call(ctx, "GetUserById", id, user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *RemoteStorage) GetUserByScreenName(ctx context.Context, screenName string) (*models.User, error) {
+	user := &models.User{}
+	err := s.call(ctx, "GetUserByScreenName", screenName, user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *RemoteStorage) GetUsersWithNotDownloadedFollowers(ctx context.Context, n int64) ([]*models.User, error) {
+	return s.getUsers(ctx, "GetUsersWithNotDownloadedFollowers", n)
+}
+
+func (s *RemoteStorage) GetUsersWithNotDownloadedFriends(ctx context.Context, n int64) ([]*models.User, error) {
+	return s.getUsers(ctx, "GetUsersWithNotDownloadedFriends", n)
+}
+
+func (s *RemoteStorage) GetUsersWithDownloadedFollowers(ctx context.Context, n int64) ([]*models.User, error) {
+	return s.getUsers(ctx, "GetUsersWithDownloadedFollowers", n)
+}
+
+func (s *RemoteStorage) GetUsersWithNotDownloadedFollowersSorted(ctx context.Context, n, offset int64) ([]*models.User, error) {
+	return s.getUsers(ctx, "GetUsersWithNotDownloadedFollowersSorted", &pageArgs{N: n, Offset: offset})
+}
+
+func (s *RemoteStorage) GetUsersWithDownloadedFollowersSorted(ctx context.Context, n, offset int64) ([]*models.User, error) {
+	return s.getUsers(ctx, "GetUsersWithDownloadedFollowersSorted", &pageArgs{N: n, Offset: offset})
+}
+
+func (s *RemoteStorage) GetUnknownUserIds(ctx context.Context, afterId, n int64) ([]int64, error) {
+	userIds := make([]int64, 0, n)
+	err := s.call(ctx, "GetUnknownUserIds", &idsArgs{AfterId: afterId, N: n}, &userIds)
+	if err != nil {
+		return nil, err
+	}
+	return userIds, nil
+}
+
+func (s *RemoteStorage) EnqueueCrawlTasks(ctx context.Context, tasks []*models.CrawlTask) (int64, error) {
+	var enqueued int64
+	err := s.call(ctx, "EnqueueCrawlTasks", tasks, &enqueued)
+	return enqueued, err
+}
+
+func (s *RemoteStorage) ClaimCrawlTasks(ctx context.Context, owner string, n int64, leaseDuration time.Duration) ([]*models.CrawlTask, error) {
+	tasks := make([]*models.CrawlTask, 0, n)
+	err := s.call(ctx, "ClaimCrawlTasks", &claimArgs{Owner: owner, N: n, LeaseDuration: leaseDuration}, &tasks)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (s *RemoteStorage) ExtendCrawlTaskLease(ctx context.Context, id int64, owner string, leaseDuration time.Duration) error {
+	return s.call(ctx, "ExtendCrawlTaskLease", &leaseArgs{Id: id, Owner: owner, LeaseDuration: leaseDuration}, nil)
+}
+
+func (s *RemoteStorage) CompleteCrawlTask(ctx context.Context, id int64, owner string) error {
+	return s.call(ctx, "CompleteCrawlTask", &leaseArgs{Id: id, Owner: owner}, nil)
+}
+
+func (s *RemoteStorage) FailCrawlTask(ctx context.Context, id int64, owner string, lastError string, retryAt time.Time) error {
+	return s.call(ctx, "FailCrawlTask", &leaseArgs{Id: id, Owner: owner, LastError: lastError, RetryAt: retryAt}, nil)
+}
+
+func (s *RemoteStorage) ReleaseCrawlTask(ctx context.Context, id int64, owner string) error {
+	return s.call(ctx, "ReleaseCrawlTask", &leaseArgs{Id: id, Owner: owner}, nil)
+}
+
+func (s *RemoteStorage) CountPendingCrawlTasks(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.call(ctx, "CountPendingCrawlTasks", nil, &count)
+	return count, err
+}
+
+func (s *RemoteStorage) DeadLetterCrawlTask(ctx context.Context, id int64, owner string, errorClass string, lastError string) error {
+	return s.call(ctx, "DeadLetterCrawlTask", &leaseArgs{Id: id, Owner: owner, ErrorClass: errorClass, LastError: lastError}, nil)
+}
+
+func (s *RemoteStorage) GetDeadCrawlTasks(ctx context.Context, taskType string, n int64) ([]*models.DeadCrawlTask, error) {
+	tasks := make([]*models.DeadCrawlTask, 0, n)
+	err := s.call(ctx, "GetDeadCrawlTasks", &deadTasksArgs{TaskType: taskType, N: n}, &tasks)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (s *RemoteStorage) RedriveDeadCrawlTasks(ctx context.Context, taskType string, n int64) (int64, error) {
+	var redriven int64
+	err := s.call(ctx, "RedriveDeadCrawlTasks", &deadTasksArgs{TaskType: taskType, N: n}, &redriven)
+	return redriven, err
+}
+
+type storageMethod func(ctx context.Context, stor storage.Storage, readArgs func(args interface{}) error) (interface{}, error)
+
+// storageMethods executes calls of RemoteStorage on the storage of the master.
+var storageMethods = map[string]storageMethod{
+	"AddNewFollowers": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var followers []*models.Follower
+		if err := readArgs(&followers); err != nil {
+			return nil, err
+		}
+		return nil, stor.AddNewFollowers(ctx, followers)
+	},
+	"AddNewUsers": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var users []*models.User
+		if err := readArgs(&users); err != nil {
+			return nil, err
+		}
+		return nil, stor.AddNewUsers(ctx, users)
+	},
+	"UpdateUserState": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		user := &models.User{}
+		if err := readArgs(user); err != nil {
+			return nil, err
+		}
+		return nil, stor.UpdateUserState(ctx, user)
+	},
+	"CommitFollowersPage": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		page := &models.FollowersPage{}
+		if err := readArgs(page); err != nil {
+			return nil, err
+		}
+		return nil, stor.CommitFollowersPage(ctx, page)
+	},
+	"UpdateUserFriendsState": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		user := &models.User{}
+		if err := readArgs(user); err != nil {
+			return nil, err
+		}
+		return nil, stor.UpdateUserFriendsState(ctx, user)
+	},
+	"UpdateUserTweetsState": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		user := &models.User{}
+		if err := readArgs(user); err != nil {
+			return nil, err
+		}
+		return nil, stor.UpdateUserTweetsState(ctx, user)
+	},
+	"AddNewTweets": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var tweets []*models.Tweet
+		if err := readArgs(&tweets); err != nil {
+			return nil, err
+		}
+		return nil, stor.AddNewTweets(ctx, tweets)
+	},
+	"GetLastTweetId": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var userId int64
+		if err := readArgs(&userId); err != nil {
+			return nil, err
+		}
+		return stor.GetLastTweetId(ctx, userId)
+	},
+	"AddNewInteractions": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var interactions []*models.Interaction
+		if err := readArgs(&interactions); err != nil {
+			return nil, err
+		}
+		return nil, stor.AddNewInteractions(ctx, interactions)
+	},
+	"GetSearchState": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var key string
+		if err := readArgs(&key); err != nil {
+			return nil, err
+		}
+		return stor.GetSearchState(ctx, key)
+	},
+	"UpdateSearchState": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		state := &models.SearchState{}
+		if err := readArgs(state); err != nil {
+			return nil, err
+		}
+		return nil, stor.UpdateSearchState(ctx, state)
+	},
+	"AddNewLists": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var lists []*models.List
+		if err := readArgs(&lists); err != nil {
+			return nil, err
+		}
+		return nil, stor.AddNewLists(ctx, lists)
+	},
+	"GetListById": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var id int64
+		if err := readArgs(&id); err != nil {
+			return nil, err
+		}
+		return stor.GetListById(ctx, id)
+	},
+	"UpdateListState": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		args := &listStateArgs{}
+		if err := readArgs(args); err != nil {
+			return nil, err
+		}
+		return nil, stor.UpdateListState(ctx, args.List, args.Relation)
+	},
+	"AddListMemberships": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var memberships []*models.ListMembership
+		if err := readArgs(&memberships); err != nil {
+			return nil, err
+		}
+		return nil, stor.AddListMemberships(ctx, memberships)
+	},
+	"GetUserSnapshots": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var userId int64
+		if err := readArgs(&userId); err != nil {
+			return nil, err
+		}
+		return stor.GetUserSnapshots(ctx, userId)
+	},
+	"GetUserById": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var id int64
+		if err := readArgs(&id); err != nil {
+			return nil, err
+		}
+		return stor.GetUserById(ctx, id)
+	},
+	"GetUserByScreenName": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var screenName string
+		if err := readArgs(&screenName); err != nil {
+			return nil, err
+		}
+		return stor.GetUserByScreenName(ctx, screenName)
+	},
+	"GetUsersWithNotDownloadedFollowers": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var n int64
+		if err := readArgs(&n); err != nil {
+			return nil, err
+		}
+		return stor.GetUsersWithNotDownloadedFollowers(ctx, n)
+	},
+	"GetUsersWithNotDownloadedFriends": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var n int64
+		if err := readArgs(&n); err != nil {
+			return nil, err
+		}
+		return stor.GetUsersWithNotDownloadedFriends(ctx, n)
+	},
+	"GetUsersWithDownloadedFollowers": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var n int64
+		if err := readArgs(&n); err != nil {
+			return nil, err
+		}
+		return stor.GetUsersWithDownloadedFollowers(ctx, n)
+	},
+	"GetUsersWithNotDownloadedFollowersSorted": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		args := &pageArgs{}
+		if err := readArgs(args); err != nil {
+			return nil, err
+		}
+		return stor.GetUsersWithNotDownloadedFollowersSorted(ctx, args.N, args.Offset)
+	},
+	"GetUsersWithDownloadedFollowersSorted": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		args := &pageArgs{}
+		if err := readArgs(args); err != nil {
+			return nil, err
+		}
+		return stor.GetUsersWithDownloadedFollowersSorted(ctx, args.N, args.Offset)
+	},
+	"GetUnknownUserIds": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		args := &idsArgs{}
+		if err := readArgs(args); err != nil {
+			return nil, err
+		}
+		return stor.GetUnknownUserIds(ctx, args.AfterId, args.N)
+	},
+	"EnqueueCrawlTasks": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		var tasks []*models.CrawlTask
+		if err := readArgs(&tasks); err != nil {
+			return nil, err
+		}
+		return stor.EnqueueCrawlTasks(ctx, tasks)
+	},
+	"ClaimCrawlTasks": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		args := &claimArgs{}
+		if err := readArgs(args); err != nil {
+			return nil, err
+		}
+		return stor.ClaimCrawlTasks(ctx, args.Owner, args.N, args.LeaseDuration)
+	},
+	"ExtendCrawlTaskLease": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		args := &leaseArgs{}
+		if err := readArgs(args); err != nil {
+			return nil, err
+		}
+		return nil, stor.ExtendCrawlTaskLease(ctx, args.Id, args.Owner, args.LeaseDuration)
+	},
+	"CompleteCrawlTask": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		args := &leaseArgs{}
+		if err := readArgs(args); err != nil {
+			return nil, err
+		}
+		return nil, stor.CompleteCrawlTask(ctx, args.Id, args.Owner)
+	},
+	"FailCrawlTask": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		args := &leaseArgs{}
+		if err := readArgs(args); err != nil {
+			return nil, err
+		}
+		return nil, stor.FailCrawlTask(ctx, args.Id, args.Owner, args.LastError, args.RetryAt)
+	},
+	"ReleaseCrawlTask": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		args := &leaseArgs{}
+		if err := readArgs(args); err != nil {
+			return nil, err
+		}
+		return nil, stor.ReleaseCrawlTask(ctx, args.Id, args.Owner)
+	},
+	"CountPendingCrawlTasks": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		return stor.CountPendingCrawlTasks(ctx)
+	},
+	"DeadLetterCrawlTask": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		args := &leaseArgs{}
+		if err := readArgs(args); err != nil {
+			return nil, err
+		}
+		return nil, stor.DeadLetterCrawlTask(ctx, args.Id, args.Owner, args.ErrorClass, args.LastError)
+	},
+	"GetDeadCrawlTasks": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		args := &deadTasksArgs{}
+		if err := readArgs(args); err != nil {
+			return nil, err
+		}
+		return stor.GetDeadCrawlTasks(ctx, args.TaskType, args.N)
+	},
+	"RedriveDeadCrawlTasks": func(ctx context.Context, stor storage.Storage, readArgs func(interface{}) error) (interface{}, error) {
+		args := &deadTasksArgs{}
+		if err := readArgs(args); err != nil {
+			return nil, err
+		}
+		return stor.RedriveDeadCrawlTasks(ctx, args.TaskType, args.N)
+	},
+}
+
+// NewStorageHandler serves calls of RemoteStorage with stor, it should be mounted at StoragePathPrefix.
+func NewStorageHandler(stor storage.Storage) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		method, ok := storageMethods[strings.TrimPrefix(r.URL.Path, StoragePathPrefix)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var argsErr error
+		result, err := method(r.Context(), stor, func(args interface{}) error {
+			argsErr = ReadArgs(r, args)
+			return argsErr
+		})
+		if argsErr != nil {
+			WriteBadRequest(w, argsErr)
+			return
+		}
+		WriteResult(w, result, err)
+	})
+}
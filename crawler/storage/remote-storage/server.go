@@ -0,0 +1,54 @@
+package remote_storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"io/ioutil"
+	"net/http"
+)
+
+// ReadArgs decodes json request body written by Client.Call.
+func ReadArgs(r *http.Request, args interface{}) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, args)
+}
+
+// WriteResult writes the result of a call, err is sent so that Client.Call can restore it.
+func WriteResult(w http.ResponseWriter, result interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		status := http.StatusInternalServerError
+		errResp := &errorResponse{Error: err.Error()}
+		switch errors.Cause(err) {
+		case sql.ErrNoRows:
+			status = http.StatusNotFound
+			errResp.Code = errorCodeNotFound
+		case storage.ErrLeaseLost:
+			status = http.StatusConflict
+			errResp.Code = errorCodeLeaseLost
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(errResp)
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// WriteUnauthorized reports a request without the token of the master.
+func WriteUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(&errorResponse{Error: "wrong master token"})
+}
+
+// WriteBadRequest reports a request which couldn't be decoded.
+func WriteBadRequest(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(&errorResponse{Error: err.Error()})
+}
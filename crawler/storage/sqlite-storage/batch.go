@@ -0,0 +1,39 @@
+package sqlite_storage
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"strings"
+)
+
+// Batched writes insert rows with multi-row inserts of up to batchRows rows instead of row by row,
+// rows of a batch are saved in the transaction of the caller, so the file is synced once per batch.
+
+// batchRows is the number of rows of a single insert, it's limited by the max number of parameters
+// of an sqlite statement (32766).
+const batchRows = 500
+
+// insertRowsTx inserts rows of values of columns to the table, onConflict is appended to every insert,
+// e.g. ON CONFLICT DO NOTHING to skip saved rows.
+func insertRowsTx(ctx context.Context, tx *sqlx.Tx, table string, columns []string, rows [][]interface{}, onConflict string) error {
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	for start := 0; start < len(rows); start += batchRows {
+		end := start + batchRows
+		if end > len(rows) {
+			end = len(rows)
+		}
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for _, row := range rows[start:end] {
+			values = append(values, placeholders)
+			args = append(args, row...)
+		}
+		query := "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES " + strings.Join(values, ", ") +
+			" " + onConflict
+		_, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+-- the schema of pg-storage migrations for sqlite: times are TIMESTAMP text in UTC, so they are compared as strings,
+-- json columns are TEXT and arrays are json arrays
+
+CREATE TABLE IF NOT EXISTS users
+(
+    id                      INTEGER PRIMARY KEY,
+    id_str                  TEXT      NOT NULL,
+    screen_name             TEXT      NOT NULL,
+    name                    TEXT      NOT NULL,
+    created_at              TEXT      NOT NULL,
+    followers_count         INTEGER   NOT NULL,
+    friends_count           INTEGER   NOT NULL,
+    verified                BOOLEAN   NOT NULL,
+    -- the user as returned by twitter
+    additional_data         TEXT,
+    next_cursor             INTEGER   NOT NULL DEFAULT -1,
+    next_cursor_str         TEXT      NOT NULL DEFAULT '-1',
+    crawl_status            TEXT      NOT NULL DEFAULT 'pending'
+        CHECK (crawl_status IN ('pending', 'done', 'protected', 'not_found', 'suspended')),
+    friends_next_cursor     INTEGER   NOT NULL DEFAULT -1,
+    friends_next_cursor_str TEXT      NOT NULL DEFAULT '-1',
+    friends_crawl_status    TEXT      NOT NULL DEFAULT 'pending'
+        CHECK (friends_crawl_status IN ('pending', 'done', 'protected', 'not_found', 'suspended')),
+    tweets_cursor           TEXT      NOT NULL DEFAULT '',
+    tweets_since_id         INTEGER   NOT NULL DEFAULT 0,
+    date_last_change        TIMESTAMP NOT NULL,
+    protected               BOOLEAN,
+    location                TEXT,
+    description             TEXT      NOT NULL DEFAULT '',
+    url                     TEXT,
+    expanded_url            TEXT      NOT NULL DEFAULT '',
+    statuses_count          INTEGER   NOT NULL DEFAULT 0,
+    favourites_count        INTEGER   NOT NULL DEFAULT 0,
+    listed_count            INTEGER   NOT NULL DEFAULT 0,
+    profile_image_url_https TEXT      NOT NULL DEFAULT '',
+    default_profile         BOOLEAN   NOT NULL DEFAULT FALSE,
+    default_profile_image   BOOLEAN   NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS users_screen_name ON users (screen_name);
+CREATE INDEX IF NOT EXISTS users_crawl_status_pending ON users (id) WHERE crawl_status = 'pending';
+CREATE INDEX IF NOT EXISTS users_friends_crawl_status_pending ON users (id) WHERE friends_crawl_status = 'pending';
+CREATE INDEX IF NOT EXISTS users_not_hydrated ON users (id) WHERE additional_data IS NULL;
+
+-- every observed version of user profiles, users keeps the latest one
+CREATE TABLE IF NOT EXISTS user_snapshots
+(
+    id              INTEGER PRIMARY KEY,
+    user_id         INTEGER   NOT NULL,
+    observed_at     TIMESTAMP NOT NULL,
+    screen_name     TEXT      NOT NULL,
+    name            TEXT      NOT NULL,
+    followers_count INTEGER   NOT NULL,
+    friends_count   INTEGER   NOT NULL,
+    verified        BOOLEAN   NOT NULL,
+    protected       BOOLEAN,
+    location        TEXT,
+    description     TEXT      NOT NULL DEFAULT '',
+    url             TEXT,
+    -- json array of columns of users changed since the previous version, empty for the first one
+    changed_fields  TEXT      NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX IF NOT EXISTS user_snapshots_user_id ON user_snapshots (user_id, observed_at);
+
+-- an edge from follower_id to user_id, friends of crawled users are saved with user_id being the friend
+CREATE TABLE IF NOT EXISTS followers
+(
+    user_id     INTEGER NOT NULL,
+    follower_id INTEGER NOT NULL,
+    CONSTRAINT connection PRIMARY KEY (user_id, follower_id)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS followers_follower_id ON followers (follower_id);
+
+CREATE TABLE IF NOT EXISTS crawl_tasks
+(
+    id               INTEGER PRIMARY KEY,
+    task_type        TEXT      NOT NULL,
+    task_key         TEXT      NOT NULL,
+    payload          TEXT      NOT NULL,
+    state            TEXT      NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'leased', 'done', 'dead')),
+    priority         INTEGER   NOT NULL DEFAULT 0,
+    attempts         INTEGER   NOT NULL DEFAULT 0,
+    lease_owner      TEXT,
+    lease_expires_at TIMESTAMP,
+    last_error       TEXT,
+    available_at     TIMESTAMP NOT NULL,
+    created_at       TIMESTAMP NOT NULL,
+    updated_at       TIMESTAMP NOT NULL
+);
+
+-- the same work can be queued again only after the previous task for it is done, dead tasks block it until re-driven
+CREATE UNIQUE INDEX IF NOT EXISTS crawl_tasks_active_key ON crawl_tasks (task_type, task_key) WHERE state <> 'done';
+CREATE INDEX IF NOT EXISTS crawl_tasks_pending ON crawl_tasks (priority DESC, id) WHERE state = 'pending';
+CREATE INDEX IF NOT EXISTS crawl_tasks_leased ON crawl_tasks (lease_expires_at) WHERE state = 'leased';
+
+-- tasks which failed more times than their retry policy allows, see redrive.go
+CREATE TABLE IF NOT EXISTS crawl_tasks_dead
+(
+    id          INTEGER PRIMARY KEY,
+    task_id     INTEGER   NOT NULL REFERENCES crawl_tasks (id),
+    task_type   TEXT      NOT NULL,
+    task_key    TEXT      NOT NULL,
+    attempts    INTEGER   NOT NULL,
+    error_class TEXT      NOT NULL,
+    last_error  TEXT      NOT NULL,
+    failed_at   TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS crawl_tasks_dead_type ON crawl_tasks_dead (task_type, id);
+
+CREATE TABLE IF NOT EXISTS tweets
+(
+    id                      INTEGER PRIMARY KEY,
+    user_id                 INTEGER NOT NULL,
+    created_at              TEXT    NOT NULL,
+    full_text               TEXT    NOT NULL,
+    lang                    TEXT    NOT NULL,
+    reply_count             INTEGER NOT NULL,
+    retweet_count           INTEGER NOT NULL,
+    retweeted_status_id_str TEXT    NOT NULL,
+    -- the tweet as returned by twitter
+    raw                     TEXT    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS tweets_user_id ON tweets (user_id, id);
+
+CREATE TABLE IF NOT EXISTS tweet_hashtags
+(
+    tweet_id    INTEGER NOT NULL,
+    tag         TEXT    NOT NULL,
+    start_index INTEGER NOT NULL,
+    end_index   INTEGER NOT NULL,
+    CONSTRAINT tweet_hashtags_pkey PRIMARY KEY (tweet_id, start_index)
+);
+
+CREATE INDEX IF NOT EXISTS tweet_hashtags_tag ON tweet_hashtags (tag);
+
+CREATE TABLE IF NOT EXISTS tweet_urls
+(
+    tweet_id     INTEGER NOT NULL,
+    url          TEXT    NOT NULL,
+    expanded_url TEXT    NOT NULL,
+    domain       TEXT    NOT NULL,
+    start_index  INTEGER NOT NULL,
+    end_index    INTEGER NOT NULL,
+    CONSTRAINT tweet_urls_pkey PRIMARY KEY (tweet_id, start_index)
+);
+
+CREATE INDEX IF NOT EXISTS tweet_urls_domain ON tweet_urls (domain);
+
+CREATE TABLE IF NOT EXISTS tweet_mentions
+(
+    tweet_id    INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    screen_name TEXT    NOT NULL,
+    start_index INTEGER NOT NULL,
+    end_index   INTEGER NOT NULL,
+    CONSTRAINT tweet_mentions_pkey PRIMARY KEY (tweet_id, start_index)
+);
+
+CREATE INDEX IF NOT EXISTS tweet_mentions_user_id ON tweet_mentions (user_id);
+
+CREATE TABLE IF NOT EXISTS tweet_media
+(
+    tweet_id  INTEGER NOT NULL,
+    media_id  INTEGER NOT NULL,
+    type      TEXT    NOT NULL,
+    media_url TEXT    NOT NULL,
+    alt_text  TEXT    NOT NULL,
+    CONSTRAINT tweet_media_pkey PRIMARY KEY (tweet_id, media_id)
+);
+
+-- edges from authors of tweets to users they retweeted, replied to, quoted or mentioned
+CREATE TABLE IF NOT EXISTS interactions
+(
+    user_id         INTEGER   NOT NULL,
+    target_user_id  INTEGER   NOT NULL,
+    type            TEXT      NOT NULL CHECK (type IN ('retweet', 'reply', 'quote', 'mention')),
+    tweet_id        INTEGER   NOT NULL,
+    target_tweet_id INTEGER   NOT NULL DEFAULT 0,
+    created_at      TIMESTAMP NOT NULL,
+    CONSTRAINT interactions_pkey PRIMARY KEY (tweet_id, type, target_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS interactions_user_id ON interactions (user_id);
+CREATE INDEX IF NOT EXISTS interactions_target_user_id ON interactions (target_user_id);
+
+CREATE TABLE IF NOT EXISTS searches
+(
+    search_key       TEXT PRIMARY KEY,
+    cursor           TEXT      NOT NULL,
+    slice_until      TIMESTAMP NOT NULL,
+    done             BOOLEAN   NOT NULL DEFAULT FALSE,
+    date_last_change TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS lists
+(
+    id                          INTEGER PRIMARY KEY,
+    id_str                      TEXT      NOT NULL,
+    name                        TEXT      NOT NULL,
+    slug                        TEXT      NOT NULL,
+    description                 TEXT      NOT NULL,
+    mode                        TEXT      NOT NULL,
+    member_count                INTEGER   NOT NULL,
+    subscriber_count            INTEGER   NOT NULL,
+    created_at                  TEXT      NOT NULL,
+    owner_id                    INTEGER   NOT NULL,
+    members_next_cursor_str     TEXT      NOT NULL DEFAULT '-1',
+    members_crawl_status        TEXT      NOT NULL DEFAULT 'pending'
+        CHECK (members_crawl_status IN ('pending', 'done', 'protected', 'not_found', 'suspended')),
+    subscribers_next_cursor_str TEXT      NOT NULL DEFAULT '-1',
+    subscribers_crawl_status    TEXT      NOT NULL DEFAULT 'pending'
+        CHECK (subscribers_crawl_status IN ('pending', 'done', 'protected', 'not_found', 'suspended')),
+    date_last_change            TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS list_memberships
+(
+    list_id  INTEGER NOT NULL,
+    user_id  INTEGER NOT NULL,
+    relation TEXT    NOT NULL CHECK (relation IN ('member', 'subscriber')),
+    CONSTRAINT list_memberships_pkey PRIMARY KEY (list_id, relation, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS list_memberships_user_id ON list_memberships (user_id);
@@ -0,0 +1,676 @@
+package sqlite_storage
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"sort"
+	"time"
+)
+
+// SQLiteStorage keeps a whole crawl in one sqlite file with the schema and semantics of PgStorage,
+// e.g. for small studies which don't need a database server.
+type SQLiteStorage struct {
+	db *sqlx.DB
+}
+
+//go:embed schema.sql
+var schema string
+
+// connection parameters of every connection: WAL lets readers work while a crawl writes, writing transactions
+// take the write lock at once, so concurrent ones wait for each other instead of failing on lock upgrade.
+const connParams = "?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=10000&_txlock=immediate"
+
+// NewSQLiteStorage opens the file, creating it with the schema if it doesn't exist.
+func NewSQLiteStorage(config conf.SQLiteConfig) (*SQLiteStorage, error) {
+	if config.Path == "" {
+		return nil, errors.New("sqlite path isn't set")
+	}
+	db, err := sqlx.Open("sqlite3", config.Path+connParams)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(schema)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "create schema")
+	}
+	return &SQLiteStorage{
+		db: db,
+	}, nil
+}
+
+// Close closes the file, the WAL is checkpointed into it, so the file can be copied alone afterwards.
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// now returns the current time in UTC, times are saved in UTC to be comparable as strings.
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+func (s *SQLiteStorage) AddNewFollowers(ctx context.Context, followers []*models.Follower) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	txErr = addFollowersTx(ctx, tx, followers)
+	if txErr != nil {
+		return txErr
+	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+func addFollowersTx(ctx context.Context, tx *sqlx.Tx, followers []*models.Follower) error {
+	rows := make([][]interface{}, 0, len(followers))
+	for _, follower := range followers {
+		rows = append(rows, []interface{}{follower.UserId, follower.FollowerId})
+	}
+	return insertRowsTx(ctx, tx, "followers", []string{"user_id", "follower_id"}, rows, "ON CONFLICT DO NOTHING")
+}
+
+// AddNewUsers saves new users and updates profiles of saved ones, every new version of a profile is saved
+// to user_snapshots.
+func (s *SQLiteStorage) AddNewUsers(ctx context.Context, users []*models.User) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	txErr = addUsersTx(ctx, tx, users)
+	if txErr != nil {
+		return txErr
+	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+func addUsersTx(ctx context.Context, tx *sqlx.Tx, users []*models.User) error {
+	byId := make(map[int64]*models.User, len(users))
+	ids := make([]int64, 0, len(users))
+	for _, user := range users {
+		if _, ok := byId[user.Id]; !ok {
+			ids = append(ids, user.Id)
+		}
+		byId[user.Id] = user
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	savedById := make(map[int64]*models.User, len(ids))
+	// the write lock is taken by the transaction, so nobody saves the users meanwhile
+	for start := 0; start < len(ids); start += batchRows {
+		end := start + batchRows
+		if end > len(ids) {
+			end = len(ids)
+		}
+		query, args, err := sqlx.In("SELECT * FROM users WHERE id IN (?)", ids[start:end])
+		if err != nil {
+			return err
+		}
+		saved := make([]*models.User, 0, end-start)
+		err = tx.SelectContext(ctx, &saved, tx.Rebind(query), args...)
+		if err != nil {
+			return err
+		}
+		for _, user := range saved {
+			savedById[user.Id] = user
+		}
+	}
+
+	var update *sqlx.NamedStmt
+	if len(savedById) > 0 {
+		var err error
+		update, err = tx.PrepareNamedContext(ctx, `
+UPDATE users SET (screen_name, name, followers_count, friends_count, verified, protected, location, description, url, expanded_url,
+                  statuses_count, favourites_count, listed_count, profile_image_url_https, default_profile, default_profile_image,
+                  additional_data, date_last_change) =
+(:screen_name, :name, :followers_count, :friends_count, :verified, :protected, :location, :description, :url, :expanded_url,
+ :statuses_count, :favourites_count, :listed_count, :profile_image_url_https, :default_profile, :default_profile_image,
+ :additional_data, :date_last_change) WHERE id=:id`)
+		if err != nil {
+			return err
+		}
+		defer update.Close()
+	}
+
+	observedAt := now()
+	newRows := make([][]interface{}, 0, len(ids)-len(savedById))
+	snapshots := make([]*models.UserSnapshot, 0)
+	for _, id := range ids {
+		user := byId[id]
+		user.DateLastChange = observedAt
+		old, ok := savedById[id]
+		if !ok {
+			newRows = append(newRows, userValues(user))
+			snapshots = append(snapshots, models.NewUserSnapshot(user, observedAt, nil))
+			continue
+		}
+		if user.AdditionalData == nil {
+			user.AdditionalData = old.AdditionalData
+		}
+		_, err := update.ExecContext(ctx, user)
+		if err != nil {
+			return err
+		}
+		changes := models.ProfileChanges(old, user)
+		if len(changes) > 0 {
+			snapshots = append(snapshots, models.NewUserSnapshot(user, observedAt, changes))
+		}
+	}
+	err := insertRowsTx(ctx, tx, "users", userColumns, newRows, "")
+	if err != nil {
+		return err
+	}
+	return addUserSnapshotsTx(ctx, tx, snapshots)
+}
+
+var userColumns = []string{"id", "id_str", "screen_name", "name", "created_at", "followers_count", "friends_count",
+	"verified", "date_last_change", "protected", "location", "description", "url", "expanded_url", "statuses_count",
+	"favourites_count", "listed_count", "profile_image_url_https", "default_profile", "default_profile_image", "additional_data"}
+
+// userValues returns values of userColumns of the user.
+func userValues(user *models.User) []interface{} {
+	return []interface{}{user.Id, user.IdStr, user.ScreenName, user.Name, user.CreatedAt, user.FollowersCount,
+		user.FriendsCount, user.Verified, user.DateLastChange, user.Protected, user.Location, user.Description, user.Url,
+		user.ExpandedUrl, user.StatusesCount, user.FavouritesCount, user.ListedCount, user.ProfileImageUrlHttps,
+		user.DefaultProfile, user.DefaultProfileImage, user.AdditionalData}
+}
+
+var userSnapshotColumns = []string{"user_id", "observed_at", "screen_name", "name", "followers_count", "friends_count",
+	"verified", "protected", "location", "description", "url", "changed_fields"}
+
+func addUserSnapshotsTx(ctx context.Context, tx *sqlx.Tx, snapshots []*models.UserSnapshot) error {
+	rows := make([][]interface{}, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		changedFields := snapshot.ChangedFields
+		if changedFields == nil {
+			changedFields = []string{}
+		}
+		changedFieldsJson, err := json.Marshal(changedFields)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []interface{}{snapshot.UserId, snapshot.ObservedAt.UTC(), snapshot.ScreenName, snapshot.Name,
+			snapshot.FollowersCount, snapshot.FriendsCount, snapshot.Verified, snapshot.Protected, snapshot.Location,
+			snapshot.Description, snapshot.Url, string(changedFieldsJson)})
+	}
+	return insertRowsTx(ctx, tx, "user_snapshots", userSnapshotColumns, rows, "")
+}
+
+// GetUserSnapshots returns observed versions of the profile of the user, oldest first.
+func (s *SQLiteStorage) GetUserSnapshots(ctx context.Context, userId int64) ([]*models.UserSnapshot, error) {
+	rows, err := s.db.QueryxContext(ctx, `
+SELECT user_id, observed_at, screen_name, name, followers_count, friends_count, verified, protected, location, description, url,
+       changed_fields
+FROM user_snapshots WHERE user_id=? ORDER BY observed_at, id`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	snapshots := make([]*models.UserSnapshot, 0)
+	for rows.Next() {
+		snapshot := &models.UserSnapshot{}
+		var changedFields string
+		err = rows.Scan(&snapshot.UserId, &snapshot.ObservedAt, &snapshot.ScreenName, &snapshot.Name, &snapshot.FollowersCount,
+			&snapshot.FriendsCount, &snapshot.Verified, &snapshot.Protected, &snapshot.Location, &snapshot.Description,
+			&snapshot.Url, &changedFields)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(changedFields), &snapshot.ChangedFields)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode changed fields")
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+const updateUserStateQuery = `UPDATE users SET (next_cursor, next_cursor_str, crawl_status, date_last_change, protected, location) =
+(:next_cursor, :next_cursor_str, :crawl_status, :date_last_change, :protected, :location) WHERE id=:id
+`
+
+const updateUserFriendsStateQuery = `UPDATE users SET (friends_next_cursor, friends_next_cursor_str, friends_crawl_status, date_last_change) =
+(:friends_next_cursor, :friends_next_cursor_str, :friends_crawl_status, :date_last_change) WHERE id=:id
+`
+
+func (s *SQLiteStorage) UpdateUserState(ctx context.Context, user *models.User) error {
+	user.DateLastChange = now()
+	_, err := s.db.NamedExecContext(ctx, updateUserStateQuery, user)
+	return err
+}
+
+func (s *SQLiteStorage) UpdateUserFriendsState(ctx context.Context, user *models.User) error {
+	user.DateLastChange = now()
+	_, err := s.db.NamedExecContext(ctx, updateUserFriendsStateQuery, user)
+	return err
+}
+
+// CommitFollowersPage saves users, edges and the state of the user of the page in one transaction.
+func (s *SQLiteStorage) CommitFollowersPage(ctx context.Context, page *models.FollowersPage) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	if len(page.Users) > 0 {
+		txErr = addUsersTx(ctx, tx, page.Users)
+		if txErr != nil {
+			return txErr
+		}
+	}
+	txErr = addFollowersTx(ctx, tx, page.Followers)
+	if txErr != nil {
+		return txErr
+	}
+	query := updateUserStateQuery
+	if page.Friends {
+		query = updateUserFriendsStateQuery
+	}
+	page.User.DateLastChange = now()
+	_, txErr = tx.NamedExecContext(ctx, query, page.User)
+	if txErr != nil {
+		return txErr
+	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+func (s *SQLiteStorage) UpdateUserTweetsState(ctx context.Context, user *models.User) error {
+	user.DateLastChange = now()
+	_, err := s.db.NamedExecContext(ctx, `UPDATE users SET (tweets_cursor, tweets_since_id, date_last_change) =
+(:tweets_cursor, :tweets_since_id, :date_last_change) WHERE id=:id`, user)
+	return err
+}
+
+func (s *SQLiteStorage) GetUserById(ctx context.Context, id int64) (*models.User, error) {
+	user := &models.User{}
+	err := s.db.GetContext(ctx, user, "SELECT * FROM users WHERE id=? LIMIT 1", id)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *SQLiteStorage) GetUserByScreenName(ctx context.Context, screenName string) (*models.User, error) {
+	user := &models.User{}
+	err := s.db.GetContext(ctx, user, "SELECT * FROM users WHERE screen_name=? LIMIT 1", screenName)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *SQLiteStorage) selectUsers(ctx context.Context, query string, args ...interface{}) ([]*models.User, error) {
+	users := make([]*models.User, 0)
+	err := s.db.SelectContext(ctx, &users, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetUsersWithNotDownloadedFollowers skips users already queued for downloading, see EnqueueCrawlTasks.
+func (s *SQLiteStorage) GetUsersWithNotDownloadedFollowers(ctx context.Context, n int64) ([]*models.User, error) {
+	return s.selectUsers(ctx, `
+SELECT * FROM users WHERE crawl_status=? AND NOT EXISTS (
+    SELECT 1 FROM crawl_tasks t WHERE t.task_type IN (?, ?) AND t.task_key=users.screen_name AND t.state <> 'done'
+) LIMIT ?`, models.CrawlStatusPending, models.TaskTypeDownloadFollowers, models.TaskTypeDownloadFollowerIds, n)
+}
+
+func (s *SQLiteStorage) GetUsersWithNotDownloadedFriends(ctx context.Context, n int64) ([]*models.User, error) {
+	return s.selectUsers(ctx, `
+SELECT * FROM users WHERE friends_crawl_status=? AND NOT EXISTS (
+    SELECT 1 FROM crawl_tasks t WHERE t.task_type=? AND t.task_key=users.screen_name AND t.state <> 'done'
+) LIMIT ?`, models.CrawlStatusPending, models.TaskTypeDownloadFriends, n)
+}
+
+func (s *SQLiteStorage) GetUsersWithNotDownloadedFollowersSorted(ctx context.Context, n, offset int64) ([]*models.User, error) {
+	return s.selectUsers(ctx, "SELECT * FROM users WHERE crawl_status=? ORDER BY id LIMIT ? OFFSET ?",
+		models.CrawlStatusPending, n, offset)
+}
+
+func (s *SQLiteStorage) GetUsersWithDownloadedFollowers(ctx context.Context, n int64) ([]*models.User, error) {
+	return s.selectUsers(ctx, "SELECT * FROM users WHERE crawl_status=? LIMIT ?", models.CrawlStatusDone, n)
+}
+
+func (s *SQLiteStorage) GetUsersWithDownloadedFollowersSorted(ctx context.Context, n, offset int64) ([]*models.User, error) {
+	return s.selectUsers(ctx, "SELECT * FROM users WHERE crawl_status=? ORDER BY id LIMIT ? OFFSET ?",
+		models.CrawlStatusDone, n, offset)
+}
+
+func (s *SQLiteStorage) GetUnknownUserIds(ctx context.Context, afterId, n int64) ([]int64, error) {
+	userIds := make([]int64, 0, n)
+	// friends of crawled users are on the user_id side of edges
+	err := s.db.SelectContext(ctx, &userIds, `
+SELECT ids.id FROM (
+    SELECT f.follower_id AS id FROM followers f WHERE f.follower_id > ?
+    UNION
+    SELECT f.user_id AS id FROM followers f WHERE f.user_id > ?
+) ids
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id=ids.id)
+ORDER BY ids.id LIMIT ?`, afterId, afterId, n)
+	if err != nil {
+		return nil, err
+	}
+	return userIds, nil
+}
+
+// GetNotHydratedUserIds returns ids of saved users without additional data, ascending from afterId.
+// Users not found by hydration are skipped.
+func (s *SQLiteStorage) GetNotHydratedUserIds(ctx context.Context, afterId, n int64) ([]int64, error) {
+	userIds := make([]int64, 0, n)
+	err := s.db.SelectContext(ctx, &userIds, `
+SELECT id FROM users WHERE additional_data IS NULL AND crawl_status <> 'not_found' AND id > ?
+ORDER BY id LIMIT ?`, afterId, n)
+	if err != nil {
+		return nil, err
+	}
+	return userIds, nil
+}
+
+func (s *SQLiteStorage) GetFollowers(ctx context.Context, userId int64) ([]*models.User, error) {
+	return s.selectUsers(ctx, "SELECT u.* FROM users u JOIN followers f ON u.id=f.follower_id WHERE f.user_id=?", userId)
+}
+
+func (s *SQLiteStorage) GetFollowerIds(ctx context.Context, userId int64) ([]int64, error) {
+	followerIds := make([]int64, 0)
+	err := s.db.SelectContext(ctx, &followerIds, "SELECT follower_id FROM followers WHERE user_id=?", userId)
+	if err != nil {
+		return nil, err
+	}
+	return followerIds, nil
+}
+
+func (s *SQLiteStorage) AddNewTweets(ctx context.Context, tweets []*models.Tweet) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	txErr = addTweetsTx(ctx, tx, tweets)
+	if txErr != nil {
+		return txErr
+	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+// addTweetsTx saves tweets with their hashtags, urls, mentions and media.
+func addTweetsTx(ctx context.Context, tx *sqlx.Tx, tweets []*models.Tweet) error {
+	rows := make([][]interface{}, 0, len(tweets))
+	hashtags := make([][]interface{}, 0)
+	urls := make([][]interface{}, 0)
+	mentions := make([][]interface{}, 0)
+	media := make([][]interface{}, 0)
+	for _, tweet := range tweets {
+		if tweet.Raw == "" {
+			raw, err := json.Marshal(tweet)
+			if err != nil {
+				return err
+			}
+			tweet.Raw = string(raw)
+		}
+		rows = append(rows, []interface{}{tweet.Id, tweet.UserId, tweet.CreatedAt, tweet.FullText, tweet.Lang,
+			tweet.ReplyCount, tweet.RetweetCount, tweet.RetweetedStatusIdStr, tweet.Raw})
+		for _, h := range tweet.Hashtags() {
+			hashtags = append(hashtags, []interface{}{h.TweetId, h.Tag, h.Start, h.End})
+		}
+		for _, u := range tweet.Urls() {
+			urls = append(urls, []interface{}{u.TweetId, u.Url, u.ExpandedUrl, u.Domain, u.Start, u.End})
+		}
+		for _, m := range tweet.Mentions() {
+			mentions = append(mentions, []interface{}{m.TweetId, m.UserId, m.ScreenName, m.Start, m.End})
+		}
+		for _, m := range tweet.Media() {
+			media = append(media, []interface{}{m.TweetId, m.MediaId, m.Type, m.MediaUrl, m.AltText})
+		}
+	}
+	err := insertRowsTx(ctx, tx, "tweets", []string{"id", "user_id", "created_at", "full_text", "lang", "reply_count",
+		"retweet_count", "retweeted_status_id_str", "raw"}, rows, "ON CONFLICT DO NOTHING")
+	if err != nil {
+		return err
+	}
+	err = insertRowsTx(ctx, tx, "tweet_hashtags", []string{"tweet_id", "tag", "start_index", "end_index"},
+		hashtags, "ON CONFLICT DO NOTHING")
+	if err != nil {
+		return err
+	}
+	err = insertRowsTx(ctx, tx, "tweet_urls", []string{"tweet_id", "url", "expanded_url", "domain", "start_index", "end_index"},
+		urls, "ON CONFLICT DO NOTHING")
+	if err != nil {
+		return err
+	}
+	err = insertRowsTx(ctx, tx, "tweet_mentions", []string{"tweet_id", "user_id", "screen_name", "start_index", "end_index"},
+		mentions, "ON CONFLICT DO NOTHING")
+	if err != nil {
+		return err
+	}
+	return insertRowsTx(ctx, tx, "tweet_media", []string{"tweet_id", "media_id", "type", "media_url", "alt_text"},
+		media, "ON CONFLICT DO NOTHING")
+}
+
+func (s *SQLiteStorage) GetLastTweetId(ctx context.Context, userId int64) (int64, error) {
+	var lastTweetId int64
+	err := s.db.GetContext(ctx, &lastTweetId, "SELECT COALESCE(MAX(id), 0) FROM tweets WHERE user_id=?", userId)
+	if err != nil {
+		return 0, err
+	}
+	return lastTweetId, nil
+}
+
+// GetTweets returns up to n saved tweets with ids greater than afterId decoded from their raw json.
+func (s *SQLiteStorage) GetTweets(ctx context.Context, afterId, n int64) ([]*models.Tweet, error) {
+	raws := make([]string, 0, n)
+	err := s.db.SelectContext(ctx, &raws, "SELECT raw FROM tweets WHERE id > ? ORDER BY id LIMIT ?", afterId, n)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTweets(raws)
+}
+
+// GetTweetsByIds returns saved tweets with the given ids decoded from their raw json.
+func (s *SQLiteStorage) GetTweetsByIds(ctx context.Context, ids []int64) ([]*models.Tweet, error) {
+	if len(ids) == 0 {
+		return []*models.Tweet{}, nil
+	}
+	query, args, err := sqlx.In("SELECT raw FROM tweets WHERE id IN (?)", ids)
+	if err != nil {
+		return nil, err
+	}
+	raws := make([]string, 0, len(ids))
+	err = s.db.SelectContext(ctx, &raws, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTweets(raws)
+}
+
+func decodeTweets(raws []string) ([]*models.Tweet, error) {
+	tweets := make([]*models.Tweet, 0, len(raws))
+	for _, raw := range raws {
+		tweet := &models.Tweet{}
+		err := json.Unmarshal([]byte(raw), tweet)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode raw tweet")
+		}
+		tweets = append(tweets, tweet)
+	}
+	return tweets, nil
+}
+
+func (s *SQLiteStorage) AddNewInteractions(ctx context.Context, interactions []*models.Interaction) error {
+	rows := make([][]interface{}, 0, len(interactions))
+	for _, interaction := range interactions {
+		rows = append(rows, []interface{}{interaction.UserId, interaction.TargetUserId, interaction.Type, interaction.TweetId,
+			interaction.TargetTweetId, interaction.CreatedAt.UTC()})
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	txErr = insertRowsTx(ctx, tx, "interactions", []string{"user_id", "target_user_id", "type", "tweet_id",
+		"target_tweet_id", "created_at"}, rows, "ON CONFLICT DO NOTHING")
+	if txErr != nil {
+		return txErr
+	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+// GetInteractions returns interactions of the user with other users.
+func (s *SQLiteStorage) GetInteractions(ctx context.Context, userId int64) ([]*models.Interaction, error) {
+	interactions := make([]*models.Interaction, 0)
+	err := s.db.SelectContext(ctx, &interactions, "SELECT * FROM interactions WHERE user_id=?", userId)
+	if err != nil {
+		return nil, err
+	}
+	return interactions, nil
+}
+
+func (s *SQLiteStorage) GetSearchState(ctx context.Context, key string) (*models.SearchState, error) {
+	state := &models.SearchState{}
+	err := s.db.GetContext(ctx, state, "SELECT * FROM searches WHERE search_key=?", key)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (s *SQLiteStorage) UpdateSearchState(ctx context.Context, state *models.SearchState) error {
+	state.DateLastChange = now()
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO searches (search_key, cursor, slice_until, done, date_last_change) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (search_key) DO UPDATE
+SET (cursor, slice_until, done, date_last_change) = (excluded.cursor, excluded.slice_until, excluded.done, excluded.date_last_change)`,
+		state.Key, state.Cursor, state.SliceUntil.UTC(), state.Done, state.DateLastChange)
+	return err
+}
+
+func (s *SQLiteStorage) AddNewLists(ctx context.Context, lists []*models.List) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	stmt, txErr := tx.PrepareNamedContext(ctx, `
+INSERT INTO lists (id, id_str, name, slug, description, mode, member_count, subscriber_count, created_at, owner_id,
+                   members_next_cursor_str, members_crawl_status, subscribers_next_cursor_str, subscribers_crawl_status, date_last_change)
+VALUES (:id, :id_str, :name, :slug, :description, :mode, :member_count, :subscriber_count, :created_at, :owner_id,
+        :members_next_cursor_str, :members_crawl_status, :subscribers_next_cursor_str, :subscribers_crawl_status, :date_last_change)
+ON CONFLICT (id) DO UPDATE
+SET (name, slug, description, mode, member_count, subscriber_count, date_last_change) =
+(excluded.name, excluded.slug, excluded.description, excluded.mode, excluded.member_count, excluded.subscriber_count,
+ excluded.date_last_change)`)
+	if txErr != nil {
+		return txErr
+	}
+	for _, list := range lists {
+		list.DateLastChange = now()
+		_, txErr = stmt.ExecContext(ctx, list)
+		if txErr != nil {
+			return txErr
+		}
+	}
+	txErr = stmt.Close()
+	if txErr != nil {
+		return txErr
+	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+func (s *SQLiteStorage) GetListById(ctx context.Context, id int64) (*models.List, error) {
+	list := &models.List{}
+	err := s.db.GetContext(ctx, list, "SELECT * FROM lists WHERE id=?", id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *SQLiteStorage) UpdateListState(ctx context.Context, list *models.List, relation models.ListRelation) error {
+	list.DateLastChange = now()
+	query := `UPDATE lists SET (members_next_cursor_str, members_crawl_status, date_last_change) =
+(:members_next_cursor_str, :members_crawl_status, :date_last_change) WHERE id=:id`
+	if relation == models.ListRelationSubscriber {
+		query = `UPDATE lists SET (subscribers_next_cursor_str, subscribers_crawl_status, date_last_change) =
+(:subscribers_next_cursor_str, :subscribers_crawl_status, :date_last_change) WHERE id=:id`
+	}
+	_, err := s.db.NamedExecContext(ctx, query, list)
+	return err
+}
+
+func (s *SQLiteStorage) AddListMemberships(ctx context.Context, memberships []*models.ListMembership) error {
+	rows := make([][]interface{}, 0, len(memberships))
+	for _, membership := range memberships {
+		rows = append(rows, []interface{}{membership.ListId, membership.UserId, membership.Relation})
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	txErr = insertRowsTx(ctx, tx, "list_memberships", []string{"list_id", "user_id", "relation"}, rows, "ON CONFLICT DO NOTHING")
+	if txErr != nil {
+		return txErr
+	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+var _ storage.Backend = (*SQLiteStorage)(nil)
@@ -0,0 +1,194 @@
+package sqlite_storage
+
+import (
+	"context"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage/conformance"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestStorage(t *testing.T) *SQLiteStorage {
+	s, err := NewSQLiteStorage(conf.SQLiteConfig{Path: filepath.Join(t.TempDir(), "crawl.db")})
+	if err != nil {
+		t.Fatalf("can't create sqlite storage, err='%v'", err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+	})
+	return s
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) conformance.Storage {
+		return newTestStorage(t)
+	})
+}
+
+func TestSQLiteStorage_WAL(t *testing.T) {
+	s := newTestStorage(t)
+	var journalMode string
+	err := s.db.Get(&journalMode, "PRAGMA journal_mode")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "wal", journalMode)
+	}
+}
+
+func TestSQLiteStorage_Batches(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	// more rows than a single insert takes
+	size := 3*batchRows + 7
+	users := make([]*models.User, 0, size)
+	followers := make([]*models.Follower, 0, size)
+	for i := 1; i <= size; i++ {
+		id := int64(i)
+		users = append(users, &models.User{Id: id, IdStr: strconv.FormatInt(id, 10), ScreenName: "user" + strconv.Itoa(i)})
+		followers = append(followers, &models.Follower{UserId: 1, FollowerId: id})
+	}
+	err := s.AddNewUsers(ctx, users)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = s.AddNewUsers(ctx, users)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = s.AddNewFollowers(ctx, followers)
+	if !assert.NoError(t, err) {
+		return
+	}
+	followerIds, err := s.GetFollowerIds(ctx, 1)
+	if assert.NoError(t, err) {
+		assert.Len(t, followerIds, size)
+	}
+	var snapshots int
+	err = s.db.Get(&snapshots, "SELECT count(*) FROM user_snapshots")
+	if assert.NoError(t, err) {
+		assert.Equal(t, size, snapshots)
+	}
+}
+
+func TestSQLiteStorage_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crawl.db")
+	s, err := NewSQLiteStorage(conf.SQLiteConfig{Path: path})
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx := context.Background()
+	err = s.AddNewUsers(ctx, []*models.User{{Id: 1, IdStr: "1", ScreenName: "first"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, s.Close())
+	// everything is in the file after close, it can be copied alone
+	_, err = os.Stat(path + "-wal")
+	assert.True(t, os.IsNotExist(err), "WAL is left after close")
+
+	s, err = NewSQLiteStorage(conf.SQLiteConfig{Path: path})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+	user, err := s.GetUserById(ctx, 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "first", user.ScreenName)
+	}
+}
+
+func TestSQLiteStorage_ConcurrentClaims(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	tasks := make([]*models.CrawlTask, 0, 100)
+	for i := 0; i < 100; i++ {
+		tasks = append(tasks, &models.CrawlTask{Type: models.TaskTypeHydrateUsers, Key: strconv.Itoa(i), Payload: "{}"})
+	}
+	_, err := s.EnqueueCrawlTasks(ctx, tasks)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var lock sync.Mutex
+	claimed := make(map[int64]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				tasks, err := s.ClaimCrawlTasks(ctx, "worker", 3, time.Minute)
+				if !assert.NoError(t, err) || len(tasks) == 0 {
+					return
+				}
+				lock.Lock()
+				for _, task := range tasks {
+					claimed[task.Id]++
+				}
+				lock.Unlock()
+				for _, task := range tasks {
+					assert.NoError(t, s.CompleteCrawlTask(ctx, task.Id, "worker"))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// every task is given to one claim only, concurrent writers wait for the lock instead of failing
+	assert.Len(t, claimed, 100)
+	for id, count := range claimed {
+		assert.Equal(t, 1, count, "task %d", id)
+	}
+}
+
+func TestSQLiteStorage_GetTweets(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	err := s.AddNewTweets(ctx, []*models.Tweet{
+		{Id: 10, IdStr: "10", UserId: 1, FullText: "first", RetweetedStatusIdStr: "5"},
+		{Id: 12, IdStr: "12", UserId: 1, FullText: "second"},
+		{Id: 11, IdStr: "11", UserId: 2, FullText: "other"},
+	})
+	assert.NoError(t, err)
+
+	tweets, err := s.GetTweets(ctx, 10, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, tweets, 2) {
+		assert.Equal(t, "11", tweets[0].IdStr)
+		assert.Equal(t, "second", tweets[1].FullText)
+	}
+	tweets, err = s.GetTweetsByIds(ctx, []int64{10, 99})
+	assert.NoError(t, err)
+	if assert.Len(t, tweets, 1) {
+		assert.Equal(t, "5", tweets[0].RetweetedStatusIdStr)
+	}
+	tweets, err = s.GetTweetsByIds(ctx, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, tweets)
+}
+
+func TestSQLiteStorage_GetNotHydratedUserIds(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	raw := `{"id":2}`
+	err := s.AddNewUsers(ctx, []*models.User{
+		{Id: 1, IdStr: "1", ScreenName: "a"},
+		{Id: 2, IdStr: "2", ScreenName: "b", AdditionalData: &raw},
+		{Id: 3, IdStr: "3", ScreenName: "c"},
+		{Id: 4, IdStr: "4", ScreenName: "d"},
+	})
+	assert.NoError(t, err)
+	notFound := &models.User{Id: 4, NextCursor: -1, NextCursorStr: "-1", CrawlStatus: models.CrawlStatusNotFound}
+	assert.NoError(t, s.UpdateUserState(ctx, notFound))
+
+	userIds, err := s.GetNotHydratedUserIds(ctx, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 3}, userIds, "hydrated and not found users should be skipped")
+	userIds, err = s.GetNotHydratedUserIds(ctx, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3}, userIds)
+}
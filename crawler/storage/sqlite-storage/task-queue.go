@@ -0,0 +1,265 @@
+package sqlite_storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"github.com/scarecrow6977/twitter-crawler/crawler/storage"
+	"time"
+)
+
+// Queries of this file work with crawl_tasks table, see pg-storage/task-queue.go for the semantics.
+
+func (s *SQLiteStorage) EnqueueCrawlTasks(ctx context.Context, tasks []*models.CrawlTask) (int64, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	stmt, txErr := tx.PrepareContext(ctx, `
+INSERT INTO crawl_tasks (task_type, task_key, payload, priority, available_at, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (task_type, task_key) WHERE state <> 'done' DO NOTHING`)
+	if txErr != nil {
+		return 0, txErr
+	}
+	var enqueued, affected int64
+	var res sql.Result
+	for _, task := range tasks {
+		createdAt := now()
+		res, txErr = stmt.ExecContext(ctx, task.Type, task.Key, task.Payload, task.Priority, createdAt, createdAt, createdAt)
+		if txErr != nil {
+			return 0, txErr
+		}
+		affected, txErr = res.RowsAffected()
+		if txErr != nil {
+			return 0, txErr
+		}
+		enqueued += affected
+	}
+	txErr = stmt.Close()
+	if txErr != nil {
+		return 0, txErr
+	}
+	txErr = tx.Commit()
+	if txErr != nil {
+		return 0, txErr
+	}
+	return enqueued, nil
+}
+
+// ClaimCrawlTasks leases up to n available pending tasks (or tasks with expired lease) to owner.
+// The transaction holds the write lock of the file, so every task is given to one owner only.
+func (s *SQLiteStorage) ClaimCrawlTasks(ctx context.Context, owner string, n int64, leaseDuration time.Duration) ([]*models.CrawlTask, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	claimedAt := now()
+	ids := make([]int64, 0, n)
+	txErr = tx.SelectContext(ctx, &ids, `
+SELECT id FROM crawl_tasks
+WHERE (state = 'pending' AND available_at <= ?) OR (state = 'leased' AND lease_expires_at < ?)
+ORDER BY priority DESC, id
+LIMIT ?`, claimedAt, claimedAt, n)
+	if txErr != nil {
+		return nil, txErr
+	}
+	tasks := make([]*models.CrawlTask, 0, len(ids))
+	if len(ids) == 0 {
+		txErr = tx.Commit()
+		return tasks, txErr
+	}
+	query, args, txErr := sqlx.In(`
+UPDATE crawl_tasks SET (state, lease_owner, lease_expires_at, attempts, updated_at) = ('leased', ?, ?, attempts + 1, ?)
+WHERE id IN (?)`, owner, claimedAt.Add(leaseDuration), claimedAt, ids)
+	if txErr != nil {
+		return nil, txErr
+	}
+	_, txErr = tx.ExecContext(ctx, query, args...)
+	if txErr != nil {
+		return nil, txErr
+	}
+	query, args, txErr = sqlx.In("SELECT * FROM crawl_tasks WHERE id IN (?) ORDER BY priority DESC, id", ids)
+	if txErr != nil {
+		return nil, txErr
+	}
+	txErr = tx.SelectContext(ctx, &tasks, query, args...)
+	if txErr != nil {
+		return nil, txErr
+	}
+	txErr = tx.Commit()
+	if txErr != nil {
+		return nil, txErr
+	}
+	return tasks, nil
+}
+
+func (s *SQLiteStorage) ExtendCrawlTaskLease(ctx context.Context, id int64, owner string, leaseDuration time.Duration) error {
+	updatedAt := now()
+	return execLeased(ctx, s.db, `
+UPDATE crawl_tasks SET (lease_expires_at, updated_at) = (?, ?)
+WHERE id=? AND lease_owner=? AND state='leased'`, updatedAt.Add(leaseDuration), updatedAt, id, owner)
+}
+
+func (s *SQLiteStorage) CompleteCrawlTask(ctx context.Context, id int64, owner string) error {
+	return execLeased(ctx, s.db, `
+UPDATE crawl_tasks SET (state, lease_owner, lease_expires_at, updated_at) = ('done', NULL, NULL, ?)
+WHERE id=? AND lease_owner=? AND state='leased'`, now(), id, owner)
+}
+
+// FailCrawlTask returns the task to the queue, remembering the error it failed with.
+// The task can't be claimed again until retryAt.
+func (s *SQLiteStorage) FailCrawlTask(ctx context.Context, id int64, owner string, lastError string, retryAt time.Time) error {
+	return execLeased(ctx, s.db, `
+UPDATE crawl_tasks SET (state, lease_owner, lease_expires_at, last_error, available_at, updated_at) =
+('pending', NULL, NULL, ?, ?, ?)
+WHERE id=? AND lease_owner=? AND state='leased'`, lastError, retryAt.UTC(), now(), id, owner)
+}
+
+// DeadLetterCrawlTask moves the task to dead state and records it to crawl_tasks_dead table.
+// Dead tasks aren't claimed and block queueing of the same work until they are re-driven.
+func (s *SQLiteStorage) DeadLetterCrawlTask(ctx context.Context, id int64, owner string, errorClass string, lastError string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	failedAt := now()
+	txErr = execLeased(ctx, tx, `
+UPDATE crawl_tasks SET (state, lease_owner, lease_expires_at, last_error, updated_at) = ('dead', NULL, NULL, ?, ?)
+WHERE id=? AND lease_owner=? AND state='leased'`, lastError, failedAt, id, owner)
+	if txErr != nil {
+		return txErr
+	}
+	_, txErr = tx.ExecContext(ctx, `
+INSERT INTO crawl_tasks_dead (task_id, task_type, task_key, attempts, error_class, last_error, failed_at)
+SELECT id, task_type, task_key, attempts, ?, ?, ? FROM crawl_tasks WHERE id=?`, errorClass, lastError, failedAt, id)
+	if txErr != nil {
+		return txErr
+	}
+	txErr = tx.Commit()
+	return txErr
+}
+
+// GetDeadCrawlTasks returns up to n oldest dead tasks of the given type, or of any type if taskType is empty.
+func (s *SQLiteStorage) GetDeadCrawlTasks(ctx context.Context, taskType string, n int64) ([]*models.DeadCrawlTask, error) {
+	tasks := make([]*models.DeadCrawlTask, 0, n)
+	err := s.db.SelectContext(ctx, &tasks, `
+SELECT * FROM crawl_tasks_dead WHERE (? = '' OR task_type = ?) ORDER BY id LIMIT ?`, taskType, taskType, n)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// RedriveDeadCrawlTasks returns up to n oldest dead tasks of the given type (or of any type if taskType is empty)
+// to the queue with reset attempts counter.
+func (s *SQLiteStorage) RedriveDeadCrawlTasks(ctx context.Context, taskType string, n int64) (int64, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	var txErr error
+	defer func() {
+		if txErr != nil {
+			tx.Rollback()
+		}
+	}()
+	dead := make([]*models.DeadCrawlTask, 0, n)
+	txErr = tx.SelectContext(ctx, &dead, `
+SELECT * FROM crawl_tasks_dead WHERE (? = '' OR task_type = ?) ORDER BY id LIMIT ?`, taskType, taskType, n)
+	if txErr != nil {
+		return 0, txErr
+	}
+	if len(dead) == 0 {
+		txErr = tx.Commit()
+		return 0, txErr
+	}
+	ids := make([]int64, 0, len(dead))
+	taskIds := make([]int64, 0, len(dead))
+	for _, task := range dead {
+		ids = append(ids, task.Id)
+		taskIds = append(taskIds, task.TaskId)
+	}
+	query, args, txErr := sqlx.In("DELETE FROM crawl_tasks_dead WHERE id IN (?)", ids)
+	if txErr != nil {
+		return 0, txErr
+	}
+	_, txErr = tx.ExecContext(ctx, query, args...)
+	if txErr != nil {
+		return 0, txErr
+	}
+	redrivenAt := now()
+	query, args, txErr = sqlx.In(`
+UPDATE crawl_tasks SET (state, attempts, last_error, available_at, updated_at) = ('pending', 0, NULL, ?, ?)
+WHERE id IN (?) AND state = 'dead'`, redrivenAt, redrivenAt, taskIds)
+	if txErr != nil {
+		return 0, txErr
+	}
+	res, txErr := tx.ExecContext(ctx, query, args...)
+	if txErr != nil {
+		return 0, txErr
+	}
+	redriven, txErr := res.RowsAffected()
+	if txErr != nil {
+		return 0, txErr
+	}
+	txErr = tx.Commit()
+	if txErr != nil {
+		return 0, txErr
+	}
+	return redriven, nil
+}
+
+// ReleaseCrawlTask returns the task to the queue without counting the attempt, e.g. when the worker is stopped.
+func (s *SQLiteStorage) ReleaseCrawlTask(ctx context.Context, id int64, owner string) error {
+	return execLeased(ctx, s.db, `
+UPDATE crawl_tasks SET (state, lease_owner, lease_expires_at, attempts, updated_at) = ('pending', NULL, NULL, attempts - 1, ?)
+WHERE id=? AND lease_owner=? AND state='leased'`, now(), id, owner)
+}
+
+func (s *SQLiteStorage) CountPendingCrawlTasks(ctx context.Context) (int64, error) {
+	var count int64
+	countedAt := now()
+	err := s.db.GetContext(ctx, &count, `
+SELECT count(*) FROM crawl_tasks
+WHERE (state = 'pending' AND available_at <= ?) OR (state = 'leased' AND lease_expires_at < ?)`, countedAt, countedAt)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// execLeased runs an update of a leased task, returning storage.ErrLeaseLost if the task isn't leased to owner anymore.
+func execLeased(ctx context.Context, db sqlx.ExecerContext, query string, args ...interface{}) error {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrLeaseLost
+	}
+	return nil
+}
@@ -1,10 +1,16 @@
 package storage
 
 import (
+	"context"
+	"github.com/pkg/errors"
 	"github.com/scarecrow6977/twitter-crawler/crawler/models"
 	"github.com/scarecrow6977/twitter-crawler/crawler/storage/fs-storage"
+	"time"
 )
 
+// ErrLeaseLost is returned when a task lease has expired and the task was claimed by another worker.
+var ErrLeaseLost = errors.New("task lease lost")
+
 type StorageOld interface {
 	Save(record *fs_storage.Record) error
 	GetLastCursor() (string, error)
@@ -12,13 +18,88 @@ type StorageOld interface {
 }
 
 type Storage interface {
-	AddNewFollowers(followers []*models.Follower) error
-	AddNewUsers(users []*models.User) error
-	UpdateUserState(user *models.User) error
-	GetUserById(id int64) (*models.User, error)
-	GetUserByScreenName(screenName string) (*models.User, error)
-	GetUsersWithNotDownloadedFollowers(n int64) ([]*models.User, error)
-	GetUsersWithDownloadedFollowers(n int64) ([]*models.User, error)
-	GetUsersWithNotDownloadedFollowersSorted(n, offset int64) ([]*models.User, error)
-	GetUsersWithDownloadedFollowersSorted(n, offset int64) ([]*models.User, error)
+	AddNewFollowers(ctx context.Context, followers []*models.Follower) error
+	// AddNewUsers saves new users and updates profiles of saved ones, every new version of a profile is kept
+	// in the history of the user.
+	AddNewUsers(ctx context.Context, users []*models.User) error
+	UpdateUserState(ctx context.Context, user *models.User) error
+	// CommitFollowersPage saves users and edges of the page with the followers (or friends) state of its user
+	// at once, so a crawl resumed after a crash continues right after the last saved page.
+	CommitFollowersPage(ctx context.Context, page *models.FollowersPage) error
+	// UpdateUserFriendsState saves only the friends cursor and status, so it doesn't overwrite the followers ones.
+	UpdateUserFriendsState(ctx context.Context, user *models.User) error
+	// UpdateUserTweetsState saves only the tweets cursor and since id of the user.
+	UpdateUserTweetsState(ctx context.Context, user *models.User) error
+	GetUserById(ctx context.Context, id int64) (*models.User, error)
+	GetUserByScreenName(ctx context.Context, screenName string) (*models.User, error)
+	// GetUserSnapshots returns the history of the profile of the user, oldest version first.
+	GetUserSnapshots(ctx context.Context, userId int64) ([]*models.UserSnapshot, error)
+	GetUsersWithNotDownloadedFollowers(ctx context.Context, n int64) ([]*models.User, error)
+	GetUsersWithNotDownloadedFriends(ctx context.Context, n int64) ([]*models.User, error)
+	GetUsersWithDownloadedFollowers(ctx context.Context, n int64) ([]*models.User, error)
+	GetUsersWithNotDownloadedFollowersSorted(ctx context.Context, n, offset int64) ([]*models.User, error)
+	GetUsersWithDownloadedFollowersSorted(ctx context.Context, n, offset int64) ([]*models.User, error)
+	// GetUnknownUserIds returns ids of users from followers edges which aren't saved to users yet, ascending from afterId.
+	GetUnknownUserIds(ctx context.Context, afterId, n int64) ([]int64, error)
+	AddNewTweets(ctx context.Context, tweets []*models.Tweet) error
+	// GetLastTweetId returns id of the newest saved tweet of the user, 0 if there are none.
+	GetLastTweetId(ctx context.Context, userId int64) (int64, error)
+	AddNewInteractions(ctx context.Context, interactions []*models.Interaction) error
+	// GetSearchState returns the progress of the search, nil if the search hasn't been started.
+	GetSearchState(ctx context.Context, key string) (*models.SearchState, error)
+	UpdateSearchState(ctx context.Context, state *models.SearchState) error
+	// AddNewLists saves lists, metadata of saved lists is updated but their crawl state is kept.
+	AddNewLists(ctx context.Context, lists []*models.List) error
+	// GetListById returns the list, nil if it isn't saved.
+	GetListById(ctx context.Context, id int64) (*models.List, error)
+	// UpdateListState saves only the cursor and status of the relation, so members and subscribers
+	// of the list can be downloaded at the same time.
+	UpdateListState(ctx context.Context, list *models.List, relation models.ListRelation) error
+	AddListMemberships(ctx context.Context, memberships []*models.ListMembership) error
+	TaskQueueStorage
+}
+
+// FollowersReader reads the saved follower graph, e.g. to extract a subgraph of it.
+type FollowersReader interface {
+	// GetFollowers returns saved profiles of followers of the user.
+	GetFollowers(ctx context.Context, userId int64) ([]*models.User, error)
+	GetFollowerIds(ctx context.Context, userId int64) ([]int64, error)
+}
+
+// TweetsReader reads saved tweets, e.g. to extract interactions of them.
+type TweetsReader interface {
+	// GetTweets returns up to n saved tweets with ids greater than afterId, ascending by id.
+	GetTweets(ctx context.Context, afterId, n int64) ([]*models.Tweet, error)
+	GetTweetsByIds(ctx context.Context, ids []int64) ([]*models.Tweet, error)
+}
+
+// UsersReader reads saved users, e.g. to backfill their profiles.
+type UsersReader interface {
+	// GetNotHydratedUserIds returns ids of saved users without additional data, ascending from afterId.
+	// Users saved as not found by hydration aren't returned, they would be looked up in vain.
+	GetNotHydratedUserIds(ctx context.Context, afterId, n int64) ([]int64, error)
+}
+
+// Backend is a storage a crawl is saved to, which is read by tools working with results of the crawl too.
+type Backend interface {
+	Storage
+	FollowersReader
+	TweetsReader
+	UsersReader
+	Close() error
+}
+
+// TaskQueueStorage is a persistent task queue shared by all crawler processes working with the same storage.
+// Tasks are leased to workers for a limited time, a task with expired lease can be claimed again.
+type TaskQueueStorage interface {
+	EnqueueCrawlTasks(ctx context.Context, tasks []*models.CrawlTask) (int64, error)
+	ClaimCrawlTasks(ctx context.Context, owner string, n int64, leaseDuration time.Duration) ([]*models.CrawlTask, error)
+	ExtendCrawlTaskLease(ctx context.Context, id int64, owner string, leaseDuration time.Duration) error
+	CompleteCrawlTask(ctx context.Context, id int64, owner string) error
+	FailCrawlTask(ctx context.Context, id int64, owner string, lastError string, retryAt time.Time) error
+	ReleaseCrawlTask(ctx context.Context, id int64, owner string) error
+	CountPendingCrawlTasks(ctx context.Context) (int64, error)
+	DeadLetterCrawlTask(ctx context.Context, id int64, owner string, errorClass string, lastError string) error
+	GetDeadCrawlTasks(ctx context.Context, taskType string, n int64) ([]*models.DeadCrawlTask, error)
+	RedriveDeadCrawlTasks(ctx context.Context, taskType string, n int64) (int64, error)
 }
@@ -0,0 +1,271 @@
+package twitter_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/scarecrow6977/twitter-crawler/crawler/models"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const DefaultBaseUrl = "https://api.twitter.com"
+
+// Page sizes of cursored lists and the max number of users in a users/lookup request.
+const (
+	UsersListPageSize = 200
+	IdsPageSize       = 5000
+	UsersLookupSize   = 100
+	ListUsersPageSize = 5000
+)
+
+// TwitterAPI is the part of twitter api used by crawler tasks.
+type TwitterAPI interface {
+	ShowUser(ctx context.Context, screenName string) (*models.User, error)
+	FollowersList(ctx context.Context, userId int64, cursor string) (*UsersPage, error)
+	FollowerIds(ctx context.Context, userId int64, cursor string) (*IdsPage, error)
+	FriendsList(ctx context.Context, userId int64, cursor string) (*UsersPage, error)
+	FriendIds(ctx context.Context, userId int64, cursor string) (*IdsPage, error)
+	UsersLookup(ctx context.Context, userIds []int64) ([]*models.User, error)
+	ProfileTimeline(ctx context.Context, userId int64, cursor string) (*Timeline, error)
+	SearchTimeline(ctx context.Context, query string, cursor string) (*Timeline, error)
+	ShowList(ctx context.Context, listId int64) (*models.List, error)
+	ListMembers(ctx context.Context, listId int64, cursor string) (*UsersPage, error)
+	ListSubscribers(ctx context.Context, listId int64, cursor string) (*UsersPage, error)
+}
+
+// Doer sends requests, it's http_client.HttpClient which authorizes them on behalf of its accounts.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client makes requests to twitter api served at baseUrl, e.g. a fake twitter server in tests.
+type Client struct {
+	baseUrl    string
+	httpClient Doer
+}
+
+func NewClient(baseUrl string, httpClient Doer) *Client {
+	if baseUrl == "" {
+		baseUrl = DefaultBaseUrl
+	}
+	return &Client{
+		baseUrl:    strings.TrimRight(baseUrl, "/"),
+		httpClient: httpClient,
+	}
+}
+
+func (c *Client) ShowUser(ctx context.Context, screenName string) (*models.User, error) {
+	q := userParams()
+	q.Set("screen_name", strings.ToLower(screenName))
+	user := &models.User{}
+	err := c.get(ctx, "/1.1/users/show.json", q, user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (c *Client) FollowersList(ctx context.Context, userId int64, cursor string) (*UsersPage, error) {
+	return c.usersList(ctx, "/1.1/followers/list.json", userId, cursor)
+}
+
+func (c *Client) FollowerIds(ctx context.Context, userId int64, cursor string) (*IdsPage, error) {
+	return c.idsList(ctx, "/1.1/followers/ids.json", userId, cursor)
+}
+
+func (c *Client) FriendsList(ctx context.Context, userId int64, cursor string) (*UsersPage, error) {
+	return c.usersList(ctx, "/1.1/friends/list.json", userId, cursor)
+}
+
+func (c *Client) FriendIds(ctx context.Context, userId int64, cursor string) (*IdsPage, error) {
+	return c.idsList(ctx, "/1.1/friends/ids.json", userId, cursor)
+}
+
+func (c *Client) usersList(ctx context.Context, path string, userId int64, cursor string) (*UsersPage, error) {
+	q := userParams()
+	q.Set("cursor", cursor)
+	q.Set("user_id", strconv.FormatInt(userId, 10))
+	q.Set("count", strconv.Itoa(UsersListPageSize))
+	page := &UsersPage{}
+	err := c.get(ctx, path, q, page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (c *Client) idsList(ctx context.Context, path string, userId int64, cursor string) (*IdsPage, error) {
+	q := url.Values{}
+	q.Set("cursor", cursor)
+	q.Set("user_id", strconv.FormatInt(userId, 10))
+	q.Set("count", strconv.Itoa(IdsPageSize))
+	page := &IdsPage{}
+	err := c.get(ctx, path, q, page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (c *Client) ShowList(ctx context.Context, listId int64) (*models.List, error) {
+	q := url.Values{}
+	q.Set("list_id", strconv.FormatInt(listId, 10))
+	list := &models.List{}
+	err := c.get(ctx, "/1.1/lists/show.json", q, list)
+	if err != nil {
+		return nil, err
+	}
+	if list.Owner != nil {
+		list.OwnerId = list.Owner.Id
+	}
+	return list, nil
+}
+
+func (c *Client) ListMembers(ctx context.Context, listId int64, cursor string) (*UsersPage, error) {
+	return c.listUsers(ctx, "/1.1/lists/members.json", listId, cursor)
+}
+
+func (c *Client) ListSubscribers(ctx context.Context, listId int64, cursor string) (*UsersPage, error) {
+	return c.listUsers(ctx, "/1.1/lists/subscribers.json", listId, cursor)
+}
+
+func (c *Client) listUsers(ctx context.Context, path string, listId int64, cursor string) (*UsersPage, error) {
+	q := userParams()
+	q.Set("cursor", cursor)
+	q.Set("list_id", strconv.FormatInt(listId, 10))
+	q.Set("count", strconv.Itoa(ListUsersPageSize))
+	page := &UsersPage{}
+	err := c.get(ctx, path, q, page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// UsersLookup returns profiles of at most UsersLookupSize users, users which don't exist anymore are omitted.
+func (c *Client) UsersLookup(ctx context.Context, userIds []int64) ([]*models.User, error) {
+	if len(userIds) > UsersLookupSize {
+		return nil, fmt.Errorf("can't look up %d users at once, max is %d", len(userIds), UsersLookupSize)
+	}
+	ids := make([]string, 0, len(userIds))
+	for _, id := range userIds {
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+	q := userParams()
+	q.Set("user_id", strings.Join(ids, ","))
+	users := make([]*models.User, 0, len(userIds))
+	err := c.get(ctx, "/1.1/users/lookup.json", q, &users)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (c *Client) ProfileTimeline(ctx context.Context, userId int64, cursor string) (*Timeline, error) {
+	q := tweetParams()
+	q.Set("include_tweet_replies", "false")
+	q.Set("userId", strconv.FormatInt(userId, 10))
+	q.Set("count", "200")
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+	q.Set("ext", "mediaStats,highlightedLabel,cameraMoment")
+	timeline := &Timeline{}
+	err := c.get(ctx, fmt.Sprintf("/2/timeline/profile/%d.json", userId), q, timeline)
+	if err != nil {
+		return nil, err
+	}
+	return timeline, nil
+}
+
+// SearchTimeline requests a page of the latest tweets matching the query, which may use search operators,
+// e.g. "#golang since:2020-01-01 until:2020-01-02".
+func (c *Client) SearchTimeline(ctx context.Context, query string, cursor string) (*Timeline, error) {
+	q := tweetParams()
+	q.Set("q", query)
+	q.Set("tweet_search_mode", "live")
+	q.Set("query_source", "typed_query")
+	q.Set("count", "100")
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+	q.Set("pc", "1")
+	q.Set("spelling_corrections", "1")
+	q.Set("ext", "mediaStats,highlightedLabel,cameraMoment")
+	timeline := &Timeline{}
+	err := c.get(ctx, "/2/search/adaptive.json", q, timeline)
+	if err != nil {
+		return nil, err
+	}
+	return timeline, nil
+}
+
+// tweetParams are query parameters the web client sends with every request returning tweets.
+func tweetParams() url.Values {
+	q := userParams()
+	q.Set("cards_platform", "Web-12")
+	q.Set("include_cards", "1")
+	q.Set("include_composer_source", "true")
+	q.Set("include_ext_alt_text", "true")
+	q.Set("include_reply_count", "1")
+	q.Set("tweet_mode", "extended")
+	q.Set("include_entities", "true")
+	q.Set("include_user_entities", "true")
+	q.Set("include_ext_media_color", "true")
+	q.Set("include_ext_media_availability", "true")
+	q.Set("send_error_codes", "true")
+	return q
+}
+
+// userParams are query parameters the web client sends with every request returning users.
+func userParams() url.Values {
+	q := url.Values{}
+	q.Set("include_profile_interstitial_type", "1")
+	q.Set("include_blocking", "1")
+	q.Set("include_blocked_by", "1")
+	q.Set("include_followed_by", "1")
+	q.Set("include_want_retweets", "1")
+	q.Set("include_mute_edge", "1")
+	q.Set("include_can_dm", "1")
+	q.Set("include_can_media_tag", "1")
+	q.Set("skip_status", "1")
+	return q
+}
+
+// get requests path and decodes the response to result. Cookies and authorization are set by httpClient.
+func (c *Client) get(ctx context.Context, path string, q url.Values, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseUrl+path, nil)
+	if err != nil {
+		return err
+	}
+	req.URL.RawQuery = q.Encode()
+	req.Header.Set("Origin", "https://twitter.com")
+	req.Header.Set("Referer", "https://twitter.com/")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/73.0.3683.103 Safari/537.36")
+	req.Header.Set("x-twitter-active-user", "yes")
+	req.Header.Set("x-twitter-auth-type", "OAuth2Session")
+	req.Header.Set("x-twitter-client-language", "en")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+	defer resp.Body.Close()
+	jsonBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "read response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return parseError(resp.StatusCode, resp.Status, jsonBytes)
+	}
+	err = json.Unmarshal(jsonBytes, result)
+	if err != nil {
+		return errors.Wrapf(err, "parse response of %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package twitter_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+var ErrLimitReached = errors.New("api limit reached")
+var ErrPrivateProfile = errors.New("user has got private profile")
+var ErrUserNotFound = errors.New("user not found")
+var ErrUserSuspended = errors.New("user has been suspended")
+var ErrAccountLocked = errors.New("account of the session is locked")
+var ErrBadAuth = errors.New("session is not authenticated")
+
+// ErrPageNotFound is returned for resources which don't exist or aren't visible to the session, e.g. private lists.
+var ErrPageNotFound = errors.New("page does not exist")
+
+// Codes of twitter api errors, see https://developer.twitter.com/en/support/twitter-api/error-troubleshooting
+const (
+	CodeNoUserMatches        = 17
+	CodeCouldNotAuthenticate = 32
+	CodePageNotFound         = 34
+	CodeUserNotFound         = 50
+	CodeUserSuspended        = 63
+	CodeAccountSuspended     = 64
+	CodeRateLimitExceeded    = 88
+	CodeInvalidToken         = 89
+	CodeAccountLocked        = 326
+)
+
+var codeErrors = map[int]error{
+	CodeNoUserMatches:        ErrUserNotFound,
+	CodeCouldNotAuthenticate: ErrBadAuth,
+	CodePageNotFound:         ErrPageNotFound,
+	CodeUserNotFound:         ErrUserNotFound,
+	CodeUserSuspended:        ErrUserSuspended,
+	CodeAccountSuspended:     ErrBadAuth,
+	CodeRateLimitExceeded:    ErrLimitReached,
+	CodeInvalidToken:         ErrBadAuth,
+	CodeAccountLocked:        ErrAccountLocked,
+}
+
+// authErrorCodes are codes of errors meaning the session can't be used anymore.
+var authErrorCodes = map[int]bool{
+	CodeCouldNotAuthenticate: true,
+	CodeAccountSuspended:     true,
+	CodeInvalidToken:         true,
+	CodeAccountLocked:        true,
+}
+
+// IsAuthErrorCode checks whether the api error code means twitter rejected the session.
+func IsAuthErrorCode(code int) bool {
+	return authErrorCodes[code]
+}
+
+// StatusError is returned when api responds with unexpected status code.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad response status code, got %d (%s), want 200", e.StatusCode, e.Status)
+}
+
+// ApiError is the first error of the errors list in api response. Errors of known codes match
+// their sentinel errors with errors.Is, e.g. code 50 matches ErrUserNotFound.
+type ApiError struct {
+	StatusCode int
+	Code       int
+	Message    string
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("api error %d '%s', status code %d", e.Code, e.Message, e.StatusCode)
+}
+
+func (e *ApiError) Unwrap() error {
+	return codeErrors[e.Code]
+}
+
+type errorsResponse struct {
+	Errors []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// parseError makes an error of the response with status code other than 200.
+func parseError(statusCode int, status string, body []byte) error {
+	errResp := &errorsResponse{}
+	if json.Unmarshal(body, errResp) == nil && len(errResp.Errors) > 0 {
+		return &ApiError{
+			StatusCode: statusCode,
+			Code:       errResp.Errors[0].Code,
+			Message:    errResp.Errors[0].Message,
+		}
+	}
+	switch statusCode {
+	case 429:
+		return ErrLimitReached
+	case 401:
+		// twitter responds to requests for followers of protected users with {"request":..,"error":"Not authorized."}
+		return ErrPrivateProfile
+	}
+	return &StatusError{StatusCode: statusCode, Status: status}
+}
@@ -0,0 +1,33 @@
+package twitter_api
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	err := parseError(403, "403 Forbidden", []byte(`{"errors":[{"code":63,"message":"User has been suspended."}]}`))
+	assert.True(t, errors.Is(err, ErrUserSuspended))
+	var apiErr *ApiError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, 63, apiErr.Code)
+
+	err = parseError(429, "429 Too Many Requests", []byte(`{"errors":[{"code":88,"message":"Rate limit exceeded"}]}`))
+	assert.True(t, errors.Is(err, ErrLimitReached))
+	assert.Equal(t, ErrLimitReached, parseError(429, "429 Too Many Requests", nil))
+
+	err = parseError(401, "401 Unauthorized", []byte(`{"errors":[{"code":89,"message":"Invalid or expired token."}]}`))
+	assert.True(t, errors.Is(err, ErrBadAuth))
+	assert.False(t, errors.Is(err, ErrPrivateProfile), "expired session isn't a private profile")
+	err = parseError(401, "401 Unauthorized", []byte(`{"request":"/1.1/followers/list.json","error":"Not authorized."}`))
+	assert.Equal(t, ErrPrivateProfile, err)
+
+	err = parseError(404, "404 Not Found", []byte(`{"errors":[{"code":34,"message":"Sorry, that page does not exist."}]}`))
+	assert.True(t, errors.Is(err, ErrPageNotFound))
+	err = parseError(503, "503 Service Unavailable", []byte(`{"errors":[{"code":130,"message":"Over capacity"}]}`))
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Nil(t, errors.Unwrap(err))
+	err = parseError(502, "502 Bad Gateway", []byte("<html></html>"))
+	assert.Equal(t, &StatusError{StatusCode: 502, Status: "502 Bad Gateway"}, err)
+}
@@ -0,0 +1,94 @@
+package twitter_api
+
+import "github.com/scarecrow6977/twitter-crawler/crawler/models"
+
+// UsersPage is a page of a cursored users list, NextCursor is 0 on the last page.
+type UsersPage struct {
+	Users             []*models.User `json:"users"`
+	NextCursor        int64          `json:"next_cursor"`
+	NextCursorStr     string         `json:"next_cursor_str"`
+	PreviousCursor    int64          `json:"previous_cursor"`
+	PreviousCursorStr string         `json:"previous_cursor_str"`
+}
+
+// IdsPage is a page of a cursored user ids list, NextCursor is 0 on the last page.
+type IdsPage struct {
+	Ids               []int64 `json:"ids"`
+	NextCursor        int64   `json:"next_cursor"`
+	NextCursorStr     string  `json:"next_cursor_str"`
+	PreviousCursor    int64   `json:"previous_cursor"`
+	PreviousCursorStr string  `json:"previous_cursor_str"`
+}
+
+// Timeline is a page of a user's profile timeline or of search results. Tweets of the page and tweets they refer to,
+// e.g. retweeted ones, are in GlobalObjects, the order of tweets and cursors are in instructions.
+type Timeline struct {
+	GlobalObjects GlobalObjects        `json:"globalObjects"`
+	Timeline      TimelineInstructions `json:"timeline"`
+}
+
+type GlobalObjects struct {
+	Tweets map[string]*models.Tweet `json:"tweets"`
+	Users  map[string]*models.User  `json:"users"`
+}
+
+type TimelineInstructions struct {
+	Instructions []*TimelineInstruction `json:"instructions"`
+}
+
+// TimelineInstruction adds entries to the timeline or replaces one of them, cursors of pages after
+// the first one come in replaceEntry instructions.
+type TimelineInstruction struct {
+	AddEntries   *AddEntries   `json:"addEntries,omitempty"`
+	ReplaceEntry *ReplaceEntry `json:"replaceEntry,omitempty"`
+}
+
+type AddEntries struct {
+	Entries []*TimelineEntry `json:"entries"`
+}
+
+type ReplaceEntry struct {
+	EntryIdToReplace string         `json:"entryIdToReplace"`
+	Entry            *TimelineEntry `json:"entry"`
+}
+
+type TimelineEntry struct {
+	EntryId   string       `json:"entryId"`
+	SortIndex string       `json:"sortIndex"`
+	Content   EntryContent `json:"content"`
+}
+
+type EntryContent struct {
+	Operation *EntryOperation `json:"operation,omitempty"`
+}
+
+type EntryOperation struct {
+	Cursor TimelineCursor `json:"cursor"`
+}
+
+type TimelineCursor struct {
+	Value      string `json:"value"`
+	CursorType string `json:"cursorType"`
+}
+
+const CursorTypeBottom = "Bottom"
+
+// BottomCursor returns the cursor of the next (older) page, it's empty if there is none.
+func (t *Timeline) BottomCursor() string {
+	for _, instruction := range t.Timeline.Instructions {
+		var entries []*TimelineEntry
+		if instruction.AddEntries != nil {
+			entries = instruction.AddEntries.Entries
+		}
+		if instruction.ReplaceEntry != nil && instruction.ReplaceEntry.Entry != nil {
+			entries = append(entries, instruction.ReplaceEntry.Entry)
+		}
+		for _, entry := range entries {
+			operation := entry.Content.Operation
+			if operation != nil && operation.Cursor.CursorType == CursorTypeBottom {
+				return operation.Cursor.Value
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/scarecrow6977/twitter-crawler/crawler/conf"
+	"github.com/scarecrow6977/twitter-crawler/crawler/crawler"
+	"github.com/scarecrow6977/twitter-crawler/crawler/log"
+	remote_storage "github.com/scarecrow6977/twitter-crawler/crawler/storage/remote-storage"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+// Remote worker: runs crawler tasks given by the master (see master_listen in config) on this machine.
+func main() {
+	var configPath string
+	var masterUrl string
+	var numOfWorkers int
+	flag.StringVar(&configPath, "config", "config.yaml", "path to the config file")
+	flag.StringVar(&masterUrl, "master", "", "url of the master service, master_url from config by default")
+	flag.IntVar(&numOfWorkers, "workers", 0, "number of workers, num_of_workers from config by default")
+	flag.Parse()
+
+	conf.Init(configPath)
+	config, err := conf.LoadConfig()
+	if err != nil {
+		fmt.Printf("can't load config, err='%v'", err)
+		return
+	}
+	log.SetVerbosityLevel(2)
+
+	if masterUrl == "" {
+		masterUrl = config.MasterUrl
+	}
+	if masterUrl == "" {
+		log.LogError("master url is not set")
+		return
+	}
+	if numOfWorkers == 0 {
+		numOfWorkers = config.NumOfWorkers
+	}
+	shutdownTimeout := defaultShutdownTimeout
+	if config.ShutdownTimeout > 0 {
+		shutdownTimeout = time.Duration(config.ShutdownTimeout) * time.Second
+	}
+
+	client := remote_storage.NewClient(masterUrl, config.MasterToken)
+	remoteStorage := remote_storage.NewRemoteStorage(client)
+	queue := crawler.NewRemoteTaskQueue(client)
+	m := crawler.NewCrawlerMaster(numOfWorkers, 0, 0, shutdownTimeout, remoteStorage, queue, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signalCh
+		log.LogInfo("%v received, shutting down (send it again to exit immediately)", sig)
+		cancel()
+		<-signalCh
+		os.Exit(1)
+	}()
+
+	log.LogInfo("Running %d workers for master %s", numOfWorkers, masterUrl)
+	err = m.Run(ctx)
+	if err != nil {
+		log.LogError("workers stopped with error, err='%v'", err)
+	}
+}